@@ -0,0 +1,432 @@
+package sysvc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorSink sends logging errors on an errs channel without blocking.
+// Errors that do not fit in the channel are dropped and counted, so a reader
+// that falls behind does not stall logging.
+type errorSink struct {
+	dropped uint64 // first for 64-bit alignment on 32-bit platforms
+	errs    chan<- error
+}
+
+func newErrorSink(errs chan<- error) *errorSink {
+	return &errorSink{errs: errs}
+}
+
+func (e *errorSink) send(err error) error {
+	if err != nil && e.errs != nil {
+		select {
+		case e.errs <- err:
+		default:
+			atomic.AddUint64(&e.dropped, 1)
+		}
+	}
+	return err
+}
+
+func (e *errorSink) droppedErrors() uint64 {
+	return atomic.LoadUint64(&e.dropped)
+}
+
+// DroppedErrors returns how many errors l could not send on its errs channel
+// because the channel was full. It is 0 for Loggers of other packages.
+func DroppedErrors(l Logger) uint64 {
+	if d, ok := l.(interface{ droppedErrors() uint64 }); ok {
+		return d.droppedErrors()
+	}
+	return 0
+}
+
+// logRecord is a message waiting to be written.
+type logRecord struct {
+	time    time.Time
+	level   Level
+	message string
+	pc      uintptr
+	fields  map[string]string
+
+	// flushed, if set, makes the record a flush request rather than a
+	// message; the result of flushing the sink is sent on it.
+	flushed chan error
+}
+
+// text returns the message with the fields appended as key=value pairs.
+func (r logRecord) text() string {
+	if len(r.fields) == 0 {
+		return r.message
+	}
+	keys := make([]string, 0, len(r.fields))
+	for k := range r.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := &strings.Builder{}
+	b.WriteString(r.message)
+	for _, k := range keys {
+		fmt.Fprintf(b, " %s=%s", k, quoteValue(r.fields[k]))
+	}
+	return b.String()
+}
+
+// writeRecord writes r to l, keeping the fields if l can.
+func writeRecord(l Logger, r logRecord) error {
+	if fl, ok := l.(fieldLogger); ok {
+		return fl.logFields(r.level, r.message, r.pc, r.fields)
+	}
+	switch r.level {
+	case LevelError:
+		return l.Error(r.text())
+	case LevelWarning:
+		return l.Warning(r.text())
+	case LevelDebug:
+		if dl, ok := l.(DebugLogger); ok {
+			return dl.Debug(r.text())
+		}
+		return nil
+	default:
+		return l.Info(r.text())
+	}
+}
+
+// callerPC returns the program counter of the frame skip counts up, as for
+// runtime.Callers, or 0.
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	if runtime.Callers(skip, pcs[:]) == 0 {
+		return 0
+	}
+	return pcs[0]
+}
+
+// batchLogger is implemented by Loggers that write several messages at once
+// more cheaply than one by one.
+type batchLogger interface {
+	logBatch(records []logRecord) error
+}
+
+// ErrLogQueueFull is returned by an AsyncLogger when a message is dropped
+// because its queue is full.
+var ErrLogQueueFull = errors.New("log queue is full")
+
+// AsyncOptions configures an AsyncLogger.
+type AsyncOptions struct {
+	// QueueSize is how many messages can wait to be written. It defaults
+	// to 1024.
+	QueueSize int
+	// BatchSize is the most messages handed to the sink at once. It
+	// defaults to 64.
+	BatchSize int
+}
+
+const (
+	asyncQueueSizeDefault = 1024
+	asyncBatchSizeDefault = 64
+)
+
+// AsyncLogger writes to another Logger from a goroutine, so logging never
+// waits for a slow sink. Messages that arrive while the queue is full are
+// dropped and counted.
+type AsyncLogger struct {
+	dropped uint64 // first for 64-bit alignment on 32-bit platforms
+	*errorSink
+
+	l         Logger
+	batchSize int
+	queue     chan logRecord
+	done      chan struct{}
+
+	// mu guards closed, and queue against being closed while sent to.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncLogger returns an AsyncLogger writing to l. Errors returned by l
+// are sent on errs, if it is non-nil.
+func NewAsyncLogger(l Logger, opts AsyncOptions, errs chan<- error) *AsyncLogger {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = asyncQueueSizeDefault
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = asyncBatchSizeDefault
+	}
+	a := &AsyncLogger{
+		errorSink: newErrorSink(errs),
+		l:         l,
+		batchSize: opts.BatchSize,
+		queue:     make(chan logRecord, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncLogger) Error(v ...interface{}) error {
+	return a.log(LevelError, fmt.Sprint(v...), nil)
+}
+func (a *AsyncLogger) Warning(v ...interface{}) error {
+	return a.log(LevelWarning, fmt.Sprint(v...), nil)
+}
+func (a *AsyncLogger) Info(v ...interface{}) error {
+	return a.log(LevelInfo, fmt.Sprint(v...), nil)
+}
+func (a *AsyncLogger) Debug(v ...interface{}) error {
+	return a.log(LevelDebug, fmt.Sprint(v...), nil)
+}
+func (a *AsyncLogger) Errorf(format string, v ...interface{}) error {
+	return a.log(LevelError, fmt.Sprintf(format, v...), nil)
+}
+func (a *AsyncLogger) Warningf(format string, v ...interface{}) error {
+	return a.log(LevelWarning, fmt.Sprintf(format, v...), nil)
+}
+func (a *AsyncLogger) Infof(format string, v ...interface{}) error {
+	return a.log(LevelInfo, fmt.Sprintf(format, v...), nil)
+}
+func (a *AsyncLogger) Debugf(format string, v ...interface{}) error {
+	return a.log(LevelDebug, fmt.Sprintf(format, v...), nil)
+}
+
+// logFields implements fieldLogger.
+func (a *AsyncLogger) logFields(level Level, message string, pc uintptr, fields map[string]string) error {
+	return a.enqueue(logRecord{time: time.Now(), level: level, message: message, pc: pc, fields: fields})
+}
+
+func (a *AsyncLogger) log(level Level, message string, fields map[string]string) error {
+	return a.enqueue(logRecord{time: time.Now(), level: level, message: message, pc: callerPC(4), fields: fields})
+}
+
+func (a *AsyncLogger) enqueue(r logRecord) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrLoggerClosed
+	}
+	select {
+	case a.queue <- r:
+		return nil
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		return ErrLogQueueFull
+	}
+}
+
+// Dropped returns how many messages were dropped because the queue was
+// full.
+func (a *AsyncLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Flush waits until the messages logged before it are written, then
+// flushes the sink if it has a Flush method.
+func (a *AsyncLogger) Flush() error {
+	flushed := make(chan error, 1)
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return ErrLoggerClosed
+	}
+	a.queue <- logRecord{flushed: flushed}
+	a.mu.RUnlock()
+	return <-flushed
+}
+
+// Close writes the queued messages, then flushes and closes the sink if it
+// has Flush and Close methods. Logging after Close returns ErrLoggerClosed.
+func (a *AsyncLogger) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	err := a.flushSink()
+	if c, ok := a.l.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (a *AsyncLogger) flushSink() error {
+	if f, ok := a.l.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// run writes the queue to the sink, taking whatever is queued, up to
+// batchSize, at once.
+func (a *AsyncLogger) run() {
+	defer close(a.done)
+	batch := make([]logRecord, 0, a.batchSize)
+	for r := range a.queue {
+		batch = append(batch[:0], r)
+	fill:
+		for len(batch) < a.batchSize {
+			select {
+			case r, ok := <-a.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, r)
+			default:
+				break fill
+			}
+		}
+		a.write(batch)
+	}
+}
+
+// write writes batch, answering the flush requests in it once the messages
+// before them are written.
+func (a *AsyncLogger) write(batch []logRecord) {
+	start := 0
+	for i, r := range batch {
+		if r.flushed == nil {
+			continue
+		}
+		a.writeRecords(batch[start:i])
+		r.flushed <- a.flushSink()
+		start = i + 1
+	}
+	a.writeRecords(batch[start:])
+}
+
+func (a *AsyncLogger) writeRecords(records []logRecord) {
+	if len(records) == 0 {
+		return
+	}
+	if bl, ok := a.l.(batchLogger); ok {
+		a.send(bl.logBatch(records))
+		return
+	}
+	for _, r := range records {
+		a.send(writeRecord(a.l, r))
+	}
+}
+
+// serviceLogger returns the Logger of a service that is not running
+// interactively: the system Logger created by sys, combined with other sinks
+// and made asynchronous as the logging options say. Run closes the Loggers
+// built here once the program has stopped, so the last messages are written.
+func (c *Config) serviceLogger(errs chan<- error, sys func(errs chan<- error) (Logger, error)) (Logger, error) {
+	if errs != nil {
+		c.loggerList().setErrs(errs)
+	}
+	multi := c.useMultiLogger()
+	async := c.Option.bool(optionLogAsync, optionLogAsyncDefault)
+	if !multi && !async {
+		return sys(errs)
+	}
+
+	// A MultiLogger sends the errors of all its sinks on errs.
+	sysErrs := errs
+	if multi {
+		sysErrs = nil
+	}
+	l, err := sys(sysErrs)
+	if err != nil {
+		return nil, err
+	}
+	if multi {
+		sysLogger := l
+		if l, err = c.multiLogger(sysLogger, errs); err != nil {
+			if c, ok := sysLogger.(io.Closer); ok {
+				c.Close()
+			}
+			return nil, err
+		}
+	}
+	if async {
+		l = NewAsyncLogger(l, AsyncOptions{
+			QueueSize: c.Option.int(optionLogQueueSize, asyncQueueSizeDefault),
+		}, nil)
+	}
+	if closer, ok := l.(io.Closer); ok {
+		c.loggerList().add(closer)
+	}
+	return l, nil
+}
+
+// loggersMu guards setting Config.loggers in loggerList.
+var loggersMu sync.Mutex
+
+// loggerList returns the Loggers of the service. New and Manager.New set
+// the list up; it is made here for Configs handed to a System directly.
+func (c *Config) loggerList() *loggerList {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	if c.loggers == nil {
+		c.loggers = &loggerList{}
+	}
+	return c.loggers
+}
+
+// loggerList holds the Loggers serviceLogger built for a service, for Close.
+type loggerList struct {
+	mu      sync.Mutex
+	closers []io.Closer
+	// errs sends on the channel the service's Logger was last opened
+	// with, for the errors that arise outside of a Logger call.
+	errs *errorSink
+}
+
+func (ll *loggerList) setErrs(errs chan<- error) {
+	ll.mu.Lock()
+	ll.errs = newErrorSink(errs)
+	ll.mu.Unlock()
+}
+
+// errorSink returns the sink of the errs channel of the service's Logger.
+// Without one, errors are dropped.
+func (ll *loggerList) errorSink() *errorSink {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	if ll.errs == nil {
+		return newErrorSink(nil)
+	}
+	return ll.errs
+}
+
+func (ll *loggerList) add(c io.Closer) {
+	ll.mu.Lock()
+	ll.closers = append(ll.closers, c)
+	ll.mu.Unlock()
+}
+
+// take removes and returns the Loggers held.
+func (ll *loggerList) take() []io.Closer {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	closers := ll.closers
+	ll.closers = nil
+	return closers
+}
+
+// closeLoggers closes the Loggers that Service.Logger built for the service
+// from the logging options, writing the messages they still hold. Run calls
+// it when it returns, and the Close method of the services otherwise.
+func (c *Config) closeLoggers() error {
+	var errs multiError
+	for _, l := range c.loggerList().take() {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
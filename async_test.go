@@ -0,0 +1,245 @@
+package sysvc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestErrorSinkDoesNotBlock(t *testing.T) {
+	errs := make(chan error, 1)
+	l := NewFileLogger(failingWriter{}, errs)
+	for i := 0; i < 3; i++ {
+		if err := l.Info("x"); err == nil {
+			t.Fatal("Info() = nil, want error")
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("errs has %d errors, want 1", len(errs))
+	}
+	if got := DroppedErrors(l); got != 2 {
+		t.Errorf("DroppedErrors() = %d, want 2", got)
+	}
+	if got := DroppedErrors(ConsoleLogger); got != 0 {
+		t.Errorf("DroppedErrors(ConsoleLogger) = %d, want 0", got)
+	}
+}
+
+// recordingLogger records messages and can be held up to fill a queue.
+type recordingLogger struct {
+	mu      sync.Mutex
+	msgs    []string
+	hold    chan struct{}
+	flushes int
+	closed  bool
+}
+
+func (l *recordingLogger) add(prefix string, v ...interface{}) error {
+	if l.hold != nil {
+		<-l.hold
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, prefix+fmt.Sprint(v...))
+	return nil
+}
+
+func (l *recordingLogger) Error(v ...interface{}) error   { return l.add("E:", v...) }
+func (l *recordingLogger) Warning(v ...interface{}) error { return l.add("W:", v...) }
+func (l *recordingLogger) Info(v ...interface{}) error    { return l.add("I:", v...) }
+func (l *recordingLogger) Errorf(format string, a ...interface{}) error {
+	return l.add("E:", format)
+}
+func (l *recordingLogger) Warningf(format string, a ...interface{}) error {
+	return l.add("W:", format)
+}
+func (l *recordingLogger) Infof(format string, a ...interface{}) error {
+	return l.add("I:", format)
+}
+func (l *recordingLogger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushes++
+	return nil
+}
+func (l *recordingLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+func (l *recordingLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.msgs...)
+}
+
+func TestAsyncLogger(t *testing.T) {
+	sink := &recordingLogger{}
+	a := NewAsyncLogger(sink, AsyncOptions{}, nil)
+	a.Info("one")
+	a.Warning("two")
+	a.Debug("dropped, no debug level")
+	a.logFields(LevelError, "three", 0, map[string]string{"k": "v w"})
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"I:one", "W:two", `E:three k="v w"`}
+	if got := sink.messages(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+	if sink.flushes != 1 {
+		t.Errorf("flushes = %d, want 1", sink.flushes)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed {
+		t.Error("sink not closed")
+	}
+	if err := a.Info("late"); err != ErrLoggerClosed {
+		t.Errorf("Info() after Close = %v, want ErrLoggerClosed", err)
+	}
+}
+
+func TestAsyncLoggerQueueFull(t *testing.T) {
+	sink := &recordingLogger{hold: make(chan struct{})}
+	a := NewAsyncLogger(sink, AsyncOptions{QueueSize: 2, BatchSize: 1}, nil)
+
+	// The writer waits on hold, so the queue fills up.
+	var err error
+	queued := 0
+	for ; queued < 100; queued++ {
+		if err = a.Info("n"); err != nil {
+			break
+		}
+	}
+	if err != ErrLogQueueFull {
+		t.Fatalf("Info() = %v, want ErrLogQueueFull", err)
+	}
+	if a.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", a.Dropped())
+	}
+	close(sink.hold)
+	a.Close()
+	if got := len(sink.messages()); got != queued {
+		t.Errorf("%d messages written, want %d", got, queued)
+	}
+}
+
+func TestAsyncLoggerBatch(t *testing.T) {
+	w := &countingWriter{}
+	a := NewAsyncLogger(NewFileLogger(w, nil), AsyncOptions{BatchSize: 10}, nil)
+	// Hold the writer so the messages queue up behind the first write.
+	w.mu.Lock()
+	for i := 0; i < 5; i++ {
+		a.Infof("message %d", i)
+	}
+	w.mu.Unlock()
+	a.Close()
+
+	if got := strings.Count(w.b.String(), "\n"); got != 5 {
+		t.Errorf("%d lines written, want 5", got)
+	}
+	if w.writes >= 5 {
+		t.Errorf("%d writes for 5 messages, want them batched", w.writes)
+	}
+}
+
+type countingWriter struct {
+	mu     sync.Mutex
+	b      strings.Builder
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	return w.b.Write(p)
+}
+
+func TestCloseLoggers(t *testing.T) {
+	sink := &recordingLogger{}
+	c := &Config{Name: "async", Option: KeyValue{optionLogAsync: true}}
+	l, err := c.serviceLogger(nil, func(chan<- error) (Logger, error) { return sink, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("stopping")
+	c.closeLoggers()
+	if got := sink.messages(); len(got) != 1 || !sink.closed {
+		t.Errorf("after Close: messages = %q, closed = %v", got, sink.closed)
+	}
+
+	// Services made from one Config close their own Loggers.
+	var configs []*Config
+	m := &Manager{System: NewSystem("test", func() bool { return true }, func() bool { return false },
+		func(i Interface, platform string, c *Config) (Service, error) {
+			configs = append(configs, c)
+			return nil, nil
+		})}
+	base := &Config{Name: "async", Option: KeyValue{optionLogAsync: true}}
+	var sinks [2]*recordingLogger
+	for i := range sinks {
+		if _, err = m.New(nil, base); err != nil {
+			t.Fatal(err)
+		}
+		sink := &recordingLogger{}
+		if _, err = configs[i].serviceLogger(nil, func(chan<- error) (Logger, error) { return sink, nil }); err != nil {
+			t.Fatal(err)
+		}
+		sinks[i] = sink
+	}
+	if err = configs[0].closeLoggers(); err != nil {
+		t.Fatal(err)
+	}
+	if !sinks[0].closed || sinks[1].closed {
+		t.Errorf("closed = %v, %v, want only the first", sinks[0].closed, sinks[1].closed)
+	}
+	configs[1].closeLoggers()
+
+	c = &Config{Name: "sync"}
+	if l, _ = c.serviceLogger(nil, func(chan<- error) (Logger, error) { return sink, nil }); l != Logger(sink) {
+		t.Error("serviceLogger() wrapped without options")
+	}
+}
+
+func TestServiceLoggerConcurrent(t *testing.T) {
+	c := &Config{Name: "async", Option: KeyValue{optionLogAsync: true}}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.serviceLogger(nil, func(chan<- error) (Logger, error) { return &recordingLogger{}, nil })
+		}()
+	}
+	wg.Wait()
+	if n := len(c.loggers.closers); n != 2 {
+		t.Errorf("%d Loggers to close, want 2", n)
+	}
+	c.closeLoggers()
+}
+
+func TestLoggerListErrorSink(t *testing.T) {
+	c := &Config{Name: "capture"}
+	c.loggerList().errorSink().send(errors.New("dropped")) // No Logger yet.
+	errs := make(chan error, 1)
+	c.serviceLogger(errs, func(chan<- error) (Logger, error) { return &recordingLogger{}, nil })
+	want := errors.New("rotate failed")
+	c.loggerList().errorSink().send(want)
+	if got := <-errs; got != want {
+		t.Errorf("errs received %v, want %v", got, want)
+	}
+}
@@ -5,44 +5,197 @@
 package sysvc
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// ConsoleLogger logs to the std err.
-var ConsoleLogger = consoleLogger{}
+// ConsoleLogger logs to the std err. It is what Service.Logger returns when
+// running interactively, unless Manager.Logger is set.
+var ConsoleLogger Logger = NewConsoleLogger(ConsoleOptions{})
+
+// ConsoleFormat is the output format of a console Logger.
+type ConsoleFormat int
+
+const (
+	// ConsoleText writes lines such as "I: 15:04:05 message".
+	ConsoleText ConsoleFormat = iota
+	// ConsoleJSON writes one JSON object per line with the time, level and
+	// message, and the fields of messages logged through slog.
+	ConsoleJSON
+)
+
+// ColorMode selects whether a console Logger colors the level of messages.
+type ColorMode int
+
+const (
+	// ColorAuto uses colors if the writer is a terminal and the NO_COLOR
+	// environment variable is not set.
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+// ConsoleOptions configures a Logger returned by NewConsoleLogger.
+type ConsoleOptions struct {
+	// Writer receives the output. It defaults to os.Stderr.
+	Writer io.Writer
+	Format ConsoleFormat
+	// TimeLayout formats the time of each message. It defaults to
+	// "15:04:05" for text and time.RFC3339Nano for JSON.
+	TimeLayout string
+	// Color applies to the text format only.
+	Color ColorMode
+	// Level is the lowest level written; the zero value writes all.
+	Level Level
+}
+
+// NewConsoleLogger returns a Logger writing to a console, or any writer, as
+// opts says. It also implements DebugLogger.
+func NewConsoleLogger(opts ConsoleOptions) Logger {
+	if opts.Writer == nil {
+		opts.Writer = os.Stderr
+	}
+	if opts.TimeLayout == "" {
+		opts.TimeLayout = "15:04:05"
+		if opts.Format == ConsoleJSON {
+			opts.TimeLayout = time.RFC3339Nano
+		}
+	}
+	c := &consoleLogger{opts: opts}
+	switch opts.Color {
+	case ColorAlways:
+		c.color = true
+	case ColorAuto:
+		c.color = os.Getenv("NO_COLOR") == "" && isTerminal(opts.Writer)
+	}
+	return c
+}
+
+// isTerminal reports whether w is a character device, as a terminal is.
+// Windows consoles may not understand escape sequences, so it is false
+// there.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || runtime.GOOS == "windows" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
 
 type consoleLogger struct {
-	info, warn, err *log.Logger
+	opts  ConsoleOptions
+	color bool
+	mu    sync.Mutex
 }
 
-func init() {
-	ConsoleLogger.info = log.New(os.Stderr, "I: ", log.Ltime)
-	ConsoleLogger.warn = log.New(os.Stderr, "W: ", log.Ltime)
-	ConsoleLogger.err = log.New(os.Stderr, "E: ", log.Ltime)
+// consolePrefixes are the level prefixes of the text format and their ANSI
+// colors.
+var consolePrefixes = map[Level]struct{ prefix, color string }{
+	LevelDebug:   {"D", "90"},
+	LevelInfo:    {"I", "36"},
+	LevelWarning: {"W", "33"},
+	LevelError:   {"E", "31"},
 }
 
-func (c consoleLogger) Error(v ...interface{}) error {
-	c.err.Print(v...)
-	return nil
+func (c *consoleLogger) Error(v ...interface{}) error {
+	return c.write(LevelError, fmt.Sprint(v...), nil)
 }
-func (c consoleLogger) Warning(v ...interface{}) error {
-	c.warn.Print(v...)
-	return nil
+func (c *consoleLogger) Warning(v ...interface{}) error {
+	return c.write(LevelWarning, fmt.Sprint(v...), nil)
 }
-func (c consoleLogger) Info(v ...interface{}) error {
-	c.info.Print(v...)
-	return nil
+func (c *consoleLogger) Info(v ...interface{}) error {
+	return c.write(LevelInfo, fmt.Sprint(v...), nil)
 }
-func (c consoleLogger) Errorf(format string, a ...interface{}) error {
-	c.err.Printf(format, a...)
-	return nil
+func (c *consoleLogger) Errorf(format string, a ...interface{}) error {
+	return c.write(LevelError, fmt.Sprintf(format, a...), nil)
 }
-func (c consoleLogger) Warningf(format string, a ...interface{}) error {
-	c.warn.Printf(format, a...)
-	return nil
+func (c *consoleLogger) Warningf(format string, a ...interface{}) error {
+	return c.write(LevelWarning, fmt.Sprintf(format, a...), nil)
 }
-func (c consoleLogger) Infof(format string, a ...interface{}) error {
-	c.info.Printf(format, a...)
-	return nil
+func (c *consoleLogger) Infof(format string, a ...interface{}) error {
+	return c.write(LevelInfo, fmt.Sprintf(format, a...), nil)
+}
+func (c *consoleLogger) Debug(v ...interface{}) error {
+	return c.write(LevelDebug, fmt.Sprint(v...), nil)
+}
+func (c *consoleLogger) Debugf(format string, a ...interface{}) error {
+	return c.write(LevelDebug, fmt.Sprintf(format, a...), nil)
+}
+
+// logFields implements fieldLogger.
+func (c *consoleLogger) logFields(level Level, message string, pc uintptr, fields map[string]string) error {
+	return c.write(level, message, fields)
+}
+
+func (c *consoleLogger) write(level Level, message string, fields map[string]string) error {
+	if level < c.opts.Level {
+		return nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	now := time.Now().Format(c.opts.TimeLayout)
+	b := &strings.Builder{}
+	if c.opts.Format == ConsoleJSON {
+		b.WriteString(`{"time":`)
+		writeJSONString(b, now)
+		b.WriteString(`,"level":`)
+		writeJSONString(b, level.String())
+		b.WriteString(`,"msg":`)
+		writeJSONString(b, message)
+		for _, k := range keys {
+			b.WriteByte(',')
+			writeJSONString(b, k)
+			b.WriteByte(':')
+			writeJSONString(b, fields[k])
+		}
+		b.WriteString("}\n")
+	} else {
+		p := consolePrefixes[level]
+		if c.color {
+			fmt.Fprintf(b, "\x1b[%sm%s:\x1b[0m ", p.color, p.prefix)
+		} else {
+			b.WriteString(p.prefix + ": ")
+		}
+		b.WriteString(now)
+		b.WriteByte(' ')
+		b.WriteString(message)
+		for _, k := range keys {
+			fmt.Fprintf(b, " %s=%s", k, quoteValue(fields[k]))
+		}
+		if !strings.HasSuffix(message, "\n") || len(keys) > 0 {
+			b.WriteByte('\n')
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := io.WriteString(c.opts.Writer, b.String())
+	return err
+}
+
+func writeJSONString(b *strings.Builder, s string) {
+	v, _ := json.Marshal(s)
+	b.Write(v)
+}
+
+// quoteValue quotes s for a key=value pair if it is empty or would not be
+// read back as one word.
+func quoteValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
 }
@@ -0,0 +1,83 @@
+package sysvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestNewConsoleLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ConsoleOptions
+		log  func(l Logger)
+		want string
+	}{
+		{
+			name: "text",
+			opts: ConsoleOptions{TimeLayout: "-"},
+			log: func(l Logger) {
+				l.Info("started")
+				l.(DebugLogger).Debugf("port %d", 80)
+			},
+			want: "I: - started\nD: - port 80\n",
+		},
+		{
+			name: "fields",
+			opts: ConsoleOptions{TimeLayout: "-"},
+			log: func(l Logger) {
+				l.(fieldLogger).logFields(LevelWarning, "slow", 0, map[string]string{"path": "/a b", "ms": "12"})
+			},
+			want: "W: - slow ms=12 path=\"/a b\"\n",
+		},
+		{
+			name: "level",
+			opts: ConsoleOptions{TimeLayout: "-", Level: LevelWarning},
+			log: func(l Logger) {
+				l.Info("hidden")
+				l.(DebugLogger).Debug("hidden")
+				l.Error("shown")
+			},
+			want: "E: - shown\n",
+		},
+		{
+			name: "color",
+			opts: ConsoleOptions{TimeLayout: "-", Color: ColorAlways},
+			log:  func(l Logger) { l.Error("failed") },
+			want: "\x1b[31mE:\x1b[0m - failed\n",
+		},
+		{
+			name: "color auto without terminal",
+			opts: ConsoleOptions{TimeLayout: "-"},
+			log:  func(l Logger) { l.Error("failed") },
+			want: "E: - failed\n",
+		},
+		{
+			name: "json",
+			opts: ConsoleOptions{TimeLayout: "-", Format: ConsoleJSON, Color: ColorAlways},
+			log: func(l Logger) {
+				l.Warningf("quote %q", "x")
+				l.(fieldLogger).logFields(LevelInfo, "req", 0, map[string]string{"id": "7"})
+			},
+			want: `{"time":"-","level":"warning","msg":"quote \"x\""}` + "\n" +
+				`{"time":"-","level":"info","msg":"req","id":"7"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			tt.opts.Writer = b
+			tt.log(NewConsoleLogger(tt.opts))
+			if got := b.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.opts.Format == ConsoleJSON {
+				for _, line := range bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n")) {
+					if !json.Valid(line) {
+						t.Errorf("invalid JSON %s", line)
+					}
+				}
+			}
+		})
+	}
+}
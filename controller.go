@@ -0,0 +1,160 @@
+package sysvc
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrControlUnsupported is returned when the system cannot control services
+// by name, or cannot perform the requested action.
+var ErrControlUnsupported = errors.New("not supported by this system")
+
+// Controller controls a service that is already installed, whether or not
+// sysvc installed it. Every method returns ErrNotInstalled if the service
+// does not exist.
+type Controller interface {
+	// Start starts the service.
+	Start() error
+	// Stop stops the service.
+	Stop() error
+	// Restart restarts the service.
+	Restart() error
+	// Status returns the status of the service.
+	Status() (Status, error)
+	// Enable makes the service start at boot.
+	Enable() error
+	// Disable keeps the service from starting at boot.
+	Disable() error
+	// String returns the name of the service.
+	String() string
+	// Close releases what the Controller holds, such as its connection to
+	// systemd over D-Bus.
+	Close() error
+}
+
+// Reloader is implemented by the Controllers of systems that can ask a
+// service to reload its configuration without restarting.
+type Reloader interface {
+	Reload() error
+}
+
+// Open returns a Controller for the service called name on the chosen
+// system. opts are the options of the system, such as UserService, as for
+// Config.Option.
+func Open(name string, opts KeyValue) (Controller, error) {
+	return (&Manager{}).Open(name, opts)
+}
+
+// Open returns a Controller for the service called name on the system of m.
+func (m *Manager) Open(name string, opts KeyValue) (Controller, error) {
+	s, err := m.New(nil, &Config{Name: name, Option: opts})
+	if err != nil {
+		return nil, err
+	}
+	o, ok := s.(controlOpener)
+	if !ok {
+		return nil, ErrControlUnsupported
+	}
+	c := &controller{name: name, s: o.controller()}
+	if err = c.check(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if _, ok := c.s.(reloadable); ok {
+		return &reloadController{c}, nil
+	}
+	return c, nil
+}
+
+// controlOpener is implemented by services whose system can control any of
+// its services by name.
+type controlOpener interface {
+	controller() controllable
+}
+
+// controllable is what a system implements for Open. The Service methods of
+// a backend can often be used as they are; where they assume a definition
+// written by sysvc, the backend wraps them.
+type controllable interface {
+	// exists reports whether the service is defined.
+	exists() (bool, error)
+	Start() error
+	Stop() error
+	Restart() error
+	Status() (Status, error)
+	// enable and disable return ErrControlUnsupported if the system has
+	// no notion of starting services at boot apart from installing them.
+	enable() error
+	disable() error
+}
+
+// reloadable is implemented by controllables that can reload a service.
+type reloadable interface {
+	reload() error
+}
+
+type controller struct {
+	name string
+	s    controllable
+}
+
+func (c *controller) check() error {
+	ok, err := c.s.exists()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotInstalled
+	}
+	return nil
+}
+
+func (c *controller) do(action func() error) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return action()
+}
+
+func (c *controller) Start() error   { return c.do(c.s.Start) }
+func (c *controller) Stop() error    { return c.do(c.s.Stop) }
+func (c *controller) Restart() error { return c.do(c.s.Restart) }
+func (c *controller) Enable() error  { return c.do(c.s.enable) }
+func (c *controller) Disable() error { return c.do(c.s.disable) }
+func (c *controller) String() string { return c.name }
+
+func (c *controller) Close() error {
+	if cl, ok := c.s.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+func (c *controller) Status() (Status, error) {
+	if err := c.check(); err != nil {
+		return StatusUnknown, err
+	}
+	return c.s.Status()
+}
+
+// reloadController is a controller that is also a Reloader.
+type reloadController struct {
+	*controller
+}
+
+func (c *reloadController) Reload() error {
+	return c.do(c.s.(reloadable).reload)
+}
+
+// pathExists reports whether path exists.
+func pathExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,110 @@
+package sysvc
+
+import "testing"
+
+type fakeControllable struct {
+	installed bool
+	actions   []string
+}
+
+func (f *fakeControllable) exists() (bool, error) { return f.installed, nil }
+func (f *fakeControllable) act(action string) error {
+	f.actions = append(f.actions, action)
+	return nil
+}
+func (f *fakeControllable) Start() error            { return f.act("start") }
+func (f *fakeControllable) Stop() error             { return f.act("stop") }
+func (f *fakeControllable) Restart() error          { return f.act("restart") }
+func (f *fakeControllable) Status() (Status, error) { return StatusRunning, nil }
+func (f *fakeControllable) enable() error           { return f.act("enable") }
+func (f *fakeControllable) disable() error          { return ErrControlUnsupported }
+
+type fakeReloadable struct {
+	fakeControllable
+}
+
+func (f *fakeReloadable) reload() error { return f.act("reload") }
+
+// fakeOpenerService is a Service whose system can control services by name.
+type fakeOpenerService struct {
+	Service
+	c controllable
+}
+
+func (s fakeOpenerService) controller() controllable { return s.c }
+
+func fakeControlSystem(c controllable) System {
+	return NewSystem("fake-control",
+		func() bool { return true },
+		func() bool { return false },
+		func(i Interface, p string, cfg *Config) (Service, error) {
+			if c == nil {
+				return nil, nil
+			}
+			return fakeOpenerService{c: c}, nil
+		},
+	)
+}
+
+func TestOpen(t *testing.T) {
+	f := &fakeControllable{installed: true}
+	m := &Manager{System: fakeControlSystem(f)}
+	c, err := m.Open("nginx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(Reloader); ok {
+		t.Error("Controller is a Reloader, but the system cannot reload")
+	}
+	if c.String() != "nginx" {
+		t.Errorf("String() = %q, want nginx", c.String())
+	}
+	c.Start()
+	c.Enable()
+	if err = c.Disable(); err != ErrControlUnsupported {
+		t.Errorf("Disable() = %v, want ErrControlUnsupported", err)
+	}
+	if status, err := c.Status(); status != StatusRunning || err != nil {
+		t.Errorf("Status() = %v, %v", status, err)
+	}
+
+	// The service is removed while the Controller is held.
+	f.installed = false
+	if err = c.Stop(); err != ErrNotInstalled {
+		t.Errorf("Stop() = %v, want ErrNotInstalled", err)
+	}
+	if _, err = c.Status(); err != ErrNotInstalled {
+		t.Errorf("Status() = %v, want ErrNotInstalled", err)
+	}
+	if want := []string{"start", "enable"}; len(f.actions) != len(want) || f.actions[0] != want[0] || f.actions[1] != want[1] {
+		t.Errorf("actions = %q, want %q", f.actions, want)
+	}
+
+	if _, err = m.Open("nginx", nil); err != ErrNotInstalled {
+		t.Errorf("Open() of a missing service = %v, want ErrNotInstalled", err)
+	}
+}
+
+func TestOpenReload(t *testing.T) {
+	f := &fakeReloadable{fakeControllable{installed: true}}
+	c, err := (&Manager{System: fakeControlSystem(f)}).Open("nginx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := c.(Reloader)
+	if !ok {
+		t.Fatal("Controller is not a Reloader")
+	}
+	if err = r.Reload(); err != nil || len(f.actions) != 1 || f.actions[0] != "reload" {
+		t.Errorf("Reload() = %v, actions = %q", err, f.actions)
+	}
+}
+
+func TestOpenUnsupported(t *testing.T) {
+	if _, err := (&Manager{System: fakeControlSystem(nil)}).Open("nginx", nil); err != ErrControlUnsupported {
+		t.Errorf("Open() = %v, want ErrControlUnsupported", err)
+	}
+	if _, err := (&Manager{System: fakeControlSystem(nil)}).Open("", nil); err != ErrNameFieldRequired {
+		t.Errorf("Open() = %v, want ErrNameFieldRequired", err)
+	}
+}
@@ -0,0 +1,1185 @@
+package sysvc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This is a minimal D-Bus client, enough to talk to systemd: it connects to
+// a bus over a unix socket with EXTERNAL authentication, calls methods,
+// receives signals and can answer calls itself, which the tests use to stand
+// in for systemd. Messages are written little-endian and read in either
+// byte order.
+
+// D-Bus message types.
+const (
+	dbusMethodCall   byte = 1
+	dbusMethodReturn byte = 2
+	dbusError        byte = 3
+	dbusSignal       byte = 4
+)
+
+// D-Bus header fields.
+const (
+	dbusFieldPath        byte = 1
+	dbusFieldInterface   byte = 2
+	dbusFieldMember      byte = 3
+	dbusFieldErrorName   byte = 4
+	dbusFieldReplySerial byte = 5
+	dbusFieldDestination byte = 6
+	dbusFieldSender      byte = 7
+	dbusFieldSignature   byte = 8
+)
+
+// dbusFlagNoReplyExpected is the message flag telling the receiver not to
+// reply.
+const dbusFlagNoReplyExpected byte = 1
+
+// dbusMaxMessageSize is the largest message the protocol allows.
+const dbusMaxMessageSize = 128 << 20
+
+// dbusObjectPath is a value encoded as an object path rather than a string.
+type dbusObjectPath string
+
+// dbusSignature is a value encoded as a type signature rather than a string.
+type dbusSignature string
+
+// dbusVariant is a value encoded with its signature. Decoded variants are
+// returned as their value only.
+type dbusVariant struct {
+	sig   string
+	value interface{}
+}
+
+// dbusMessage is a D-Bus message with its body decoded.
+type dbusMessage struct {
+	typ         byte
+	flags       byte
+	serial      uint32
+	path        string
+	iface       string
+	member      string
+	errorName   string
+	replySerial uint32
+	destination string
+	sender      string
+	sig         string
+	body        []interface{}
+}
+
+// dbusCallError is the error reply to a method call.
+type dbusCallError struct {
+	name    string
+	message string
+}
+
+func (e *dbusCallError) Error() string {
+	if e.message == "" {
+		return e.name
+	}
+	return e.name + ": " + e.message
+}
+
+// dbusErrorName returns the D-Bus name of err if it is an error reply.
+func dbusErrorName(err error) string {
+	var e *dbusCallError
+	if errors.As(err, &e) {
+		return e.name
+	}
+	return ""
+}
+
+// errDBusClosed is returned for calls on a connection that was closed or
+// lost.
+var errDBusClosed = errors.New("dbus: connection closed")
+
+// dbusConn is a connection to a bus.
+type dbusConn struct {
+	c net.Conn
+	r *bufio.Reader
+
+	// name is the unique name the bus gave the connection.
+	name string
+
+	wmu    sync.Mutex
+	mu     sync.Mutex
+	serial uint32
+	calls  map[uint32]chan *dbusMessage
+	// signals receive the signals that arrive, those that would block
+	// are dropped.
+	signals []chan<- *dbusMessage
+	// handler answers the method calls that arrive, if set.
+	handler func(m *dbusMessage) (sig string, body []interface{}, err error)
+	err     error
+	done    chan struct{}
+}
+
+// systemBusAddress returns the address of the system bus.
+func systemBusAddress() string {
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "unix:path=/run/dbus/system_bus_socket"
+}
+
+// sessionBusAddress returns the address of the bus of the user, which
+// systemd --user listens on.
+func sessionBusAddress() string {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return "unix:path=" + filepath.Join(dir, "bus")
+	}
+	return "unix:path=/run/user/" + strconv.Itoa(os.Getuid()) + "/bus"
+}
+
+// dialDBus connects to the first unix socket of addr that accepts the
+// connection, authenticates and registers with the bus.
+func dialDBus(ctx context.Context, addr string) (*dbusConn, error) {
+	var errs multiError
+	for _, a := range strings.Split(addr, ";") {
+		socket, err := dbusSocket(a)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var d net.Dialer
+		nc, err := d.DialContext(ctx, "unix", socket)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c, err := newDBusConn(ctx, nc)
+		if err != nil {
+			nc.Close()
+			errs = append(errs, err)
+			continue
+		}
+		return c, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("dbus: no address in %q", addr)
+	}
+	return nil, errs.err()
+}
+
+// dbusSocket returns the socket of a unix address such as
+// unix:path=/run/dbus/system_bus_socket.
+func dbusSocket(addr string) (string, error) {
+	transport, params, found := strings.Cut(addr, ":")
+	if !found || transport != "unix" {
+		return "", fmt.Errorf("dbus: unsupported address %q", addr)
+	}
+	for _, kv := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(kv, "=")
+		value, err := dbusUnescape(value)
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case "path":
+			return value, nil
+		case "abstract":
+			return "@" + value, nil
+		}
+	}
+	return "", fmt.Errorf("dbus: unsupported address %q", addr)
+}
+
+// dbusUnescape decodes the %xx escapes of an address value.
+func dbusUnescape(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("dbus: bad escape in %q", s)
+		}
+		v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("dbus: bad escape in %q", s)
+		}
+		b.WriteByte(byte(v))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func newDBusConn(ctx context.Context, nc net.Conn) (*dbusConn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	c := &dbusConn{
+		c:     nc,
+		r:     bufio.NewReader(nc),
+		calls: map[uint32]chan *dbusMessage{},
+		done:  make(chan struct{}),
+	}
+	if err := c.auth(); err != nil {
+		return nil, err
+	}
+	go c.read()
+	nc.SetDeadline(time.Time{})
+
+	body, err := c.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "")
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if len(body) == 1 {
+		c.name, _ = body[0].(string)
+	}
+	return c, nil
+}
+
+// auth authenticates as the user of the process.
+func (c *dbusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.c, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: authentication failed: %s", strings.TrimSpace(line))
+	}
+	_, err = io.WriteString(c.c, "BEGIN\r\n")
+	return err
+}
+
+// Close closes the connection. Pending calls return errDBusClosed.
+func (c *dbusConn) Close() error {
+	err := c.c.Close()
+	<-c.done
+	return err
+}
+
+// read dispatches the messages that arrive until the connection fails.
+func (c *dbusConn) read() {
+	defer close(c.done)
+	for {
+		m, err := readDBusMessage(c.r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		switch m.typ {
+		case dbusMethodReturn, dbusError:
+			c.mu.Lock()
+			ch := c.calls[m.replySerial]
+			delete(c.calls, m.replySerial)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- m
+			}
+		case dbusSignal:
+			c.mu.Lock()
+			for _, ch := range c.signals {
+				select {
+				case ch <- m:
+				default:
+				}
+			}
+			c.mu.Unlock()
+		case dbusMethodCall:
+			go c.answer(m)
+		}
+	}
+}
+
+func (c *dbusConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	for serial, ch := range c.calls {
+		close(ch)
+		delete(c.calls, serial)
+	}
+}
+
+// answer replies to a method call with the handler, or with an error if
+// there is none.
+func (c *dbusConn) answer(m *dbusMessage) {
+	c.mu.Lock()
+	handler := c.handler
+	c.mu.Unlock()
+
+	var sig string
+	var body []interface{}
+	err := error(&dbusCallError{name: "org.freedesktop.DBus.Error.UnknownMethod", message: "no handler"})
+	if handler != nil {
+		sig, body, err = handler(m)
+	}
+	if m.flags&dbusFlagNoReplyExpected != 0 {
+		return
+	}
+	reply := &dbusMessage{typ: dbusMethodReturn, replySerial: m.serial, destination: m.sender, sig: sig, body: body}
+	if err != nil {
+		name := dbusErrorName(err)
+		if name == "" {
+			name = "org.freedesktop.DBus.Error.Failed"
+		}
+		reply = &dbusMessage{typ: dbusError, replySerial: m.serial, destination: m.sender,
+			errorName: name, sig: "s", body: []interface{}{err.Error()}}
+		if e, ok := err.(*dbusCallError); ok {
+			reply.body = []interface{}{e.message}
+		}
+	}
+	c.send(reply)
+}
+
+// handle makes handler answer the method calls that arrive.
+func (c *dbusConn) handle(handler func(m *dbusMessage) (sig string, body []interface{}, err error)) {
+	c.mu.Lock()
+	c.handler = handler
+	c.mu.Unlock()
+}
+
+// subscribe sends the signals that arrive on ch until cancel is called.
+// Signals are only routed to the connection once a match rule is added.
+func (c *dbusConn) subscribe(ch chan<- *dbusMessage) (cancel func()) {
+	c.mu.Lock()
+	c.signals = append(c.signals, ch)
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, s := range c.signals {
+			if s == ch {
+				c.signals = append(c.signals[:i], c.signals[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// send writes m with the next serial.
+func (c *dbusConn) send(m *dbusMessage) (uint32, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	c.serial++
+	m.serial = c.serial
+	c.mu.Unlock()
+	data, err := m.encode()
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.c.Write(data)
+	return m.serial, err
+}
+
+// call calls a method and returns the body of the reply. sig is the
+// signature of args.
+func (c *dbusConn) call(ctx context.Context, dest, path, iface, member, sig string, args ...interface{}) ([]interface{}, error) {
+	ch := make(chan *dbusMessage, 1)
+	m := &dbusMessage{typ: dbusMethodCall, destination: dest, path: path, iface: iface, member: member, sig: sig, body: args}
+
+	// The serial is only known once sent, so the reply channel is
+	// registered under the write lock, before the reply can arrive.
+	c.wmu.Lock()
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		c.wmu.Unlock()
+		return nil, errDBusClosed
+	}
+	c.serial++
+	m.serial = c.serial
+	c.calls[m.serial] = ch
+	c.mu.Unlock()
+	data, err := m.encode()
+	if err == nil {
+		_, err = c.c.Write(data)
+	}
+	c.wmu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.calls, m.serial)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return nil, errDBusClosed
+		}
+		if reply.typ == dbusError {
+			e := &dbusCallError{name: reply.errorName}
+			if len(reply.body) > 0 {
+				e.message, _ = reply.body[0].(string)
+			}
+			return nil, e
+		}
+		return reply.body, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.calls, m.serial)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// emit sends a signal.
+func (c *dbusConn) emit(path, iface, member, sig string, args ...interface{}) error {
+	_, err := c.send(&dbusMessage{typ: dbusSignal, path: path, iface: iface, member: member, sig: sig, body: args})
+	return err
+}
+
+// addMatch asks the bus to route the messages matching rule to the
+// connection.
+func (c *dbusConn) addMatch(ctx context.Context, rule string) error {
+	_, err := c.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "s", rule)
+	return err
+}
+
+// removeMatch undoes addMatch.
+func (c *dbusConn) removeMatch(ctx context.Context, rule string) error {
+	_, err := c.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "RemoveMatch", "s", rule)
+	return err
+}
+
+// requestName asks the bus for a well-known name.
+func (c *dbusConn) requestName(ctx context.Context, name string) error {
+	body, err := c.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "RequestName", "su", name, uint32(0))
+	if err != nil {
+		return err
+	}
+	// 1 is DBUS_REQUEST_NAME_REPLY_PRIMARY_OWNER.
+	if len(body) != 1 || body[0] != uint32(1) {
+		return fmt.Errorf("dbus: name %s is taken", name)
+	}
+	return nil
+}
+
+// getProperty returns a property of an object.
+func (c *dbusConn) getProperty(ctx context.Context, dest, path, iface, name string) (interface{}, error) {
+	body, err := c.call(ctx, dest, path, "org.freedesktop.DBus.Properties", "Get", "ss", iface, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != 1 {
+		return nil, errors.New("dbus: bad reply to Get")
+	}
+	return body[0], nil
+}
+
+// getAllProperties returns the properties of an interface of an object.
+func (c *dbusConn) getAllProperties(ctx context.Context, dest, path, iface string) (map[string]interface{}, error) {
+	body, err := c.call(ctx, dest, path, "org.freedesktop.DBus.Properties", "GetAll", "s", iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != 1 {
+		return nil, errors.New("dbus: bad reply to GetAll")
+	}
+	props, ok := body[0].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("dbus: bad reply to GetAll")
+	}
+	return props, nil
+}
+
+// encode returns the wire form of m.
+func (m *dbusMessage) encode() ([]byte, error) {
+	body := &dbusEncoder{}
+	if err := body.encodeAll(m.sig, m.body); err != nil {
+		return nil, err
+	}
+
+	var fields []interface{}
+	field := func(code byte, sig string, value interface{}) {
+		fields = append(fields, []interface{}{code, dbusVariant{sig, value}})
+	}
+	if m.path != "" {
+		field(dbusFieldPath, "o", m.path)
+	}
+	if m.iface != "" {
+		field(dbusFieldInterface, "s", m.iface)
+	}
+	if m.member != "" {
+		field(dbusFieldMember, "s", m.member)
+	}
+	if m.errorName != "" {
+		field(dbusFieldErrorName, "s", m.errorName)
+	}
+	if m.replySerial != 0 {
+		field(dbusFieldReplySerial, "u", m.replySerial)
+	}
+	if m.destination != "" {
+		field(dbusFieldDestination, "s", m.destination)
+	}
+	if m.sig != "" {
+		field(dbusFieldSignature, "g", m.sig)
+	}
+
+	h := &dbusEncoder{}
+	h.buf.WriteByte('l')
+	h.buf.WriteByte(m.typ)
+	h.buf.WriteByte(m.flags)
+	h.buf.WriteByte(1)
+	if err := h.encodeAll("uua(yv)", []interface{}{uint32(body.buf.Len()), m.serial, fields}); err != nil {
+		return nil, err
+	}
+	h.align(8)
+	h.buf.Write(body.buf.Bytes())
+	return h.buf.Bytes(), nil
+}
+
+// readDBusMessage reads a message from r.
+func readDBusMessage(r io.Reader) (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus: bad byte order %q", fixed[0])
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := 16 + int(fieldsLen)
+	headerLen += (8 - headerLen%8) % 8
+	if uint64(headerLen)+uint64(bodyLen) > dbusMaxMessageSize {
+		return nil, errors.New("dbus: message too large")
+	}
+	data := make([]byte, headerLen+int(bodyLen))
+	copy(data, fixed)
+	if _, err := io.ReadFull(r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &dbusMessage{typ: fixed[1], flags: fixed[2], serial: order.Uint32(fixed[8:])}
+	d := &dbusDecoder{data: data[:16+fieldsLen], order: order, pos: 12}
+	v, err := d.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := v.([]interface{})
+	if !ok {
+		return nil, errDBusBadField
+	}
+	for _, f := range fields {
+		f, ok := f.([]interface{})
+		if !ok || len(f) != 2 {
+			return nil, errDBusBadField
+		}
+		code, ok := f[0].(byte)
+		if !ok {
+			return nil, errDBusBadField
+		}
+		value := f[1]
+		s, _ := value.(string)
+		switch code {
+		case dbusFieldPath:
+			m.path = s
+		case dbusFieldInterface:
+			m.iface = s
+		case dbusFieldMember:
+			m.member = s
+		case dbusFieldErrorName:
+			m.errorName = s
+		case dbusFieldReplySerial:
+			m.replySerial, _ = value.(uint32)
+		case dbusFieldDestination:
+			m.destination = s
+		case dbusFieldSender:
+			m.sender = s
+		case dbusFieldSignature:
+			m.sig = s
+		}
+	}
+
+	d = &dbusDecoder{data: data[headerLen:], order: order}
+	for sig := m.sig; sig != ""; {
+		next, rest, err := dbusNextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(next)
+		if err != nil {
+			return nil, err
+		}
+		m.body = append(m.body, v)
+		sig = rest
+	}
+	return m, nil
+}
+
+// dbusNextType splits the first complete type off sig.
+func dbusNextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", errors.New("dbus: empty signature")
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := dbusNextType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		depth := 0
+		for i := 0; i < len(sig); i++ {
+			switch sig[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+				if depth == 0 {
+					// Empty structs and dict entries are not allowed.
+					if sig[i] != closing || i == 1 {
+						return "", "", fmt.Errorf("dbus: bad signature %q", sig)
+					}
+					return sig[:i+1], sig[i+1:], nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("dbus: bad signature %q", sig)
+	}
+	return sig[:1], sig[1:], nil
+}
+
+// dbusAlignment returns the alignment of the type starting sig.
+func dbusAlignment(sig string) int {
+	switch sig[0] {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+// dbusEncoder writes values little-endian.
+type dbusEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *dbusEncoder) align(n int) {
+	for e.buf.Len()%n != 0 {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *dbusEncoder) uint64(v uint64) {
+	e.align(8)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *dbusEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+// encodeAll encodes values, one for each complete type of sig.
+func (e *dbusEncoder) encodeAll(sig string, values []interface{}) error {
+	for i := 0; sig != ""; i++ {
+		next, rest, err := dbusNextType(sig)
+		if err != nil {
+			return err
+		}
+		if i >= len(values) {
+			return fmt.Errorf("dbus: too few values for %q", sig)
+		}
+		if err = e.encode(next, values[i]); err != nil {
+			return err
+		}
+		sig = rest
+	}
+	return nil
+}
+
+// encode encodes v as the type sig. Arrays take slices of any type, or maps
+// for arrays of dict entries; structs take []interface{}.
+func (e *dbusEncoder) encode(sig string, v interface{}) error {
+	bad := func() error {
+		return fmt.Errorf("dbus: cannot encode %T as %q", v, sig)
+	}
+	switch sig[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return bad()
+		}
+		e.buf.WriteByte(b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return bad()
+		}
+		var u uint32
+		if b {
+			u = 1
+		}
+		e.uint32(u)
+	case 'n', 'q':
+		var u uint16
+		switch v := v.(type) {
+		case int16:
+			u = uint16(v)
+		case uint16:
+			u = v
+		default:
+			return bad()
+		}
+		e.align(2)
+		e.buf.WriteByte(byte(u))
+		e.buf.WriteByte(byte(u >> 8))
+	case 'i', 'u', 'h':
+		switch v := v.(type) {
+		case int32:
+			e.uint32(uint32(v))
+		case uint32:
+			e.uint32(v)
+		case int:
+			e.uint32(uint32(v))
+		default:
+			return bad()
+		}
+	case 'x', 't':
+		switch v := v.(type) {
+		case int64:
+			e.uint64(uint64(v))
+		case uint64:
+			e.uint64(v)
+		case int:
+			e.uint64(uint64(v))
+		default:
+			return bad()
+		}
+	case 'd':
+		f, ok := v.(float64)
+		if !ok {
+			return bad()
+		}
+		e.uint64(math.Float64bits(f))
+	case 's', 'o':
+		switch v := v.(type) {
+		case string:
+			e.string(v)
+		case dbusObjectPath:
+			e.string(string(v))
+		default:
+			return bad()
+		}
+	case 'g':
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case dbusSignature:
+			s = string(v)
+		default:
+			return bad()
+		}
+		e.buf.WriteByte(byte(len(s)))
+		e.buf.WriteString(s)
+		e.buf.WriteByte(0)
+	case 'v':
+		variant, ok := v.(dbusVariant)
+		if !ok {
+			var err error
+			if variant, err = newDBusVariant(v); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(byte(len(variant.sig)))
+		e.buf.WriteString(variant.sig)
+		e.buf.WriteByte(0)
+		return e.encode(variant.sig, variant.value)
+	case 'a':
+		return e.encodeArray(sig[1:], v)
+	case '(':
+		fields, ok := v.([]interface{})
+		if !ok {
+			return bad()
+		}
+		e.align(8)
+		return e.encodeAll(sig[1:len(sig)-1], fields)
+	default:
+		return bad()
+	}
+	return nil
+}
+
+func (e *dbusEncoder) encodeArray(elem string, v interface{}) error {
+	e.uint32(0)
+	lenPos := e.buf.Len() - 4
+	e.align(dbusAlignment(elem))
+	start := e.buf.Len()
+
+	var err error
+	switch v := v.(type) {
+	case []interface{}:
+		for _, x := range v {
+			if err = e.encode(elem, x); err != nil {
+				return err
+			}
+		}
+	case []string:
+		for _, x := range v {
+			if err = e.encode(elem, x); err != nil {
+				return err
+			}
+		}
+	case []byte:
+		if elem != "y" {
+			return fmt.Errorf("dbus: cannot encode %T as a%s", v, elem)
+		}
+		e.buf.Write(v)
+	case map[string]interface{}:
+		if elem[0] != '{' {
+			return fmt.Errorf("dbus: cannot encode %T as a%s", v, elem)
+		}
+		keyType, valueType, err := dbusNextType(elem[1 : len(elem)-1])
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e.align(8)
+			if err = e.encode(keyType, k); err != nil {
+				return err
+			}
+			if err = e.encode(valueType, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("dbus: cannot encode %T as a%s", v, elem)
+	}
+
+	n := e.buf.Len() - start
+	if n > 64<<20 {
+		return errors.New("dbus: array too large")
+	}
+	binary.LittleEndian.PutUint32(e.buf.Bytes()[lenPos:], uint32(n))
+	return nil
+}
+
+// newDBusVariant returns a variant holding v, with the signature inferred
+// from its Go type.
+func newDBusVariant(v interface{}) (dbusVariant, error) {
+	switch v := v.(type) {
+	case dbusVariant:
+		return v, nil
+	case byte:
+		return dbusVariant{"y", v}, nil
+	case bool:
+		return dbusVariant{"b", v}, nil
+	case int16:
+		return dbusVariant{"n", v}, nil
+	case uint16:
+		return dbusVariant{"q", v}, nil
+	case int32:
+		return dbusVariant{"i", v}, nil
+	case uint32:
+		return dbusVariant{"u", v}, nil
+	case int64:
+		return dbusVariant{"x", v}, nil
+	case uint64:
+		return dbusVariant{"t", v}, nil
+	case float64:
+		return dbusVariant{"d", v}, nil
+	case string:
+		return dbusVariant{"s", v}, nil
+	case dbusObjectPath:
+		return dbusVariant{"o", v}, nil
+	case dbusSignature:
+		return dbusVariant{"g", v}, nil
+	case []string:
+		return dbusVariant{"as", v}, nil
+	case []byte:
+		return dbusVariant{"ay", v}, nil
+	case map[string]interface{}:
+		return dbusVariant{"a{sv}", v}, nil
+	}
+	return dbusVariant{}, fmt.Errorf("dbus: cannot encode %T in a variant", v)
+}
+
+// dbusDecoder reads values in either byte order. Positions are relative to
+// the start of the message, or of the body, which is 8-aligned.
+type dbusDecoder struct {
+	data  []byte
+	order binary.ByteOrder
+	pos   int
+	depth int
+}
+
+// dbusMaxDepth is how deep the protocol allows containers to nest.
+const dbusMaxDepth = 64
+
+var (
+	errDBusShort    = errors.New("dbus: message too short")
+	errDBusBadField = errors.New("dbus: bad header field")
+	errDBusDepth    = errors.New("dbus: containers nested too deep")
+)
+
+func (d *dbusDecoder) align(n int) error {
+	d.pos += (n - d.pos%n) % n
+	if d.pos > len(d.data) {
+		return errDBusShort
+	}
+	return nil
+}
+
+func (d *dbusDecoder) next(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) || n < 0 {
+		return nil, errDBusShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *dbusDecoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *dbusDecoder) uint64() (uint64, error) {
+	if err := d.align(8); err != nil {
+		return 0, err
+	}
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint64(b), nil
+}
+
+func (d *dbusDecoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+func (d *dbusDecoder) signature() (string, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	s, err := d.next(int(b[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(s[:b[0]]), nil
+}
+
+// decode decodes a value of the type sig. Arrays are returned as
+// []interface{}, except arrays of dict entries, which are returned as
+// map[string]interface{} if their keys are strings and
+// map[interface{}]interface{} otherwise. Structs are []interface{} and
+// variants their value. The signature is read from the message, so it is
+// checked before it is used.
+func (d *dbusDecoder) decode(sig string) (interface{}, error) {
+	if sig == "" {
+		return nil, errors.New("dbus: empty signature")
+	}
+	switch sig[0] {
+	case 'v', 'a', '(':
+		if d.depth++; d.depth > dbusMaxDepth {
+			return nil, errDBusDepth
+		}
+		defer func() { d.depth-- }()
+	}
+	switch sig[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		u, err := d.uint32()
+		return u != 0, err
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		u, err := d.uint32()
+		return int32(u), err
+	case 'u', 'h':
+		return d.uint32()
+	case 'x':
+		u, err := d.uint64()
+		return int64(u), err
+	case 't':
+		return d.uint64()
+	case 'd':
+		u, err := d.uint64()
+		return math.Float64frombits(u), err
+	case 's', 'o':
+		return d.string()
+	case 'g':
+		return d.signature()
+	case 'v':
+		s, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		// A variant holds exactly one complete type.
+		if next, rest, err := dbusNextType(s); err != nil || rest != "" || next != s {
+			return nil, fmt.Errorf("dbus: bad variant signature %q", s)
+		}
+		return d.decode(s)
+	case 'a':
+		return d.decodeArray(sig[1:])
+	case '(':
+		if len(sig) < 3 || sig[len(sig)-1] != ')' {
+			return nil, fmt.Errorf("dbus: bad signature %q", sig)
+		}
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		var fields []interface{}
+		for inner := sig[1 : len(sig)-1]; inner != ""; {
+			next, rest, err := dbusNextType(inner)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(next)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+			inner = rest
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("dbus: unsupported type %q", sig)
+}
+
+func (d *dbusDecoder) decodeArray(elem string) (interface{}, error) {
+	if elem == "" {
+		return nil, errors.New("dbus: array without element type")
+	}
+	if elem[0] == '{' && (len(elem) < 4 || elem[len(elem)-1] != '}') {
+		return nil, fmt.Errorf("dbus: bad signature %q", "a"+elem)
+	}
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if err = d.align(dbusAlignment(elem)); err != nil {
+		return nil, err
+	}
+	end := d.pos + int(n)
+	if end > len(d.data) {
+		return nil, errDBusShort
+	}
+
+	if elem[0] == '{' {
+		keyType, valueType, err := dbusNextType(elem[1 : len(elem)-1])
+		if err != nil {
+			return nil, err
+		}
+		strs := map[string]interface{}{}
+		other := map[interface{}]interface{}{}
+		for d.pos < end {
+			if err = d.align(8); err != nil {
+				return nil, err
+			}
+			k, err := d.decode(keyType)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(valueType)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := k.(string); ok {
+				strs[s] = v
+			} else {
+				other[k] = v
+			}
+		}
+		if len(other) > 0 {
+			return other, nil
+		}
+		return strs, nil
+	}
+
+	values := []interface{}{}
+	for d.pos < end {
+		v, err := d.decode(elem)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
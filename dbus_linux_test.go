@@ -0,0 +1,218 @@
+package sysvc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDBusMessage(t *testing.T) {
+	m := &dbusMessage{
+		typ:         dbusSignal,
+		serial:      7,
+		path:        "/org/freedesktop/systemd1/unit/app_2eservice",
+		iface:       "org.freedesktop.DBus.Properties",
+		member:      "PropertiesChanged",
+		destination: ":1.2",
+		sig:         "sa{sv}as(ybnqixtd)ao",
+		body: []interface{}{
+			"org.freedesktop.systemd1.Unit",
+			map[string]interface{}{
+				"ActiveState": "active",
+				"MainPID":     uint32(42),
+				"Names":       []string{"app.service"},
+				"Wrapped":     dbusVariant{"v", dbusVariant{"x", int64(-1)}},
+			},
+			[]string{},
+			[]interface{}{byte(1), true, int16(-2), uint16(3), int32(-4), int64(-5), uint64(6), 0.5},
+			[]interface{}{dbusObjectPath("/a"), dbusObjectPath("/b")},
+		},
+	}
+	data, err := m.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readDBusMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.typ != m.typ || got.serial != m.serial || got.path != m.path || got.iface != m.iface ||
+		got.member != m.member || got.destination != m.destination || got.sig != m.sig {
+		t.Errorf("header = %+v, want %+v", got, m)
+	}
+	want := []interface{}{
+		"org.freedesktop.systemd1.Unit",
+		map[string]interface{}{
+			"ActiveState": "active",
+			"MainPID":     uint32(42),
+			"Names":       []interface{}{"app.service"},
+			"Wrapped":     int64(-1),
+		},
+		[]interface{}{},
+		[]interface{}{byte(1), true, int16(-2), uint16(3), int32(-4), int64(-5), uint64(6), 0.5},
+		[]interface{}{"/a", "/b"},
+	}
+	if !reflect.DeepEqual(got.body, want) {
+		t.Errorf("body = %#v, want %#v", got.body, want)
+	}
+
+	if _, err = (&dbusMessage{typ: dbusMethodCall, sig: "u", body: []interface{}{"x"}}).encode(); err == nil {
+		t.Error("encoding a string as u succeeded")
+	}
+}
+
+func Test_dbusDecoderBadSignature(t *testing.T) {
+	variant := func(sig string) []byte {
+		return append(append([]byte{byte(len(sig))}, sig...), 0, 0, 0, 0, 0, 0, 0, 0)
+	}
+	tests := []struct {
+		sig  string
+		data []byte
+	}{
+		{"v", variant("a")},
+		{"v", variant("(")},
+		{"v", variant("()")},
+		{"v", variant("ss")},
+		{"v", variant("a{s}")},
+		{"v", bytes.Repeat(variant("v")[:3], dbusMaxDepth+1)},
+		{"a", make([]byte, 8)},
+		{"(", make([]byte, 8)},
+		{"a{", make([]byte, 8)},
+	}
+	for _, tt := range tests {
+		d := &dbusDecoder{data: tt.data, order: binary.LittleEndian}
+		if v, err := d.decode(tt.sig); err == nil {
+			t.Errorf("decode(%q) of %q = %#v, want an error", tt.sig, tt.data, v)
+		}
+	}
+}
+
+func Test_dbusSocket(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+		ok   bool
+	}{
+		{"unix:path=/run/dbus/system_bus_socket", "/run/dbus/system_bus_socket", true},
+		{"unix:abstract=/tmp/dbus-x,guid=0123", "@/tmp/dbus-x", true},
+		{"unix:path=/tmp/a%20b", "/tmp/a b", true},
+		{"tcp:host=localhost,port=1", "", false},
+		{"unix:tmpdir=/tmp", "", false},
+	}
+	for _, tt := range tests {
+		got, err := dbusSocket(tt.addr)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("dbusSocket(%q) = %q, %v", tt.addr, got, err)
+		}
+	}
+}
+
+// startDBusDaemon starts a bus for the test and returns its address, and a
+// func stopping it before the test ends.
+func startDBusDaemon(t *testing.T) (string, func()) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	err = os.WriteFile(config, []byte(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>custom</type>
+  <listen>unix:path=`+filepath.Join(dir, "bus")+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	t.Cleanup(stop)
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon did not print its address: %v", err)
+	}
+	return strings.TrimSpace(addr), stop
+}
+
+func TestDBusConn(t *testing.T) {
+	addr, _ := startDBusDaemon(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server, err := dialDBus(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.handle(func(m *dbusMessage) (string, []interface{}, error) {
+		if m.member != "Echo" {
+			return "", nil, &dbusCallError{name: "org.example.Error.Unknown", message: m.member}
+		}
+		return m.sig, m.body, nil
+	})
+	if err = server.requestName(ctx, "org.example.Echo"); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := dialDBus(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	body, err := client.call(ctx, "org.example.Echo", "/", "org.example.Echo", "Echo", "su", "hi", uint32(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(body, []interface{}{"hi", uint32(3)}) {
+		t.Errorf("Echo() = %#v", body)
+	}
+	_, err = client.call(ctx, "org.example.Echo", "/", "org.example.Echo", "Other", "")
+	if dbusErrorName(err) != "org.example.Error.Unknown" {
+		t.Errorf("Other() = %v, want org.example.Error.Unknown", err)
+	}
+
+	signals := make(chan *dbusMessage, 1)
+	defer client.subscribe(signals)()
+	if err = client.addMatch(ctx, "type='signal',interface='org.example.Echo'"); err != nil {
+		t.Fatal(err)
+	}
+	if err = server.emit("/", "org.example.Echo", "Ping", "i", int32(5)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-signals:
+		if m.member != "Ping" || m.sender != server.name || !reflect.DeepEqual(m.body, []interface{}{int32(5)}) {
+			t.Errorf("signal = %+v", m)
+		}
+	case <-ctx.Done():
+		t.Fatal("no signal received")
+	}
+}
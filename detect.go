@@ -0,0 +1,221 @@
+package sysvc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// envSystem names the System to use instead of detecting one, for example
+// SYSVC_SYSTEM=linux-openrc.
+const envSystem = "SYSVC_SYSTEM"
+
+// Probe is one check a System made while detecting whether it is available.
+type Probe struct {
+	// Kind is the kind of check: "stat", "lookPath", "pid1", "process",
+	// "file", "socket" or "command".
+	Kind string
+	// Target is what was checked, such as a path or a binary name.
+	Target string
+	// Result describes the outcome, such as the resolved path or an error.
+	Result string
+	// OK is true if the check succeeded.
+	OK bool
+}
+
+func (p Probe) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Target, p.Result)
+}
+
+// DetectResult is the outcome of one System's Detect.
+type DetectResult struct {
+	System   string
+	Detected bool
+	// Chosen is true for the System that is in use.
+	Chosen bool
+	Probes []Probe
+}
+
+// DetectionReport explains how the System in use was chosen.
+type DetectionReport struct {
+	// Override is the value of SYSVC_SYSTEM, if set.
+	Override string
+	// OverrideErr is set if Override does not name a registered System.
+	OverrideErr error
+	// Chosen is the name of the System in use, or "" if there is none.
+	Chosen string
+	// Systems lists every registered System in the order they are considered.
+	Systems []DetectResult
+}
+
+func (r DetectionReport) String() string {
+	b := &strings.Builder{}
+	if r.Override != "" {
+		fmt.Fprintf(b, "%s=%s\n", envSystem, r.Override)
+		if r.OverrideErr != nil {
+			fmt.Fprintf(b, "  ignored: %v\n", r.OverrideErr)
+		}
+	}
+	if r.Chosen == "" {
+		b.WriteString("chosen: none\n")
+	} else {
+		fmt.Fprintf(b, "chosen: %s\n", r.Chosen)
+	}
+	for _, sys := range r.Systems {
+		mark := " "
+		if sys.Chosen {
+			mark = "*"
+		}
+		fmt.Fprintf(b, "%s %s detected=%t\n", mark, sys.System, sys.Detected)
+		for _, p := range sys.Probes {
+			fmt.Fprintf(b, "    %s\n", p)
+		}
+	}
+	return b.String()
+}
+
+// prober runs the checks of a Detect and records them for DetectReport.
+// A nil *prober runs the checks without recording them, so probes made
+// outside of a report, or by another one, never end up in it.
+type prober struct {
+	probes []Probe
+}
+
+// record adds pr to the probes of p.
+func (p *prober) record(pr Probe) {
+	if p != nil {
+		p.probes = append(p.probes, pr)
+	}
+}
+
+// probeDetector is implemented by Systems whose Detect can record its
+// checks with a prober.
+type probeDetector interface {
+	detectProbes(p *prober) bool
+}
+
+// detectProbes runs sys.Detect and returns the probes it recorded.
+func detectProbes(sys System) (bool, []Probe) {
+	pd, ok := sys.(probeDetector)
+	if !ok {
+		return sys.Detect(), nil
+	}
+	p := &prober{}
+	detected := pd.detectProbes(p)
+	return detected, p.probes
+}
+
+// DetectReport runs Detect for every registered System and records the
+// checks each one made. It does not change the System in use.
+func DetectReport() DetectionReport {
+	report := DetectionReport{Override: os.Getenv(envSystem)}
+	systemMu.RLock()
+	if report.Override != "" {
+		if findSystem(report.Override) == nil {
+			report.OverrideErr = unknownSystemError(report.Override)
+		}
+	}
+	if system != nil {
+		report.Chosen = system.String()
+	}
+	registry := append([]System(nil), systemRegistry...)
+	systemMu.RUnlock()
+
+	for _, sys := range registry {
+		detected, probes := detectProbes(sys)
+		report.Systems = append(report.Systems, DetectResult{
+			System:   sys.String(),
+			Detected: detected,
+			Chosen:   sys.String() == report.Chosen,
+			Probes:   probes,
+		})
+	}
+	return report
+}
+
+// findSystem returns the registered system with the given name. systemMu
+// must be held.
+func findSystem(name string) System {
+	for _, sys := range systemRegistry {
+		if sys.String() == name {
+			return sys
+		}
+	}
+	return nil
+}
+
+func unknownSystemError(name string) error {
+	names := make([]string, 0, len(systemRegistry))
+	for _, sys := range systemRegistry {
+		names = append(names, sys.String())
+	}
+	return fmt.Errorf("unknown service system %q, available: %s", name, strings.Join(names, ", "))
+}
+
+// stat stats path and records the check.
+func (p *prober) stat(path string) error {
+	_, err := os.Stat(path)
+	pr := Probe{Kind: "stat", Target: path, Result: "exists", OK: err == nil}
+	if err != nil {
+		pr.Result = probeError(err)
+	}
+	p.record(pr)
+	return err
+}
+
+// lookPath looks up file in PATH and records the check.
+func (p *prober) lookPath(file string) (string, error) {
+	path, err := exec.LookPath(file)
+	pr := Probe{Kind: "lookPath", Target: file, Result: path, OK: err == nil}
+	if err != nil {
+		pr.Result = "not found"
+	}
+	p.record(pr)
+	return path, err
+}
+
+// dial reports whether the unix socket at path accepts connections and
+// records the check.
+func (p *prober) dial(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	pr := Probe{Kind: "socket", Target: path, Result: "accepts connections", OK: err == nil}
+	if err != nil {
+		pr.Result = probeError(err)
+	} else {
+		conn.Close()
+	}
+	p.record(pr)
+	return pr.OK
+}
+
+// fileMatch reports whether the file at path matches re and records the
+// check.
+func (p *prober) fileMatch(path string, re *regexp.Regexp) bool {
+	data, err := os.ReadFile(path)
+	pr := Probe{Kind: "file", Target: path + " =~ " + re.String()}
+	switch {
+	case err != nil:
+		pr.Result = probeError(err)
+	case re.Match(data):
+		pr.Result, pr.OK = "matches", true
+	default:
+		pr.Result = "no match"
+	}
+	p.record(pr)
+	return pr.OK
+}
+
+func probeError(err error) string {
+	if errors.Is(err, os.ErrNotExist) {
+		return "does not exist"
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err.Error()
+	}
+	return err.Error()
+}
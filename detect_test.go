@@ -0,0 +1,167 @@
+package sysvc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeSystem struct {
+	name     string
+	detected bool
+}
+
+func (f fakeSystem) String() string { return f.name }
+func (f fakeSystem) Detect() bool {
+	return f.detectProbes(nil)
+}
+func (f fakeSystem) detectProbes(p *prober) bool {
+	p.stat("/nonexistent/" + f.name)
+	return f.detected
+}
+func (f fakeSystem) Interactive() bool                           { return true }
+func (f fakeSystem) New(i Interface, c *Config) (Service, error) { return nil, nil }
+
+// withSystems replaces the registry for the duration of a test.
+func withSystems(t *testing.T, systems ...System) {
+	t.Helper()
+	oldRegistrations := append([]registration(nil), registrations...)
+	oldRegistry, oldSystem, oldChosen := systemRegistry, system, chosenName
+	t.Cleanup(func() {
+		registrations, systemRegistry, system, chosenName = oldRegistrations, oldRegistry, oldSystem, oldChosen
+	})
+	ChooseSystem(systems...)
+}
+
+func TestChooseSystemByName(t *testing.T) {
+	t.Setenv(envSystem, "")
+	withSystems(t, fakeSystem{"first", true}, fakeSystem{"second", false})
+
+	if got := Platform(); got != "first" {
+		t.Fatalf("Platform() = %q, want first", got)
+	}
+	if err := ChooseSystemByName("second"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Platform(); got != "second" {
+		t.Errorf("Platform() = %q, want second", got)
+	}
+	if err := ChooseSystemByName("third"); err == nil {
+		t.Error("ChooseSystemByName(third) succeeded, want error")
+	}
+	if got := Platform(); got != "second" {
+		t.Errorf("Platform() after failed choice = %q, want second", got)
+	}
+
+	// The choice outlives changes to the registry, but not its system.
+	RegisterSystem(fakeSystem{"third", true}, 10)
+	if got := Platform(); got != "second" {
+		t.Errorf("Platform() after RegisterSystem = %q, want second", got)
+	}
+	UnregisterSystem("second")
+	if got := Platform(); got != "third" {
+		t.Errorf("Platform() after UnregisterSystem = %q, want third", got)
+	}
+}
+
+func TestSystemOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		want     string
+		wantErr  bool
+	}{
+		{"none", "", "first", false},
+		{"known", "second", "second", false},
+		{"unknown", "third", "first", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envSystem, tt.override)
+			withSystems(t, fakeSystem{"first", true}, fakeSystem{"second", false})
+
+			if got := Platform(); got != tt.want {
+				t.Errorf("Platform() = %q, want %q", got, tt.want)
+			}
+			report := DetectReport()
+			if (report.OverrideErr != nil) != tt.wantErr {
+				t.Errorf("DetectReport().OverrideErr = %v, wantErr %v", report.OverrideErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectReport(t *testing.T) {
+	t.Setenv(envSystem, "")
+	withSystems(t, fakeSystem{"first", false}, fakeSystem{"second", true})
+
+	report := DetectReport()
+	if report.Chosen != "second" {
+		t.Errorf("Chosen = %q, want second", report.Chosen)
+	}
+	if len(report.Systems) != 2 {
+		t.Fatalf("len(Systems) = %d, want 2", len(report.Systems))
+	}
+	for i, want := range []DetectResult{
+		{System: "first", Detected: false, Chosen: false},
+		{System: "second", Detected: true, Chosen: true},
+	} {
+		got := report.Systems[i]
+		if got.System != want.System || got.Detected != want.Detected || got.Chosen != want.Chosen {
+			t.Errorf("Systems[%d] = %+v, want %+v", i, got, want)
+		}
+		if len(got.Probes) != 1 {
+			t.Errorf("Systems[%d] has %d probes, want 1", i, len(got.Probes))
+			continue
+		}
+		p := got.Probes[0]
+		if p.Kind != "stat" || p.Target != "/nonexistent/"+want.System || p.OK {
+			t.Errorf("Systems[%d].Probes[0] = %+v", i, p)
+		}
+	}
+	if s := report.String(); !strings.Contains(s, "* second detected=true") {
+		t.Errorf("String() = %q", s)
+	}
+
+	// Probes made outside of a report, or by another one running alongside
+	// it, are not recorded in it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var p *prober
+		for i := 0; i < 100; i++ {
+			p.stat(os.TempDir())
+			DetectReport()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		for _, sys := range DetectReport().Systems {
+			if len(sys.Probes) != 1 {
+				t.Fatalf("%s has %d probes, want 1", sys.System, len(sys.Probes))
+			}
+		}
+	}
+	<-done
+}
+
+func TestProberDial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	p := &prober{}
+	if !p.dial(path) {
+		t.Errorf("dial(%s) = false, want true", path)
+	}
+	if p.dial(path + ".missing") {
+		t.Errorf("dial(%s.missing) = true, want false", path)
+	}
+	if len(p.probes) != 2 || p.probes[0].Kind != "socket" || !p.probes[0].OK || p.probes[1].Result != "does not exist" {
+		t.Errorf("probes = %+v", p.probes)
+	}
+}
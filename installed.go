@@ -0,0 +1,228 @@
+package sysvc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// markerPrefix starts the marker sysvc writes into the definitions it
+// installs, followed by the marker as JSON on the same line.
+const markerPrefix = "sysvc: "
+
+// ErrListUnsupported is returned by ListInstalled for systems that cannot
+// tell which services sysvc installed.
+var ErrListUnsupported = errors.New("listing installed services is not supported by this system")
+
+// InstalledService is a service installed by sysvc, as found by
+// ListInstalled.
+type InstalledService struct {
+	Name string
+	// Path is the definition the service was found in.
+	Path string
+	// Version is the version of sysvc that installed the service.
+	Version string
+	// Config is the Config the service was installed with. EnvVars and
+	// options that may hold secrets, such as Password, are not recorded,
+	// nor are options that are not strings, numbers, booleans or string
+	// lists, such as functions. Whole numbers are read back as ints.
+	Config *Config
+}
+
+// ListInstalled returns the services of sys installed by sysvc, found by the
+// marker Install writes into their definitions. Custom templates set with
+// options such as SystemdScript carry the marker only if they include
+// {{ sysvcMarker . }} in a comment.
+func ListInstalled(sys System) ([]InstalledService, error) {
+	s, err := sys.New(nil, &Config{Name: "sysvc"})
+	if err != nil {
+		return nil, err
+	}
+	l, ok := s.(installedLister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	return l.listInstalled()
+}
+
+// installedLister is implemented by services whose System can find the
+// services installed by sysvc.
+type installedLister interface {
+	listInstalled() ([]InstalledService, error)
+}
+
+// installMarker is the record of sysvc in the definitions it installs.
+type installMarker struct {
+	Version string  `json:"version"`
+	Config  *Config `json:"config"`
+}
+
+// installMarker returns the marker for c, with the executable resolved. The
+// definitions are often readable by anyone, so EnvVars and options that may
+// hold secrets are left out, as are options that cannot be encoded.
+func (c *Config) installMarker() *installMarker {
+	cc := *c
+	if path, err := c.execPath(); err == nil {
+		cc.Executable = path
+	}
+	cc.EnvVars = nil
+	cc.Option = KeyValue{}
+	for k, v := range c.Option {
+		if secretOption(k) {
+			continue
+		}
+		switch v.(type) {
+		case string, bool, int, int64, uint, float64, []string:
+			cc.Option[k] = v
+		}
+	}
+	return &installMarker{Version: Version, Config: &cc}
+}
+
+// secretOption reports whether the option name suggests a secret, such as
+// the Password option of Windows.
+func secretOption(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"password", "secret", "token"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// markerJSON returns the marker for c as JSON. Besides <, > and &, which
+// encoding/json escapes, -- is escaped too, so the marker can be put in XML
+// comments.
+func (c *Config) markerJSON() []byte {
+	data, err := json.Marshal(c.installMarker())
+	if err != nil {
+		return nil
+	}
+	return bytes.Replace(data, []byte("--"), []byte(`-\u002d`), -1)
+}
+
+// markerText returns the marker line for c, without the comment characters
+// of the definition.
+func (c *Config) markerText() string {
+	return markerPrefix + string(c.markerJSON())
+}
+
+// sysvcMarker is the template function writing the marker. It takes the data
+// of the template, which embeds the Config.
+func sysvcMarker(data interface{ markerText() string }) string {
+	return data.markerText()
+}
+
+// parseMarker finds the marker in the definition data.
+func parseMarker(data []byte) (*installMarker, bool) {
+	scan := bufio.NewScanner(bytes.NewReader(data))
+	scan.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scan.Scan() {
+		line := scan.Text()
+		i := strings.Index(line, markerPrefix+"{")
+		if i < 0 {
+			continue
+		}
+		line = line[i+len(markerPrefix):]
+		if j := strings.LastIndex(line, "}"); j >= 0 {
+			line = line[:j+1]
+		}
+		m, err := decodeMarker([]byte(line))
+		if err != nil {
+			continue
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// decodeMarker decodes a marker, restoring the types of its options.
+func decodeMarker(data []byte) (*installMarker, error) {
+	m := &installMarker{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Config == nil || m.Config.Name == "" {
+		return nil, errors.New("marker has no service name")
+	}
+	for k, v := range m.Config.Option {
+		m.Config.Option[k] = markerOptionValue(v)
+	}
+	return m, nil
+}
+
+// markerOptionValue converts an option decoded from JSON back to the type the
+// options are read as: whole numbers become ints and lists []string.
+func markerOptionValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+			return int(v)
+		}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return v
+			}
+			list = append(list, s)
+		}
+		return list
+	}
+	return v
+}
+
+// listInstalledFiles returns the services whose definitions match one of
+// the glob patterns and carry the marker.
+func listInstalledFiles(patterns ...string) ([]InstalledService, error) {
+	var list []InstalledService
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			fi, err := os.Stat(path)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if m, ok := parseMarker(data); ok {
+				list = append(list, m.installedService(path))
+			}
+		}
+	}
+	return list, nil
+}
+
+func (m *installMarker) installedService(path string) InstalledService {
+	return InstalledService{Name: m.Config.Name, Path: path, Version: m.Version, Config: m.Config}
+}
+
+// userConfigPatterns returns the patterns below the home directory, or none
+// if it is unknown.
+func userConfigPatterns(patterns ...string) []string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return nil
+	}
+	for i, p := range patterns {
+		patterns[i] = filepath.Join(home, p)
+	}
+	return patterns
+}
@@ -0,0 +1,125 @@
+package sysvc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestMarker(t *testing.T) {
+	c := &Config{
+		Name:        "app",
+		Description: "serves <a> & --b",
+		Executable:  "/usr/bin/app",
+		Arguments:   []string{"-v"},
+		EnvVars:     map[string]string{"API_KEY": "hunter2"},
+		Option: KeyValue{
+			"Restart":     "always",
+			"RestartSec":  5,
+			"UserService": true,
+			"Ratio":       0.5,
+			"Tags":        []string{"a", "b"},
+			"RunWait":     func() {},
+			"Password":    "hunter2",
+		},
+	}
+	tmpl := template.Must(template.New("").Funcs(template.FuncMap{"sysvcMarker": sysvcMarker}).Parse(
+		"<?xml version=\"1.0\"?>\n<!-- {{ sysvcMarker . }} -->\n<exec>{{ .Path }}</exec>\n"))
+	b := &strings.Builder{}
+	if err := tmpl.Execute(b, struct {
+		*Config
+		Path string
+	}{c, c.Executable}); err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Split(b.String(), "\n")[1]
+	comment := strings.TrimSuffix(strings.TrimPrefix(line, "<!-- "), " -->")
+	if strings.Contains(comment, "--") || strings.ContainsAny(comment, "<>&") {
+		t.Errorf("marker %q cannot be put in an XML comment", comment)
+	}
+
+	m, ok := parseMarker([]byte(b.String()))
+	if !ok {
+		t.Fatalf("no marker found in %q", b.String())
+	}
+	if m.Version != Version {
+		t.Errorf("Version = %q, want %q", m.Version, Version)
+	}
+	got := m.Config
+	if got.Name != c.Name || got.Description != c.Description || got.Executable != c.Executable ||
+		!reflect.DeepEqual(got.Arguments, c.Arguments) {
+		t.Errorf("Config = %+v, want %+v", got, c)
+	}
+	want := KeyValue{
+		"Restart":     "always",
+		"RestartSec":  5,
+		"UserService": true,
+		"Ratio":       0.5,
+		"Tags":        []string{"a", "b"},
+	}
+	if !reflect.DeepEqual(got.Option, want) {
+		t.Errorf("Option = %#v, want %#v", got.Option, want)
+	}
+	if strings.Contains(b.String(), "hunter2") {
+		t.Errorf("marker %q holds a secret", comment)
+	}
+}
+
+func TestListInstalledFiles(t *testing.T) {
+	dir := t.TempDir()
+	marked := &Config{Name: "marked", Executable: "/usr/bin/marked"}
+	files := map[string]string{
+		"marked":     "#!/bin/sh\n# " + marked.markerText() + "\nexec /usr/bin/marked\n",
+		"plain":      "#!/bin/sh\nexec /usr/bin/plain\n",
+		"broken":     "#!/bin/sh\n# sysvc: {\"version\":\n",
+		"other.conf": "; " + (&Config{Name: "other"}).markerText() + "\n[program:other]\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{filepath.Join(dir, "*")}, []string{"marked", "other"}},
+		{[]string{filepath.Join(dir, "*.conf")}, []string{"other"}},
+		{[]string{filepath.Join(dir, "*"), filepath.Join(dir, "marked")}, []string{"marked", "other"}},
+		{[]string{filepath.Join(dir, "missing", "*")}, nil},
+	}
+	for _, tt := range tests {
+		list, err := listInstalledFiles(tt.patterns...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range list {
+			names = append(names, s.Name)
+			if s.Version != Version || s.Path != filepath.Join(dir, filepath.Base(s.Path)) {
+				t.Errorf("%s: Version = %q, Path = %q", s.Name, s.Version, s.Path)
+			}
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("listInstalledFiles(%q) = %q, want %q", tt.patterns, names, tt.want)
+		}
+	}
+}
+
+func TestListInstalledUnsupported(t *testing.T) {
+	sys := NewSystem("nolist",
+		func() bool { return true },
+		func() bool { return false },
+		func(i Interface, p string, c *Config) (Service, error) { return nil, nil },
+	)
+	if _, err := ListInstalled(sys); err != ErrListUnsupported {
+		t.Errorf("ListInstalled() = %v, want ErrListUnsupported", err)
+	}
+}
@@ -0,0 +1,244 @@
+package sysvc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// envInteractive overrides interactive detection when set to a boolean,
+// which is mostly useful in tests.
+const envInteractive = "SYSVC_INTERACTIVE"
+
+var (
+	cgroupFile     = "/proc/1/cgroup"
+	selfCgroupFile = "/proc/self/cgroup"
+	mountInfoFile  = "/proc/self/mountinfo"
+)
+
+// containerMarkers are substrings of cgroup paths and mount sources that
+// only appear inside containers.
+var containerMarkers = []string{
+	"docker", "lxc", "libpod", "podman", "containerd", "kubepods", "crio", "/containers/storage/",
+}
+
+// containerFiles are created by container runtimes in the container's root.
+var containerFiles = []string{"/.dockerenv", "/run/.containerenv"}
+
+// interactiveDetector decides whether the program runs under a service
+// manager. The fields are the inputs it reads, so tests can replace them.
+type interactiveDetector struct {
+	getenv         func(string) string
+	stat           func(string) error
+	cgroupFile     string
+	selfCgroupFile string
+	mountInfoFile  string
+	ppid           int
+	parentName     func(pid int) (string, error)
+	stderrID       func() (string, error)
+}
+
+func newInteractiveDetector() interactiveDetector {
+	return interactiveDetector{
+		getenv: os.Getenv,
+		stat: func(path string) error {
+			_, err := os.Stat(path)
+			return err
+		},
+		cgroupFile:     cgroupFile,
+		selfCgroupFile: selfCgroupFile,
+		mountInfoFile:  mountInfoFile,
+		ppid:           os.Getppid(),
+		parentName:     binaryName,
+		stderrID:       stderrDeviceInode,
+	}
+}
+
+// detect returns whether the program is interactive and a short reason.
+// The signals are considered from most to least reliable.
+func (d interactiveDetector) detect() (bool, string, error) {
+	if v := d.getenv(envInteractive); v != "" {
+		is, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, "", fmt.Errorf("invalid %s=%q: %v", envInteractive, v, err)
+		}
+		return is, fmt.Sprintf("%s=%s", envInteractive, v), nil
+	}
+
+	// systemd sets these for the processes it spawns. Anything started
+	// with systemd-run --scope gets INVOCATION_ID as well, so only trust it
+	// while running in the cgroup of a service.
+	if d.getenv("INVOCATION_ID") != "" {
+		if unit := systemdUnitFromCgroup(d.selfCgroupFile); strings.HasSuffix(unit, ".service") {
+			return false, fmt.Sprintf("INVOCATION_ID is set by systemd for %s", unit), nil
+		}
+	}
+	if stream := d.getenv("JOURNAL_STREAM"); stream != "" {
+		// Children of a service inherit the variable, so only trust it while
+		// stderr is still the journal stream.
+		if id, err := d.stderrID(); err == nil && id == stream {
+			return false, "stderr is the journal stream in JOURNAL_STREAM", nil
+		}
+	}
+	if d.getenv("NOTIFY_SOCKET") != "" {
+		return false, "NOTIFY_SOCKET is set by systemd", nil
+	}
+
+	inContainer, reason, err := d.inContainer()
+	if err != nil {
+		return false, "", err
+	}
+	if inContainer {
+		return true, reason, nil
+	}
+
+	if unit := systemdUnitFromCgroup(d.selfCgroupFile); strings.HasSuffix(unit, ".service") {
+		return false, fmt.Sprintf("running in the cgroup of %s", unit), nil
+	}
+
+	if d.ppid == 1 {
+		return false, "parent process is PID 1", nil
+	}
+	if binary, _ := d.parentName(d.ppid); binary == "systemd" {
+		return false, "parent process is systemd", nil
+	}
+	return true, "no service manager detected", nil
+}
+
+// inContainer reports whether the program runs inside a container.
+func (d interactiveDetector) inContainer() (bool, string, error) {
+	for _, name := range []string{"container", "KUBERNETES_SERVICE_HOST"} {
+		if d.getenv(name) != "" {
+			return true, fmt.Sprintf("%s is set by the container runtime", name), nil
+		}
+	}
+	for _, path := range containerFiles {
+		if d.stat(path) == nil {
+			return true, fmt.Sprintf("%s exists", path), nil
+		}
+	}
+
+	inContainer, err := isInContainer(d.cgroupFile)
+	if err != nil {
+		return false, "", err
+	}
+	if inContainer {
+		return true, fmt.Sprintf("%s names a container", d.cgroupFile), nil
+	}
+
+	// With cgroup v2 namespaces the cgroup is just "0::/", but the root
+	// mount still reveals where the root file system comes from. Other
+	// mounts are not considered, as hosts running containers have theirs
+	// under /var/lib/docker and the like.
+	if inContainer, _ = rootMountInContainer(d.mountInfoFile); inContainer {
+		return true, fmt.Sprintf("the root mount in %s names a container", d.mountInfoFile), nil
+	}
+	return false, "", nil
+}
+
+// isInteractive reports whether the program runs outside a service manager.
+func isInteractive() (bool, error) {
+	is, _, err := newInteractiveDetector().detect()
+	return is, err
+}
+
+// linuxInteractive is the interactive func shared by the Linux systems.
+func linuxInteractive() (bool, string) {
+	is, reason, err := newInteractiveDetector().detect()
+	if err != nil {
+		return is, err.Error()
+	}
+	return is, reason
+}
+
+// isInContainer checks if the service is being executed in a container by
+// looking for container markers in a cgroup file.
+func isInContainer(cgroupPath string) (bool, error) {
+	f, err := os.Open(cgroupPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		for _, marker := range containerMarkers {
+			if strings.Contains(scan.Text(), marker) {
+				return true, nil
+			}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// rootMountInContainer reports whether the entry of a mountinfo file for
+// the root mount names a container. Where "/" is mounted over, the last
+// entry is the one in effect.
+func rootMountInContainer(mountInfoPath string) (bool, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	root := ""
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		// The fifth field is the mount point.
+		if fields := strings.Fields(scan.Text()); len(fields) > 4 && fields[4] == "/" {
+			root = scan.Text()
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return false, err
+	}
+
+	for _, marker := range containerMarkers {
+		if strings.Contains(root, marker) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// systemdUnitFromCgroup returns the last element of the systemd cgroup path,
+// such as "foo.service" or "session-3.scope", from the cgroup v2 line or
+// the v1 name=systemd line.
+func systemdUnitFromCgroup(cgroupPath string) string {
+	f, err := os.Open(cgroupPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		parts := strings.SplitN(scan.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] != "" && parts[1] != "name=systemd" {
+			continue
+		}
+		path := strings.TrimRight(parts[2], "/")
+		return path[strings.LastIndexByte(path, '/')+1:]
+	}
+	return ""
+}
+
+// stderrDeviceInode formats stderr's device and inode the way systemd
+// does in JOURNAL_STREAM.
+func stderrDeviceInode() (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(2, &st); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), nil
+}
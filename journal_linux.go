@@ -0,0 +1,206 @@
+package sysvc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// journalSocket is where journald receives entries in its native protocol.
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+var journalSocket = "/run/systemd/journal/socket"
+
+// JournalLogger writes to the systemd journal using its native protocol,
+// keeping structured fields that log/syslog would lose.
+type JournalLogger struct {
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	identifier string
+	*errorSink
+}
+
+// NewJournalLogger connects to the journal. Entries are tagged with
+// identifier as SYSLOG_IDENTIFIER. If errs is non-nil, errors are also sent
+// on it.
+func NewJournalLogger(identifier string, errs chan<- error) (*JournalLogger, error) {
+	if _, err := os.Stat(journalSocket); err != nil {
+		return nil, err
+	}
+	// An unconnected socket keeps working across journald restarts.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalLogger{
+		conn:       conn,
+		addr:       &net.UnixAddr{Name: journalSocket, Net: "unixgram"},
+		identifier: identifier,
+		errorSink:  newErrorSink(errs),
+	}, nil
+}
+
+// Close closes the connection to the journal.
+func (j *JournalLogger) Close() error {
+	return j.conn.Close()
+}
+
+// Send writes message with priority and additional fields. Field names are
+// converted to upper case and characters journald does not accept are
+// replaced with underscores. Fields named like those the logger sets, such
+// as MESSAGE, PRIORITY, SYSLOG_* and CODE_*, get a USER_ prefix.
+func (j *JournalLogger) Send(priority syslog.Priority, message string, fields map[string]string) error {
+	return j.send(j.write(priority, message, callerPC(3), fields))
+}
+
+func (j *JournalLogger) Error(v ...interface{}) error {
+	return j.send(j.write(syslog.LOG_ERR, fmt.Sprint(v...), callerPC(3), nil))
+}
+func (j *JournalLogger) Warning(v ...interface{}) error {
+	return j.send(j.write(syslog.LOG_WARNING, fmt.Sprint(v...), callerPC(3), nil))
+}
+func (j *JournalLogger) Info(v ...interface{}) error {
+	return j.send(j.write(syslog.LOG_INFO, fmt.Sprint(v...), callerPC(3), nil))
+}
+func (j *JournalLogger) Errorf(format string, a ...interface{}) error {
+	return j.send(j.write(syslog.LOG_ERR, fmt.Sprintf(format, a...), callerPC(3), nil))
+}
+func (j *JournalLogger) Warningf(format string, a ...interface{}) error {
+	return j.send(j.write(syslog.LOG_WARNING, fmt.Sprintf(format, a...), callerPC(3), nil))
+}
+func (j *JournalLogger) Infof(format string, a ...interface{}) error {
+	return j.send(j.write(syslog.LOG_INFO, fmt.Sprintf(format, a...), callerPC(3), nil))
+}
+func (j *JournalLogger) Debug(v ...interface{}) error {
+	return j.send(j.write(syslog.LOG_DEBUG, fmt.Sprint(v...), callerPC(3), nil))
+}
+func (j *JournalLogger) Debugf(format string, a ...interface{}) error {
+	return j.send(j.write(syslog.LOG_DEBUG, fmt.Sprintf(format, a...), callerPC(3), nil))
+}
+
+// logFields implements fieldLogger.
+func (j *JournalLogger) logFields(level Level, message string, pc uintptr, fields map[string]string) error {
+	priority := syslog.LOG_INFO
+	switch level {
+	case LevelDebug:
+		priority = syslog.LOG_DEBUG
+	case LevelWarning:
+		priority = syslog.LOG_WARNING
+	case LevelError:
+		priority = syslog.LOG_ERR
+	}
+	return j.send(j.write(priority, message, pc, fields))
+}
+
+// write sends one entry. pc, if non-zero, sets the CODE_ fields.
+func (j *JournalLogger) write(priority syslog.Priority, message string, pc uintptr, fields map[string]string) error {
+	b := &bytes.Buffer{}
+	appendJournalField(b, "PRIORITY", strconv.Itoa(int(priority&0x07)))
+	appendJournalField(b, "SYSLOG_IDENTIFIER", j.identifier)
+	appendJournalField(b, "MESSAGE", message)
+	if pc != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		if frame.File != "" {
+			appendJournalField(b, "CODE_FILE", frame.File)
+			appendJournalField(b, "CODE_LINE", strconv.Itoa(frame.Line))
+			appendJournalField(b, "CODE_FUNC", frame.Function)
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := journalFieldName(k)
+		if name == "" {
+			continue
+		}
+		appendJournalField(b, name, fields[k])
+	}
+
+	_, _, err := j.conn.WriteMsgUnix(b.Bytes(), nil, j.addr)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+	return j.writeMemfd(b.Bytes())
+}
+
+// writeMemfd passes an entry too large for a datagram in a sealed memfd.
+func (j *JournalLogger) writeMemfd(data []byte) error {
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "journal-entry")
+	defer f.Close()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if _, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		return err
+	}
+	_, _, err = j.conn.WriteMsgUnix(nil, unix.UnixRights(int(f.Fd())), j.addr)
+	return err
+}
+
+// appendJournalField serializes one field. Values containing a newline use
+// the binary form: the name, a newline, the little-endian 64-bit length and
+// the value.
+func appendJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName turns key into a valid journal field name: upper case
+// letters, digits and underscores, not starting with a digit or an
+// underscore, which marks fields only journald may set. The fields write
+// sets itself are prefixed with USER_, so a field cannot add a second
+// MESSAGE or fake the CODE_ fields.
+func journalFieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	s := strings.TrimLeft(string(name), "_0123456789")
+	if s == "MESSAGE" || s == "PRIORITY" || strings.HasPrefix(s, "SYSLOG_") || strings.HasPrefix(s, "CODE_") {
+		s = "USER_" + s
+	}
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
+
+// useJournal reports whether the program's output is connected to the
+// journal, as it is when systemd starts it.
+func useJournal() bool {
+	return os.Getenv("JOURNAL_STREAM") != ""
+}
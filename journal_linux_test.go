@@ -0,0 +1,240 @@
+package sysvc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenJournal starts a fake journald and points journalSocket at it.
+func listenJournal(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	old := journalSocket
+	journalSocket = path
+	t.Cleanup(func() { journalSocket = old })
+	return conn
+}
+
+// readJournalEntry receives one entry, following a memfd if one is passed.
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	if oobn > 0 {
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "memfd")
+		defer f.Close()
+		seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seals&unix.F_SEAL_WRITE == 0 {
+			t.Error("memfd is not sealed")
+		}
+		f.Seek(0, 0)
+		var b bytes.Buffer
+		if _, err = b.ReadFrom(f); err != nil {
+			t.Fatal(err)
+		}
+		data = b.Bytes()
+	}
+	return parseJournalEntry(t, data)
+}
+
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			t.Fatalf("truncated entry %q", data)
+		}
+		line := data[:nl]
+		data = data[nl+1:]
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			fields[string(line[:eq])] = string(line[eq+1:])
+			continue
+		}
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[string(line)] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestJournalLogger(t *testing.T) {
+	conn := listenJournal(t)
+	j, err := NewJournalLogger("sysvc-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	if err = j.Warningf("disk %d%% full", 90); err != nil {
+		t.Fatal(err)
+	}
+	got := readJournalEntry(t, conn)
+	for k, v := range map[string]string{
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "sysvc-test",
+		"MESSAGE":           "disk 90% full",
+	} {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if !strings.HasSuffix(got["CODE_FILE"], "journal_linux_test.go") {
+		t.Errorf("CODE_FILE = %q, want this file", got["CODE_FILE"])
+	}
+	if !strings.HasSuffix(got["CODE_FUNC"], "TestJournalLogger") {
+		t.Errorf("CODE_FUNC = %q, want TestJournalLogger", got["CODE_FUNC"])
+	}
+
+	err = j.Send(syslog.LOG_ERR, "line one\nline two", map[string]string{
+		"request.id": "42",
+		"_PID":       "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = readJournalEntry(t, conn)
+	if got["MESSAGE"] != "line one\nline two" {
+		t.Errorf("MESSAGE = %q", got["MESSAGE"])
+	}
+	if got["PRIORITY"] != "3" {
+		t.Errorf("PRIORITY = %q, want 3", got["PRIORITY"])
+	}
+	if got["REQUEST_ID"] != "42" {
+		t.Errorf("REQUEST_ID = %q, want 42", got["REQUEST_ID"])
+	}
+	if got["PID"] != "1" {
+		t.Errorf("PID = %q, want 1", got["PID"])
+	}
+
+	// Fields cannot override the fields the logger sets.
+	err = j.Send(syslog.LOG_INFO, "real", map[string]string{
+		"message":           "fake",
+		"priority":          "0",
+		"syslog_identifier": "other",
+		"CODE_FILE":         "elsewhere.go",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data := make([]byte, 1<<16)
+	n, _, _, _, err := conn.ReadMsgUnix(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := bytes.Count(data[:n], []byte("\nMESSAGE=")); count != 1 {
+		t.Errorf("%d MESSAGE fields, want 1", count)
+	}
+	got = parseJournalEntry(t, data[:n])
+	for k, v := range map[string]string{
+		"MESSAGE":                "real",
+		"PRIORITY":               "6",
+		"SYSLOG_IDENTIFIER":      "sysvc-test",
+		"USER_MESSAGE":           "fake",
+		"USER_PRIORITY":          "0",
+		"USER_SYSLOG_IDENTIFIER": "other",
+		"USER_CODE_FILE":         "elsewhere.go",
+	} {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestJournalLoggerMemfd(t *testing.T) {
+	conn := listenJournal(t)
+	j, err := NewJournalLogger("sysvc-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	// Larger than any datagram the kernel accepts by default.
+	message := strings.Repeat("x", 8<<20)
+	if err = j.Info(message); err != nil {
+		t.Fatal(err)
+	}
+	got := readJournalEntry(t, conn)
+	if got["MESSAGE"] != message {
+		t.Errorf("MESSAGE has %d bytes, want %d", len(got["MESSAGE"]), len(message))
+	}
+}
+
+func TestJournalLoggerErrs(t *testing.T) {
+	listenJournal(t)
+	errs := make(chan error, 1)
+	j, err := NewJournalLogger("sysvc-test", errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	if err = j.Info("closed"); err == nil {
+		t.Fatal("Info() on a closed logger succeeded")
+	}
+	select {
+	case got := <-errs:
+		if got != err {
+			t.Errorf("errs received %v, want %v", got, err)
+		}
+	default:
+		t.Error("error was not sent on errs")
+	}
+}
+
+func Test_journalFieldName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"message", "USER_MESSAGE"},
+		{"Priority", "USER_PRIORITY"},
+		{"syslog_identifier", "USER_SYSLOG_IDENTIFIER"},
+		{"code.file", "USER_CODE_FILE"},
+		{"message_id", "MESSAGE_ID"},
+		{"user.id", "USER_ID"},
+		{"_SYSTEMD_UNIT", "SYSTEMD_UNIT"},
+		{"1st", "ST"},
+		{"ünï", "N__"},
+		{"", ""},
+		{strings.Repeat("a", 70), strings.Repeat("A", 64)},
+	}
+	for _, tt := range tests {
+		if got := journalFieldName(tt.key); got != tt.want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package sysvc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogStream identifies the output a log entry was written to.
+type LogStream int
+
+const (
+	// LogStreamAll selects both outputs in a LogQuery. Entries have it when
+	// the backend does not tell stdout and stderr apart.
+	LogStreamAll LogStream = iota
+	LogStreamStdout
+	LogStreamStderr
+)
+
+func (s LogStream) String() string {
+	switch s {
+	case LogStreamStdout:
+		return "stdout"
+	case LogStreamStderr:
+		return "stderr"
+	}
+	return "all"
+}
+
+// LogQuery selects the log entries returned by Logs.
+type LogQuery struct {
+	// Since excludes entries older than it, if set.
+	Since time.Time
+	// Lines limits the entries written before Logs was called to the last
+	// Lines; zero means all of them.
+	Lines int
+	// Follow keeps the channel open and sends new entries until the context
+	// is done.
+	Follow bool
+	// Stream selects stdout or stderr; LogStreamAll selects both.
+	Stream LogStream
+}
+
+// LogEntry is one line of a service's output.
+type LogEntry struct {
+	// Time is when the line was written. For log files without timestamps
+	// it is the modification time of the file for existing lines, and the
+	// time the line was read when following.
+	Time    time.Time
+	Stream  LogStream
+	Message string
+}
+
+// ErrLogsUnsupported is returned by Logs when the service manager does not
+// keep the output of services, or sysvc does not know where.
+var ErrLogsUnsupported = errors.New("reading logs is not supported by this service manager")
+
+// LogReader is implemented by the Services of systems that keep the output
+// of services, such as the journal, logd or log files.
+type LogReader interface {
+	// Logs returns the output of the service selected by q. The channel is
+	// closed once the entries have been sent or, with q.Follow, when ctx
+	// is done.
+	Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error)
+}
+
+// Logs returns the output of s selected by q, if s is a LogReader. It
+// returns ErrLogsUnsupported otherwise.
+func Logs(ctx context.Context, s Service, q LogQuery) (<-chan LogEntry, error) {
+	r, ok := s.(LogReader)
+	if !ok {
+		return nil, ErrLogsUnsupported
+	}
+	return r.Logs(ctx, q)
+}
+
+// logFollowInterval is how often followed log files are checked.
+var logFollowInterval = 250 * time.Millisecond
+
+// logFile is a file a service's output is written to.
+type logFile struct {
+	path   string
+	stream LogStream
+	// parse splits a timestamp written by the logger from a line. If nil,
+	// or if it returns the zero time, the line has no timestamp.
+	parse func(line string) (time.Time, string)
+}
+
+// tailLogFiles implements LogReader for backends that write output to
+// files. Files that are rotated or truncated while being followed are
+// reopened from the start.
+func tailLogFiles(ctx context.Context, q LogQuery, files []logFile) (<-chan LogEntry, error) {
+	var selected []logFile
+	for _, f := range files {
+		if q.Stream == LogStreamAll || f.stream == LogStreamAll || f.stream == q.Stream {
+			selected = append(selected, f)
+		}
+	}
+
+	var history []LogEntry
+	tails := make([]*fileTail, len(selected))
+	for i, f := range selected {
+		t := &fileTail{logFile: f}
+		entries, err := t.readHistory(q.Since, q.Lines)
+		if err != nil {
+			for _, t := range tails[:i] {
+				t.close()
+			}
+			return nil, err
+		}
+		history = append(history, entries...)
+		tails[i] = t
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	if q.Lines > 0 && len(history) > q.Lines {
+		history = history[len(history)-q.Lines:]
+	}
+
+	ch := make(chan LogEntry)
+	go func() {
+		defer close(ch)
+		defer func() {
+			for _, t := range tails {
+				t.close()
+			}
+		}()
+		for _, e := range history {
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !q.Follow {
+			return
+		}
+		ticker := time.NewTicker(logFollowInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, t := range tails {
+				for _, e := range t.readNew() {
+					select {
+					case ch <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// fileTail reads one log file and keeps track of where it left off.
+type fileTail struct {
+	logFile
+	f       *os.File
+	r       *bufio.Reader
+	partial string
+}
+
+func (t *fileTail) close() {
+	if t.f != nil {
+		t.f.Close()
+		t.f = nil
+	}
+}
+
+// logHistoryBlockSize is how much of a log file readHistory reads at once,
+// going back from the end.
+var logHistoryBlockSize int64 = 64 << 10
+
+// readHistory reads the lines already in the file, going back from the end
+// in blocks until it has the last lines of them, or reaches lines older than
+// since. A missing file has no lines; it is picked up once it is created
+// when following.
+func (t *fileTail) readHistory(since time.Time, lines int) ([]LogEntry, error) {
+	f, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Following goes on from the end.
+	size := fi.Size()
+	if _, err = f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	t.f, t.r = f, bufio.NewReader(f)
+
+	// Without a parser, every line gets the modification time of the file.
+	// With one, lines without a timestamp are timed later.
+	var fallback time.Time
+	if t.parse == nil {
+		fallback = fi.ModTime()
+	}
+	h := &logHistory{since: since, lines: lines}
+	var (
+		buf     []byte // the bytes from off not split into lines yet
+		off     = size
+		partial = true // whether buf still ends with the unterminated last line
+	)
+	for {
+		if off > 0 {
+			n := logHistoryBlockSize
+			if n > off {
+				n = off
+			}
+			off -= n
+			block := make([]byte, n, n+int64(len(buf)))
+			if _, err = f.ReadAt(block, off); err != nil {
+				t.close()
+				return nil, err
+			}
+			buf = append(block, buf...)
+		}
+		if partial {
+			i := bytes.LastIndexByte(buf, '\n')
+			if i < 0 && off > 0 {
+				continue
+			}
+			t.partial = string(buf[i+1:])
+			buf, partial = buf[:i+1], false
+		}
+		// Each line in buf ends with a newline, and is complete unless it
+		// is the first and the start of the file is not read yet.
+		for len(buf) > 0 {
+			i := bytes.LastIndexByte(buf[:len(buf)-1], '\n')
+			if i < 0 && off > 0 {
+				break
+			}
+			line := strings.TrimRight(string(buf[i+1:]), "\r\n")
+			buf = buf[:i+1]
+			if !h.add(t.entry(line, fallback)) {
+				return h.result(), nil
+			}
+		}
+		if off == 0 {
+			// Lines at the start of the file without a timestamp get its
+			// modification time.
+			h.setTime(fi.ModTime())
+			return h.result(), nil
+		}
+	}
+}
+
+// logHistory collects the entries of a log file from the last line back.
+type logHistory struct {
+	since time.Time
+	lines int
+	// entries are newest first. The last untimed of them have no timestamp
+	// and get the time of the line before them.
+	entries []LogEntry
+	untimed int
+}
+
+// add adds the entry of the line before those added so far, and reports
+// whether lines before it are still wanted.
+func (h *logHistory) add(e LogEntry) bool {
+	if e.Time.IsZero() {
+		h.entries = append(h.entries, e)
+		h.untimed++
+		return true
+	}
+	h.setTime(e.Time)
+	if !h.since.IsZero() && e.Time.Before(h.since) {
+		return false
+	}
+	h.entries = append(h.entries, e)
+	return h.lines <= 0 || len(h.entries) < h.lines
+}
+
+// setTime gives the untimed entries t, dropping them if it is before since.
+func (h *logHistory) setTime(t time.Time) {
+	n := len(h.entries) - h.untimed
+	for i := n; i < len(h.entries); i++ {
+		h.entries[i].Time = t
+	}
+	h.untimed = 0
+	if !h.since.IsZero() && t.Before(h.since) {
+		h.entries = h.entries[:n]
+	}
+}
+
+// result returns the last lines entries, oldest first.
+func (h *logHistory) result() []LogEntry {
+	entries := h.entries
+	if h.lines > 0 && len(entries) > h.lines {
+		entries = entries[:h.lines]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// readNew returns lines written since the last read, reopening the file if
+// it was replaced or truncated.
+func (t *fileTail) readNew() []LogEntry {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		// Rotated away and not yet recreated.
+		return nil
+	}
+	if t.f != nil {
+		cur, err := t.f.Stat()
+		pos, _ := t.f.Seek(0, io.SeekCurrent)
+		buffered := int64(t.r.Buffered())
+		if err != nil || !os.SameFile(cur, fi) || fi.Size() < pos-buffered {
+			// Drain what the old file still holds before switching.
+			entries := t.entries(t.readLines(), time.Now())
+			t.close()
+			t.partial = ""
+			return append(entries, t.reopen()...)
+		}
+	} else {
+		return t.reopen()
+	}
+	return t.entries(t.readLines(), time.Now())
+}
+
+func (t *fileTail) reopen() []LogEntry {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil
+	}
+	t.f, t.r = f, bufio.NewReader(f)
+	return t.entries(t.readLines(), time.Now())
+}
+
+// readLines reads complete lines, keeping an unterminated last line until
+// the rest of it is written.
+func (t *fileTail) readLines() []string {
+	var lines []string
+	for {
+		s, err := t.r.ReadString('\n')
+		if err != nil {
+			t.partial += s
+			return lines
+		}
+		lines = append(lines, strings.TrimRight(t.partial+s, "\r\n"))
+		t.partial = ""
+	}
+}
+
+func (t *fileTail) entries(lines []string, now time.Time) []LogEntry {
+	entries := make([]LogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = t.entry(line, now)
+	}
+	return entries
+}
+
+func (t *fileTail) entry(line string, fallback time.Time) LogEntry {
+	e := LogEntry{Time: fallback, Stream: t.stream, Message: line}
+	if t.parse != nil {
+		if ts, msg := t.parse(line); !ts.IsZero() {
+			e.Time, e.Message = ts, msg
+		}
+	}
+	return e
+}
+
+// timestampPrefixParser returns a parse func for lines that start with a
+// timestamp in layout followed by white space. Times without a zone are in
+// loc.
+func timestampPrefixParser(layout string, loc *time.Location) func(string) (time.Time, string) {
+	return func(line string) (time.Time, string) {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return time.Time{}, line
+		}
+		t, err := time.ParseInLocation(layout, line[:i], loc)
+		if err != nil {
+			return time.Time{}, line
+		}
+		return t, strings.TrimLeft(line[i:], " ")
+	}
+}
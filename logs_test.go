@@ -0,0 +1,242 @@
+package sysvc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func collect(t *testing.T, ch <-chan LogEntry) []LogEntry {
+	t.Helper()
+	var entries []LogEntry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func messages(entries []LogEntry) []string {
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.Stream.String() + ":" + e.Message
+	}
+	return msgs
+}
+
+func TestTailLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	stdout := filepath.Join(dir, "svc.log")
+	stderr := filepath.Join(dir, "svc.err")
+	old := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(stdout, []byte("out 1\nout 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stderr, []byte("err 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(stdout, old, old)
+	files := []logFile{
+		{path: stdout, stream: LogStreamStdout},
+		{path: stderr, stream: LogStreamStderr},
+		{path: filepath.Join(dir, "missing"), stream: LogStreamStdout},
+	}
+
+	tests := []struct {
+		name string
+		q    LogQuery
+		want []string
+	}{
+		{"all", LogQuery{}, []string{"stdout:out 1", "stdout:out 2", "stderr:err 1"}},
+		{"lines", LogQuery{Lines: 2}, []string{"stdout:out 2", "stderr:err 1"}},
+		{"stdout", LogQuery{Stream: LogStreamStdout}, []string{"stdout:out 1", "stdout:out 2"}},
+		{"stderr", LogQuery{Stream: LogStreamStderr}, []string{"stderr:err 1"}},
+		{"since", LogQuery{Since: old.Add(time.Minute)}, []string{"stderr:err 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := tailLogFiles(context.Background(), tt.q, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := messages(collect(t, ch))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestTailLogFilesParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "current")
+	data := "2024-01-02_03:04:05.12345 first\nno timestamp\n2024-01-02_03:04:07.5 second\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := tailLogFiles(context.Background(), LogQuery{Since: time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)}, []logFile{{
+		path:  path,
+		parse: timestampPrefixParser("2006-01-02_15:04:05.999999999", time.UTC),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The line without a timestamp belongs to the first line and is as old.
+	got := collect(t, ch)
+	if len(got) != 1 || got[0].Message != "second" {
+		t.Fatalf("got %q", messages(got))
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 7, 500000000, time.UTC); !got[0].Time.Equal(want) {
+		t.Errorf("Time = %v, want %v", got[0].Time, want)
+	}
+}
+
+func TestTailLogFilesHistory(t *testing.T) {
+	old := logHistoryBlockSize
+	logHistoryBlockSize = 8
+	defer func() { logHistoryBlockSize = old }()
+
+	path := filepath.Join(t.TempDir(), "current")
+	data := "2024-01-02_03:04:01 one\n" +
+		"2024-01-02_03:04:02 two\n" +
+		"a continuation line longer than a block\n" +
+		"2024-01-02_03:04:03 three\n" +
+		"\n" +
+		"2024-01-02_03:04:04 four\n" +
+		"unterminated"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []logFile{{
+		path:   path,
+		stream: LogStreamStdout,
+		parse:  timestampPrefixParser("2006-01-02_15:04:05", time.UTC),
+	}}
+
+	tests := []struct {
+		name string
+		q    LogQuery
+		want []string
+	}{
+		{"all", LogQuery{}, []string{"one", "two", "a continuation line longer than a block", "three", "", "four"}},
+		{"lines", LogQuery{Lines: 3}, []string{"three", "", "four"}},
+		{"since", LogQuery{Since: time.Date(2024, 1, 2, 3, 4, 2, 0, time.UTC)}, []string{"two", "a continuation line longer than a block", "three", "", "four"}},
+		{"since-lines", LogQuery{Since: time.Date(2024, 1, 2, 3, 4, 4, 0, time.UTC), Lines: 3}, []string{"four"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := tailLogFiles(context.Background(), tt.q, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := collect(t, ch)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", messages(got), tt.want)
+			}
+			for i := range got {
+				if got[i].Message != tt.want[i] {
+					t.Errorf("got %q, want %q", messages(got), tt.want)
+					break
+				}
+			}
+		})
+	}
+
+	// The continuation line has the time of the line before it.
+	ch, err := tailLogFiles(context.Background(), LogQuery{Lines: 4}, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, ch)
+	if want := time.Date(2024, 1, 2, 3, 4, 2, 0, time.UTC); len(got) != 4 || !got[0].Time.Equal(want) {
+		t.Errorf("got %v, want the continuation line at %v", got, want)
+	}
+}
+
+func TestTailLogFilesFollow(t *testing.T) {
+	old := logFollowInterval
+	logFollowInterval = 10 * time.Millisecond
+	defer func() { logFollowInterval = old }()
+
+	path := filepath.Join(t.TempDir(), "svc.log")
+	if err := os.WriteFile(path, []byte("before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := tailLogFiles(ctx, LogQuery{Follow: true}, []logFile{{path: path, stream: LogStreamStdout}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(want string) {
+		t.Helper()
+		select {
+		case e := <-ch:
+			if e.Message != want {
+				t.Errorf("got %q, want %q", e.Message, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	appendFile := func(path, data string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(data)
+		f.Close()
+	}
+
+	next("before")
+	appendFile(path, "partial")
+	time.Sleep(50 * time.Millisecond)
+	appendFile(path, " line\n")
+	next("partial line")
+
+	// Rotation: the file is renamed and a new one created.
+	appendFile(path, "last in old\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(path+".1", "late write\n")
+	appendFile(path, "first in new\n")
+	next("last in old")
+	next("late write")
+	next("first in new")
+
+	// Truncation: copytruncate style rotation.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(path, "after truncate\n")
+	next("after truncate")
+
+	cancel()
+	for range ch {
+	}
+}
+
+// plainService is a Service implementing none of the optional interfaces.
+type plainService struct {
+	Service
+	status Status
+}
+
+func (s plainService) Status() (Status, error) {
+	return s.status, nil
+}
+
+func TestLogsUnsupported(t *testing.T) {
+	if _, err := Logs(context.Background(), plainService{}, LogQuery{}); err != ErrLogsUnsupported {
+		t.Errorf("Logs() error = %v, want ErrLogsUnsupported", err)
+	}
+}
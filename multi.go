@@ -0,0 +1,183 @@
+package sysvc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LoggerSink is a Logger of a MultiLogger and the lowest level it is sent.
+type LoggerSink struct {
+	Logger Logger
+	Level  Level
+}
+
+// MultiLogger sends each message to several Loggers, skipping those whose
+// level is above the message's. It also implements DebugLogger.
+type MultiLogger struct {
+	sinks []LoggerSink
+	*errorSink
+}
+
+// NewMultiLogger returns a MultiLogger writing to sinks in order. The errors
+// of the sinks for one message are combined into one, which is also sent on
+// errs if it is non-nil.
+func NewMultiLogger(errs chan<- error, sinks ...LoggerSink) *MultiLogger {
+	return &MultiLogger{sinks: sinks, errorSink: newErrorSink(errs)}
+}
+
+func (m *MultiLogger) Error(v ...interface{}) error {
+	return m.log(LevelError, fmt.Sprint(v...))
+}
+func (m *MultiLogger) Warning(v ...interface{}) error {
+	return m.log(LevelWarning, fmt.Sprint(v...))
+}
+func (m *MultiLogger) Info(v ...interface{}) error {
+	return m.log(LevelInfo, fmt.Sprint(v...))
+}
+func (m *MultiLogger) Debug(v ...interface{}) error {
+	return m.log(LevelDebug, fmt.Sprint(v...))
+}
+func (m *MultiLogger) Errorf(format string, a ...interface{}) error {
+	return m.log(LevelError, fmt.Sprintf(format, a...))
+}
+func (m *MultiLogger) Warningf(format string, a ...interface{}) error {
+	return m.log(LevelWarning, fmt.Sprintf(format, a...))
+}
+func (m *MultiLogger) Infof(format string, a ...interface{}) error {
+	return m.log(LevelInfo, fmt.Sprintf(format, a...))
+}
+func (m *MultiLogger) Debugf(format string, a ...interface{}) error {
+	return m.log(LevelDebug, fmt.Sprintf(format, a...))
+}
+
+// logFields implements fieldLogger.
+func (m *MultiLogger) logFields(level Level, message string, pc uintptr, fields map[string]string) error {
+	return m.write(logRecord{level: level, message: message, pc: pc, fields: fields})
+}
+
+func (m *MultiLogger) log(level Level, message string) error {
+	return m.write(logRecord{level: level, message: message, pc: callerPC(4)})
+}
+
+func (m *MultiLogger) write(r logRecord) error {
+	var errs multiError
+	for _, s := range m.sinks {
+		if r.level < s.Level {
+			continue
+		}
+		if err := writeRecord(s.Logger, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return m.send(errs.err())
+}
+
+// Flush flushes the sinks that have a Flush method.
+func (m *MultiLogger) Flush() error {
+	var errs multiError
+	for _, s := range m.sinks {
+		if f, ok := s.Logger.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// Close closes the sinks that have a Close method.
+func (m *MultiLogger) Close() error {
+	var errs multiError
+	for _, s := range m.sinks {
+		if c, ok := s.Logger.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// multiError is the errors of several sinks.
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e multiError) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
+
+// parseLevel parses the name of a level, as returned by Level.String.
+func parseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// levelOption returns the level set by the option name.
+func (c *Config) levelOption(name string) (Level, error) {
+	v := c.Option.string(name, "")
+	if v == "" {
+		return LevelDebug, nil
+	}
+	return parseLevel(v)
+}
+
+// useMultiLogger reports whether any of the options multiLogger reads are
+// set.
+func (c *Config) useMultiLogger() bool {
+	return c.Option.string(optionLogLevel, "") != "" ||
+		c.Option.string(optionLogFile, "") != "" ||
+		c.Option.bool(optionLogConsole, optionLogConsoleDefault)
+}
+
+// multiLogger adds the sinks set by the LogFile and LogConsole options to
+// the system Logger l, filtering each by its level option.
+func (c *Config) multiLogger(l Logger, errs chan<- error) (Logger, error) {
+	var levels [3]Level
+	for i, name := range []string{optionLogLevel, optionLogFileLevel, optionLogConsoleLevel} {
+		var err error
+		if levels[i], err = c.levelOption(name); err != nil {
+			return nil, err
+		}
+	}
+	sinks := []LoggerSink{{Logger: l, Level: levels[0]}}
+
+	var file *RotatingFile
+	if path := c.Option.string(optionLogFile, ""); path != "" {
+		var err error
+		if file, err = OpenRotatingFile(path, c.rotateConfig()); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, LoggerSink{Logger: NewFileLogger(file, nil), Level: levels[1]})
+	}
+
+	// The console is only worth writing to if someone is watching it.
+	if c.Option.bool(optionLogConsole, optionLogConsoleDefault) && isTerminal(os.Stderr) {
+		sinks = append(sinks, LoggerSink{Logger: c.consoleLogger(), Level: levels[2]})
+	}
+	m := NewMultiLogger(errs, sinks...)
+	if file != nil {
+		// The file is reopened on SIGHUP outside of any call of m, so its
+		// errors are sent on errs like those of writing.
+		file.reopenOnHangup(m.errorSink)
+	}
+	return m, nil
+}
@@ -0,0 +1,96 @@
+package sysvc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiLogger(t *testing.T) {
+	all := &recordingLogger{}
+	warnings := &recordingLogger{}
+	errs := make(chan error, 1)
+	m := NewMultiLogger(errs,
+		LoggerSink{Logger: all, Level: LevelDebug},
+		LoggerSink{Logger: warnings, Level: LevelWarning},
+	)
+	m.Info("started")
+	m.Warning("slow")
+	m.logFields(LevelError, "failed", 0, map[string]string{"code": "7"})
+
+	if got, want := strings.Join(all.messages(), "|"), "I:started|W:slow|E:failed code=7"; got != want {
+		t.Errorf("all = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(warnings.messages(), "|"), "W:slow|E:failed code=7"; got != want {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+
+	m.Close()
+	if !all.closed || !warnings.closed {
+		t.Error("sinks not closed")
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("unexpected error %v", err)
+	default:
+	}
+}
+
+func TestMultiLoggerErrors(t *testing.T) {
+	errs := make(chan error, 2)
+	m := NewMultiLogger(errs,
+		LoggerSink{Logger: NewFileLogger(failingWriter{}, nil)},
+		LoggerSink{Logger: &recordingLogger{}},
+		LoggerSink{Logger: NewFileLogger(failingWriter{}, nil)},
+	)
+	err := m.Error("x")
+	if err == nil || err.Error() != "disk full; disk full" {
+		t.Fatalf("Error() = %v, want both sink errors", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("errs has %d errors, want 1", len(errs))
+	}
+}
+
+func TestServiceLoggerOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	sys := &recordingLogger{}
+	newSys := func(chan<- error) (Logger, error) { return sys, nil }
+
+	c := &Config{Name: "multi", Option: KeyValue{
+		optionLogLevel:     "warning",
+		optionLogFile:      path,
+		optionLogFileLevel: "info",
+	}}
+	l, err := c.serviceLogger(nil, newSys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("to file")
+	l.Error("to both")
+	c.closeLoggers()
+
+	if got, want := strings.Join(sys.messages(), "|"), "E:to both"; got != want {
+		t.Errorf("system = %q, want %q", got, want)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), " info to file\n") || !strings.Contains(string(b), " error to both\n") {
+		t.Errorf("file = %q", b)
+	}
+
+	c = &Config{Name: "bad", Option: KeyValue{optionLogFileLevel: "loud", optionLogFile: path}}
+	if _, err = c.serviceLogger(nil, newSys); err == nil || !strings.Contains(err.Error(), "loud") {
+		t.Errorf("serviceLogger() = %v, want unknown level error", err)
+	}
+
+	c = &Config{Name: "failing"}
+	want := errors.New("no syslog")
+	if _, err = c.serviceLogger(nil, func(chan<- error) (Logger, error) { return nil, want }); err != want {
+		t.Errorf("serviceLogger() = %v, want %v", err, want)
+	}
+}
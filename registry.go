@@ -0,0 +1,115 @@
+package sysvc
+
+import "sort"
+
+// registration is a System in the registry along with its priority. seq
+// keeps systems of equal priority in the order they were registered.
+type registration struct {
+	sys      System
+	priority int
+	seq      int
+}
+
+var (
+	registrations []registration
+	registerSeq   int
+)
+
+// RegisterSystem adds sys to the systems considered when choosing the
+// system service. Systems with a higher priority are considered first and
+// systems of equal priority in the order they were registered. A system
+// with the same name as sys is replaced.
+//
+// The built-in Linux systems are registered with priorities from 110 for
+// linux-container down to 0 for unix-systemv, in steps of 10, so a
+// priority of 95 is considered after linux-systemd but before linux-upstart.
+// Systems passed to ChooseSystem have priority 0.
+//
+// Calling this may change what Interactive and Platform return.
+func RegisterSystem(sys System, priority int) {
+	systemMu.Lock()
+	defer systemMu.Unlock()
+	addRegistration(sys, priority)
+	updateRegistry()
+}
+
+// UnregisterSystem removes the system with the given name, built-in or not,
+// and reports whether it was registered.
+//
+// Calling this may change what Interactive and Platform return.
+func UnregisterSystem(name string) bool {
+	systemMu.Lock()
+	defer systemMu.Unlock()
+	if !removeRegistration(name) {
+		return false
+	}
+	updateRegistry()
+	return true
+}
+
+func addRegistration(sys System, priority int) {
+	removeRegistration(sys.String())
+	registerSeq++
+	registrations = append(registrations, registration{
+		sys:      sys,
+		priority: priority,
+		seq:      registerSeq,
+	})
+}
+
+func removeRegistration(name string) bool {
+	for i, r := range registrations {
+		if r.sys.String() == name {
+			registrations = append(registrations[:i], registrations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// updateRegistry rebuilds systemRegistry from registrations and chooses the
+// system again. systemMu must be held.
+func updateRegistry() {
+	sort.SliceStable(registrations, func(i, j int) bool {
+		if registrations[i].priority != registrations[j].priority {
+			return registrations[i].priority > registrations[j].priority
+		}
+		return registrations[i].seq < registrations[j].seq
+	})
+	systemRegistry = make([]System, len(registrations))
+	for i, r := range registrations {
+		systemRegistry[i] = r.sys
+	}
+	system = newSystem()
+}
+
+// NewSystem builds a System from functions, for use with RegisterSystem.
+// new is passed name as the platform.
+func NewSystem(name string, detect func() bool, interactive func() bool, new func(i Interface, platform string, c *Config) (Service, error)) System {
+	return &funcSystem{
+		name:        name,
+		detect:      detect,
+		interactive: interactive,
+		new:         new,
+	}
+}
+
+type funcSystem struct {
+	name        string
+	detect      func() bool
+	interactive func() bool
+	new         func(i Interface, platform string, c *Config) (Service, error)
+}
+
+func (fs *funcSystem) String() string {
+	return fs.name
+}
+func (fs *funcSystem) Detect() bool {
+	return fs.detect()
+}
+func (fs *funcSystem) Interactive() bool {
+	return fs.interactive()
+}
+func (fs *funcSystem) New(i Interface, c *Config) (Service, error) {
+	return fs.new(i, fs.name, c)
+}
@@ -0,0 +1,75 @@
+package sysvc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func systemNames() []string {
+	var names []string
+	for _, sys := range AvailableSystems() {
+		names = append(names, sys.String())
+	}
+	return names
+}
+
+func TestRegisterSystem(t *testing.T) {
+	t.Setenv(envSystem, "")
+	withSystems(t, fakeSystem{"a", false}, fakeSystem{"b", true})
+
+	tests := []struct {
+		name     string
+		register func()
+		want     []string
+		chosen   string
+	}{
+		{"choose", func() {}, []string{"a", "b"}, "b"},
+		{"higher", func() { RegisterSystem(fakeSystem{"c", true}, 10) }, []string{"c", "a", "b"}, "c"},
+		{"lower", func() { RegisterSystem(fakeSystem{"d", true}, -10) }, []string{"c", "a", "b", "d"}, "c"},
+		{"equal", func() { RegisterSystem(fakeSystem{"e", false}, 10) }, []string{"c", "e", "a", "b", "d"}, "c"},
+		{"replace", func() { RegisterSystem(fakeSystem{"c", false}, -20) }, []string{"e", "a", "b", "d", "c"}, "b"},
+		{"unregister", func() { UnregisterSystem("b") }, []string{"e", "a", "d", "c"}, "d"},
+	}
+	for _, tt := range tests {
+		tt.register()
+		if got := systemNames(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: systems = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := Platform(); got != tt.chosen {
+			t.Errorf("%s: Platform() = %q, want %q", tt.name, got, tt.chosen)
+		}
+	}
+
+	if UnregisterSystem("missing") {
+		t.Error("UnregisterSystem(missing) = true, want false")
+	}
+}
+
+func TestNewSystem(t *testing.T) {
+	t.Setenv(envSystem, "")
+	withSystems(t, fakeSystem{"fallback", true})
+
+	var platform string
+	sys := NewSystem("custom",
+		func() bool { return true },
+		func() bool { return false },
+		func(i Interface, p string, c *Config) (Service, error) {
+			platform = p
+			return nil, nil
+		},
+	)
+	RegisterSystem(sys, 1)
+
+	if got := Platform(); got != "custom" {
+		t.Errorf("Platform() = %q, want custom", got)
+	}
+	if Interactive() {
+		t.Error("Interactive() = true, want false")
+	}
+	if _, err := New(nil, &Config{Name: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if platform != "custom" {
+		t.Errorf("platform = %q, want custom", platform)
+	}
+}
@@ -0,0 +1,491 @@
+package sysvc
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is a syslog facility.
+type Facility int
+
+// Syslog facilities for programs.
+const (
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityLocal0 Facility = 16
+	FacilityLocal1 Facility = 17
+	FacilityLocal2 Facility = 18
+	FacilityLocal3 Facility = 19
+	FacilityLocal4 Facility = 20
+	FacilityLocal5 Facility = 21
+	FacilityLocal6 Facility = 22
+	FacilityLocal7 Facility = 23
+)
+
+// SDElement is an RFC 5424 structured data element, such as
+// [origin@32473 software="api"].
+type SDElement struct {
+	ID     string
+	Params map[string]string
+}
+
+// RemoteSyslogConfig configures a RemoteSyslogLogger.
+type RemoteSyslogConfig struct {
+	// Network is "udp", "tcp" or "tls".
+	Network string
+	// Address of the collector, as host:port.
+	Address string
+	// TLSConfig is used for the "tls" network. If nil, the host of Address
+	// is verified with the system roots.
+	TLSConfig *tls.Config
+
+	// Facility defaults to FacilityDaemon.
+	Facility Facility
+	// Hostname defaults to os.Hostname.
+	Hostname string
+	// AppName defaults to the program name.
+	AppName string
+	// ProcID defaults to the process ID.
+	ProcID string
+	// MsgID is sent with every message; empty means none.
+	MsgID string
+	// StructuredData is sent with every message.
+	StructuredData []SDElement
+	// FieldsID is the SD-ID of the element that holds the fields of a
+	// message logged through slog. It defaults to "fields@32473".
+	FieldsID string
+
+	// BufferSize is how many messages are kept while the collector cannot
+	// be reached; the oldest are dropped first. It defaults to 1000.
+	BufferSize int
+	// Timeout bounds connecting and writing. It defaults to 5 seconds.
+	Timeout time.Duration
+	// ReconnectInterval is the minimum time between connection attempts.
+	// It defaults to 1 second.
+	ReconnectInterval time.Duration
+}
+
+const (
+	remoteSyslogBufferSizeDefault = 1000
+	remoteSyslogTimeoutDefault    = 5 * time.Second
+	remoteSyslogReconnectDefault  = time.Second
+	remoteSyslogFieldsIDDefault   = "fields@32473"
+)
+
+// ErrLoggerClosed is returned when logging to a closed Logger.
+var ErrLoggerClosed = errors.New("logger is closed")
+
+// RemoteSyslogLogger sends RFC 5424 messages to a syslog collector. Over TCP
+// and TLS messages are framed by octet counting (RFC 6587). Logging only
+// queues the message: a goroutine connects and sends, so a collector that
+// is down does not hold up the program. Messages that cannot be sent are
+// kept, up to BufferSize, and sent once the connection is restored. The
+// errors of connecting and sending are sent on errs.
+type RemoteSyslogLogger struct {
+	cfg  RemoteSyslogConfig
+	dial func() (net.Conn, error)
+	*errorSink
+
+	mu      sync.Mutex
+	pending [][]byte
+	dropped uint64
+	closed  bool
+
+	// wake tells the sender that messages are pending, and flushes asks
+	// it to send them now, for Flush and Close. quit stops it, and done is
+	// closed once it has.
+	wake    chan struct{}
+	flushes chan chan error
+	quit    chan struct{}
+	done    chan struct{}
+
+	// conn and nextDial are only used by the sender.
+	conn     net.Conn
+	nextDial time.Time
+}
+
+// NewRemoteSyslogLogger returns a Logger sending to the collector described
+// by cfg. The connection is made on first use, so an unreachable collector
+// is not an error here. If errs is non-nil, errors are also sent on it.
+// Close stops the goroutine sending the messages.
+func NewRemoteSyslogLogger(cfg RemoteSyslogConfig, errs chan<- error) (*RemoteSyslogLogger, error) {
+	switch cfg.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", cfg.Network)
+	}
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Facility == 0 {
+		cfg.Facility = FacilityDaemon
+	}
+	if cfg.Facility < 0 || cfg.Facility > FacilityLocal7 {
+		return nil, fmt.Errorf("invalid syslog facility %d", cfg.Facility)
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = filepath.Base(os.Args[0])
+	}
+	if cfg.ProcID == "" {
+		cfg.ProcID = strconv.Itoa(os.Getpid())
+	}
+	if cfg.FieldsID == "" {
+		cfg.FieldsID = remoteSyslogFieldsIDDefault
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = remoteSyslogBufferSizeDefault
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = remoteSyslogTimeoutDefault
+	}
+	if cfg.ReconnectInterval <= 0 {
+		cfg.ReconnectInterval = remoteSyslogReconnectDefault
+	}
+
+	l := &RemoteSyslogLogger{
+		cfg:       cfg,
+		errorSink: newErrorSink(errs),
+		wake:      make(chan struct{}, 1),
+		flushes:   make(chan chan error),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	switch cfg.Network {
+	case "tls":
+		tlsConfig := cfg.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+		l.dial = func() (net.Conn, error) {
+			return tls.DialWithDialer(dialer, "tcp", cfg.Address, tlsConfig)
+		}
+	default:
+		l.dial = func() (net.Conn, error) {
+			return dialer.Dial(cfg.Network, cfg.Address)
+		}
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *RemoteSyslogLogger) Error(v ...interface{}) error {
+	return l.log(LevelError, fmt.Sprint(v...), nil)
+}
+func (l *RemoteSyslogLogger) Warning(v ...interface{}) error {
+	return l.log(LevelWarning, fmt.Sprint(v...), nil)
+}
+func (l *RemoteSyslogLogger) Info(v ...interface{}) error {
+	return l.log(LevelInfo, fmt.Sprint(v...), nil)
+}
+func (l *RemoteSyslogLogger) Debug(v ...interface{}) error {
+	return l.log(LevelDebug, fmt.Sprint(v...), nil)
+}
+func (l *RemoteSyslogLogger) Errorf(format string, a ...interface{}) error {
+	return l.log(LevelError, fmt.Sprintf(format, a...), nil)
+}
+func (l *RemoteSyslogLogger) Warningf(format string, a ...interface{}) error {
+	return l.log(LevelWarning, fmt.Sprintf(format, a...), nil)
+}
+func (l *RemoteSyslogLogger) Infof(format string, a ...interface{}) error {
+	return l.log(LevelInfo, fmt.Sprintf(format, a...), nil)
+}
+func (l *RemoteSyslogLogger) Debugf(format string, a ...interface{}) error {
+	return l.log(LevelDebug, fmt.Sprintf(format, a...), nil)
+}
+
+// logFields implements fieldLogger. The fields are sent as a structured
+// data element with the FieldsID SD-ID.
+func (l *RemoteSyslogLogger) logFields(level Level, message string, pc uintptr, fields map[string]string) error {
+	return l.log(level, message, fields)
+}
+
+// Dropped returns how many messages were dropped because the buffer was
+// full.
+func (l *RemoteSyslogLogger) Dropped() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Flush tries to send the buffered messages, waiting until they are sent
+// or sending fails.
+func (l *RemoteSyslogLogger) Flush() error {
+	l.mu.Lock()
+	closed := l.closed
+	l.mu.Unlock()
+	if closed {
+		return ErrLoggerClosed
+	}
+	return l.send(l.requestFlush())
+}
+
+// Close tries to send the buffered messages, then stops the sender and
+// closes the connection.
+func (l *RemoteSyslogLogger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+	err := l.requestFlush()
+	close(l.quit)
+	<-l.done
+	return err
+}
+
+// requestFlush has the sender send the pending messages now.
+func (l *RemoteSyslogLogger) requestFlush() error {
+	reply := make(chan error, 1)
+	select {
+	case l.flushes <- reply:
+		return <-reply
+	case <-l.done:
+		return ErrLoggerClosed
+	}
+}
+
+func (l *RemoteSyslogLogger) log(level Level, message string, fields map[string]string) error {
+	msg := l.format(time.Now(), level, message, fields)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return l.send(ErrLoggerClosed)
+	}
+	l.queue(msg)
+	l.notify()
+	return nil
+}
+
+// logBatch implements batchLogger, queueing the records at once.
+func (l *RemoteSyslogLogger) logBatch(records []logRecord) error {
+	msgs := make([][]byte, len(records))
+	for i, r := range records {
+		msgs[i] = l.format(r.time, r.level, r.message, r.fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return l.send(ErrLoggerClosed)
+	}
+	for _, msg := range msgs {
+		l.queue(msg)
+	}
+	l.notify()
+	return nil
+}
+
+// queue adds msg to the pending messages, dropping the oldest if the buffer
+// is full. l.mu must be held.
+func (l *RemoteSyslogLogger) queue(msg []byte) {
+	if len(l.pending) >= l.cfg.BufferSize {
+		l.pending = l.pending[1:]
+		l.dropped++
+	}
+	l.pending = append(l.pending, msg)
+}
+
+// notify wakes the sender, unless it is already woken.
+func (l *RemoteSyslogLogger) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run is the sender. It sends the pending messages when woken, and tries
+// again once ReconnectInterval has passed if the collector could not be
+// reached.
+func (l *RemoteSyslogLogger) run() {
+	defer close(l.done)
+	retry := time.NewTimer(time.Hour)
+	retry.Stop()
+	defer retry.Stop()
+	for {
+		var err error
+		select {
+		case <-l.wake:
+			err = l.flush(false)
+		case <-retry.C:
+			err = l.flush(false)
+		case reply := <-l.flushes:
+			err = l.flush(true)
+			reply <- err
+			err = nil
+		case <-l.quit:
+			if l.conn != nil {
+				l.conn.Close()
+			}
+			return
+		}
+		l.send(err)
+		if l.conn == nil && l.hasPending() {
+			retry.Reset(time.Until(l.nextDial))
+		}
+	}
+}
+
+func (l *RemoteSyslogLogger) hasPending() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pending) > 0
+}
+
+// flush writes the pending messages, connecting first if needed. Unless
+// force is set, it does not try to connect again before ReconnectInterval
+// has passed since the last failed attempt. Only the sender calls it.
+func (l *RemoteSyslogLogger) flush(force bool) error {
+	if l.conn == nil {
+		if !force && time.Now().Before(l.nextDial) {
+			return nil
+		}
+		conn, err := l.dial()
+		if err != nil {
+			l.nextDial = time.Now().Add(l.cfg.ReconnectInterval)
+			return err
+		}
+		l.conn = conn
+	}
+	for {
+		l.mu.Lock()
+		if len(l.pending) == 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		msg := l.pending[0]
+		l.pending = l.pending[1:]
+		l.mu.Unlock()
+
+		l.conn.SetWriteDeadline(time.Now().Add(l.cfg.Timeout))
+		if _, err := l.conn.Write(l.frame(msg)); err != nil {
+			l.conn.Close()
+			l.conn = nil
+			l.nextDial = time.Now().Add(l.cfg.ReconnectInterval)
+			l.requeue(msg)
+			return err
+		}
+	}
+}
+
+// requeue puts back msg, which could not be sent, in front of the pending
+// messages, unless newer messages filled the buffer meanwhile.
+func (l *RemoteSyslogLogger) requeue(msg []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) >= l.cfg.BufferSize {
+		l.dropped++
+		return
+	}
+	l.pending = append([][]byte{msg}, l.pending...)
+}
+
+// frame adds the octet count in front of msg on stream connections.
+func (l *RemoteSyslogLogger) frame(msg []byte) []byte {
+	if l.cfg.Network == "udp" {
+		return msg
+	}
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}
+
+// format renders an RFC 5424 message.
+func (l *RemoteSyslogLogger) format(t time.Time, level Level, message string, fields map[string]string) []byte {
+	severity := 6
+	switch level {
+	case LevelDebug:
+		severity = 7
+	case LevelWarning:
+		severity = 4
+	case LevelError:
+		severity = 3
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "<%d>1 %s %s %s %s %s ",
+		int(l.cfg.Facility)*8+severity,
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(l.cfg.Hostname, 255),
+		syslogHeaderField(l.cfg.AppName, 48),
+		syslogHeaderField(l.cfg.ProcID, 128),
+		syslogHeaderField(l.cfg.MsgID, 32),
+	)
+
+	elements := l.cfg.StructuredData
+	if len(fields) > 0 {
+		elements = append(elements[:len(elements):len(elements)], SDElement{ID: l.cfg.FieldsID, Params: fields})
+	}
+	if len(elements) == 0 {
+		b.WriteByte('-')
+	}
+	for _, e := range elements {
+		writeSDElement(b, e)
+	}
+
+	if message != "" {
+		b.WriteByte(' ')
+		b.WriteString(message)
+	}
+	return []byte(b.String())
+}
+
+// syslogHeaderField makes s a valid header field: printable US-ASCII
+// without spaces, at most max characters, or "-" if empty.
+func syslogHeaderField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// sdName makes s a valid SD-ID or PARAM-NAME.
+func sdName(s string) string {
+	b := []byte(syslogHeaderField(s, 32))
+	for i, c := range b {
+		if c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func writeSDElement(b *strings.Builder, e SDElement) {
+	b.WriteByte('[')
+	b.WriteString(sdName(e.ID))
+	keys := make([]string, 0, len(e.Params))
+	for k := range e.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, ` %s="%s"`, sdName(k), sdValueEscaper.Replace(e.Params[k]))
+	}
+	b.WriteByte(']')
+}
@@ -0,0 +1,371 @@
+package sysvc
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readOctetCounted reads one "LEN SP MSG" frame.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	if _, err = io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+// serveSyslog accepts connections on ln and sends every frame on msgs.
+func serveSyslog(ln net.Listener, msgs chan<- string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				msg, err := readOctetCounted(r)
+				if err != nil {
+					return
+				}
+				msgs <- msg
+			}
+		}()
+	}
+}
+
+func receive(t *testing.T, msgs <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+var rfc5424 = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\S+) (\S+) (-|\[.*\])(?: (.*))?$`)
+
+func TestRemoteSyslogFormat(t *testing.T) {
+	l, err := NewRemoteSyslogLogger(RemoteSyslogConfig{
+		Network:        "tcp",
+		Address:        "127.0.0.1:514",
+		Facility:       FacilityLocal3,
+		Hostname:       "web 1",
+		AppName:        "api",
+		ProcID:         "42",
+		StructuredData: []SDElement{{ID: "origin@32473", Params: map[string]string{"software": "sysvc"}}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+	tests := []struct {
+		name    string
+		level   Level
+		message string
+		fields  map[string]string
+		want    string
+	}{
+		{"info", LevelInfo, "started", nil,
+			`<158>1 2024-01-02T03:04:05.000006Z web_1 api 42 - [origin@32473 software="sysvc"] started`},
+		{"error", LevelError, "failed", nil,
+			`<155>1 2024-01-02T03:04:05.000006Z web_1 api 42 - [origin@32473 software="sysvc"] failed`},
+		{"fields", LevelDebug, "query", map[string]string{"sql": `say "hi" [x]\`, "a=b": "1"},
+			`<159>1 2024-01-02T03:04:05.000006Z web_1 api 42 - [origin@32473 software="sysvc"][fields@32473 a_b="1" sql="say \"hi\" [x\]\\"] query`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(l.format(ts, tt.level, tt.message, tt.fields)); got != tt.want {
+				t.Errorf("format() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	l.cfg.StructuredData = nil
+	if got := string(l.format(ts, LevelWarning, "", nil)); got != "<156>1 2024-01-02T03:04:05.000006Z web_1 api 42 - -" {
+		t.Errorf("format() without message or structured data = %q", got)
+	}
+}
+
+func TestRemoteSyslogConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RemoteSyslogConfig
+	}{
+		{"network", RemoteSyslogConfig{Network: "unix", Address: "localhost:514"}},
+		{"address", RemoteSyslogConfig{Network: "udp", Address: "localhost"}},
+		{"facility", RemoteSyslogConfig{Network: "udp", Address: "localhost:514", Facility: 24}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRemoteSyslogLogger(tt.cfg, nil); err == nil {
+			t.Errorf("%s: NewRemoteSyslogLogger() succeeded, want error", tt.name)
+		}
+	}
+}
+
+func TestRemoteSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	l, err := NewRemoteSyslogLogger(RemoteSyslogConfig{Network: "udp", Address: pc.LocalAddr().String(), AppName: "api"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err = l.Warningf("disk %d%%", 90); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := rfc5424.FindStringSubmatch(string(buf[:n]))
+	if m == nil {
+		t.Fatalf("not an RFC 5424 message: %q", buf[:n])
+	}
+	if m[1] != "28" || m[4] != "api" || m[8] != "disk 90%" {
+		t.Errorf("PRI = %s, APP-NAME = %s, MSG = %q", m[1], m[4], m[8])
+	}
+}
+
+func TestRemoteSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 10)
+	go serveSyslog(ln, msgs)
+
+	l, err := NewRemoteSyslogLogger(RemoteSyslogConfig{Network: "tcp", Address: ln.Addr().String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for _, msg := range []string{"one", "two\nlines"} {
+		if err = l.Info(msg); err != nil {
+			t.Fatal(err)
+		}
+		// Octet counting keeps a newline inside a message.
+		if got := receive(t, msgs); !strings.HasSuffix(got, " "+msg) {
+			t.Errorf("received %q, want message %q", got, msg)
+		}
+	}
+}
+
+func TestRemoteSyslogTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 10)
+	go serveSyslog(ln, msgs)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	l, err := NewRemoteSyslogLogger(RemoteSyslogConfig{
+		Network:   "tls",
+		Address:   ln.Addr().String(),
+		TLSConfig: &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err = l.Error("over tls"); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, msgs); !strings.HasSuffix(got, " over tls") {
+		t.Errorf("received %q", got)
+	}
+}
+
+// flakyConn fails writes while down is set.
+type flakyConn struct {
+	net.Conn
+	down *int32
+}
+
+func (c flakyConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(c.down) != 0 {
+		return 0, errors.New("connection reset")
+	}
+	return c.Conn.Write(b)
+}
+
+func receiveError(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error sent")
+		return nil
+	}
+}
+
+func TestRemoteSyslogReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 10)
+	go serveSyslog(ln, msgs)
+
+	errs := make(chan error, 10)
+	l, err := NewRemoteSyslogLogger(RemoteSyslogConfig{
+		Network:           "tcp",
+		Address:           ln.Addr().String(),
+		BufferSize:        2,
+		ReconnectInterval: time.Hour,
+	}, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	down := int32(1)
+	dial := l.dial
+	l.dial = func() (net.Conn, error) {
+		if atomic.LoadInt32(&down) != 0 {
+			return nil, errors.New("connection refused")
+		}
+		conn, err := dial()
+		return flakyConn{conn, &down}, err
+	}
+
+	// Logging only queues. The first attempt fails and is reported; later
+	// messages are buffered without trying again until ReconnectInterval
+	// has passed.
+	if err = l.Info("one"); err != nil {
+		t.Fatalf("Info() = %v, want the message queued", err)
+	}
+	receiveError(t, errs)
+	for _, msg := range []string{"two", "three"} {
+		if err = l.Info(msg); err != nil {
+			t.Fatalf("Info(%q) = %v, want it buffered", msg, err)
+		}
+	}
+	if got := l.Dropped(); got != 1 {
+		t.Errorf("Dropped() = %d, want 1", got)
+	}
+
+	atomic.StoreInt32(&down, 0)
+	if err = l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("%d more errors sent, want no attempt before ReconnectInterval", len(errs))
+	}
+	for _, want := range []string{"two", "three"} {
+		if got := receive(t, msgs); !strings.HasSuffix(got, " "+want) {
+			t.Errorf("received %q, want %q", got, want)
+		}
+	}
+
+	// A failed write drops the connection and keeps the message.
+	atomic.StoreInt32(&down, 1)
+	if err = l.Info("four"); err != nil {
+		t.Fatalf("Info() = %v, want the message queued", err)
+	}
+	receiveError(t, errs)
+	atomic.StoreInt32(&down, 0)
+	if err = l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, msgs); !strings.HasSuffix(got, " four") {
+		t.Errorf("received %q, want four", got)
+	}
+
+	l.Close()
+	if err = l.Info("closed"); err != ErrLoggerClosed {
+		t.Errorf("Info() after Close = %v, want ErrLoggerClosed", err)
+	}
+}
+
+func TestRemoteSyslogDoesNotBlock(t *testing.T) {
+	l, err := NewRemoteSyslogLogger(RemoteSyslogConfig{Network: "tcp", Address: "127.0.0.1:514"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The collector takes as long as the test to answer.
+	release := make(chan struct{})
+	defer l.Close()
+	defer close(release)
+	l.dial = func() (net.Conn, error) {
+		<-release
+		return nil, errors.New("connection refused")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			l.Infof("message %d", i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Info() blocked on connecting")
+	}
+}
@@ -0,0 +1,385 @@
+package sysvc
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Values of the LogRotate option.
+const (
+	// logRotateInternal makes the program rotate its own output files.
+	logRotateInternal = "internal"
+	// logRotateExternal makes Install configure logrotate or newsyslog.
+	logRotateExternal = "external"
+)
+
+// logRotate returns the LogRotate option, checking its value.
+func (c *Config) logRotate() (string, error) {
+	v := c.Option.string(optionLogRotate, "")
+	switch v {
+	case "", logRotateInternal, logRotateExternal:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown LogRotate option %q", v)
+}
+
+// rotateConfig returns the RotateConfig set by the LogMax* and LogCompress
+// options.
+func (c *Config) rotateConfig() RotateConfig {
+	return RotateConfig{
+		MaxSize:    int64(c.Option.int(optionLogMaxSize, optionLogMaxSizeDefault)) << 20,
+		MaxAge:     time.Duration(c.Option.int(optionLogMaxAge, optionLogMaxAgeDefault)) * 24 * time.Hour,
+		MaxBackups: c.Option.int(optionLogMaxBackups, optionLogMaxBackupsDefault),
+		Compress:   c.Option.bool(optionLogCompress, optionLogCompressDefault),
+	}
+}
+
+// RotateConfig controls when a RotatingFile starts a new segment and what is
+// kept of the old ones.
+type RotateConfig struct {
+	// MaxSize is the size in bytes after which the file is rotated; zero
+	// means no limit.
+	MaxSize int64
+	// MaxAge is how long after a segment was started the file is rotated;
+	// zero means no limit.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated segments are kept, named path.1 for
+	// the newest to path.MaxBackups for the oldest. With zero, the old
+	// segment is removed.
+	MaxBackups int
+	// Compress gzips rotated segments, adding .gz to their names.
+	Compress bool
+}
+
+// RotatingFile is a log file that is rotated as it is written to. It is safe
+// for concurrent use.
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+
+	// onOpen is called with every file opened for path, the first one
+	// included.
+	onOpen func(*os.File) error
+	now    func() time.Time
+	// stopHangup, if set, ends reopenOnHangup. Close calls it.
+	stopHangup func()
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	started time.Time
+	// compressing is the compression of the last rotated segment, which
+	// has to finish before the segments are renamed again.
+	compressing sync.WaitGroup
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed.
+func OpenRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, cfg: cfg, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file at r.path. r.mu must be held or r not yet shared.
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if r.onOpen != nil {
+		if err = r.onOpen(f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	r.f, r.size, r.started = f, fi.Size(), r.now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p would take it over
+// MaxSize or the segment is older than MaxAge.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due reports whether writing n more bytes needs a new segment. An empty
+// segment is never rotated.
+func (r *RotatingFile) due(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.cfg.MaxSize > 0 && r.size+n > r.cfg.MaxSize {
+		return true
+	}
+	return r.cfg.MaxAge > 0 && r.now().Sub(r.started) >= r.cfg.MaxAge
+}
+
+// Rotate starts a new segment.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	return r.rotate()
+}
+
+// check rotates the file if it is due, taking its size from the file rather
+// than from what was written through r, as other processes or descriptors
+// may write to it.
+func (r *RotatingFile) check() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	fi, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	r.size = fi.Size()
+	if !r.due(0) {
+		return nil
+	}
+	return r.rotate()
+}
+
+// Reopen closes the file and opens path again, for when the file was moved
+// away by another program.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	r.f.Close()
+	r.f = nil
+	return r.open()
+}
+
+// reopenOnHangup reopens the file whenever the process receives SIGHUP, as
+// logrotate and newsyslog send after moving it away, until r is closed. The
+// errors of reopening are sent on errs. It must be called before r is
+// shared.
+func (r *RotatingFile) reopenOnHangup(errs *errorSink) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+				errs.send(r.Reopen())
+			}
+		}
+	}()
+	var once sync.Once
+	r.stopHangup = func() {
+		once.Do(func() {
+			signal.Stop(hup)
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// Close closes the file, waiting for a rotated segment to be compressed.
+func (r *RotatingFile) Close() error {
+	// The handler takes r.mu to reopen the file, so it is stopped first.
+	if r.stopHangup != nil {
+		r.stopHangup()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compressing.Wait()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// rotate shifts the rotated segments up by one, dropping the oldest, moves
+// the file to path.1 and opens a new one. r.mu must be held.
+func (r *RotatingFile) rotate() error {
+	r.compressing.Wait()
+	r.f.Close()
+	r.f = nil
+
+	if r.cfg.MaxBackups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	for _, ext := range []string{"", ".gz"} {
+		os.Remove(r.backupPath(r.cfg.MaxBackups) + ext)
+	}
+	for n := r.cfg.MaxBackups - 1; n > 0; n-- {
+		for _, ext := range []string{"", ".gz"} {
+			err := os.Rename(r.backupPath(n)+ext, r.backupPath(n+1)+ext)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(r.path, r.backupPath(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.cfg.Compress {
+		r.compressing.Add(1)
+		go func(path string) {
+			defer r.compressing.Done()
+			compressFile(path)
+		}(r.backupPath(1))
+	}
+	return nil
+}
+
+func (r *RotatingFile) backupPath(n int) string {
+	return r.path + "." + strconv.Itoa(n)
+}
+
+// compressFile replaces path with path.gz.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// FileLogger writes one line per message, starting with the time and the
+// level, to a writer such as a RotatingFile.
+type FileLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+	*errorSink
+}
+
+// NewFileLogger returns a Logger writing to w. If errs is non-nil, errors are
+// also sent on it.
+func NewFileLogger(w io.Writer, errs chan<- error) *FileLogger {
+	return &FileLogger{w: w, errorSink: newErrorSink(errs)}
+}
+
+func (l *FileLogger) Error(v ...interface{}) error {
+	return l.write(LevelError, fmt.Sprint(v...))
+}
+func (l *FileLogger) Warning(v ...interface{}) error {
+	return l.write(LevelWarning, fmt.Sprint(v...))
+}
+func (l *FileLogger) Info(v ...interface{}) error {
+	return l.write(LevelInfo, fmt.Sprint(v...))
+}
+func (l *FileLogger) Debug(v ...interface{}) error {
+	return l.write(LevelDebug, fmt.Sprint(v...))
+}
+func (l *FileLogger) Errorf(format string, a ...interface{}) error {
+	return l.write(LevelError, fmt.Sprintf(format, a...))
+}
+func (l *FileLogger) Warningf(format string, a ...interface{}) error {
+	return l.write(LevelWarning, fmt.Sprintf(format, a...))
+}
+func (l *FileLogger) Infof(format string, a ...interface{}) error {
+	return l.write(LevelInfo, fmt.Sprintf(format, a...))
+}
+func (l *FileLogger) Debugf(format string, a ...interface{}) error {
+	return l.write(LevelDebug, fmt.Sprintf(format, a...))
+}
+
+// fileLoggerTimeLayout is the layout of the time a FileLogger line starts
+// with.
+const fileLoggerTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func fileLoggerLine(t time.Time, level Level, message string) string {
+	return t.Format(fileLoggerTimeLayout) + " " + level.String() + " " + message + "\n"
+}
+
+func (l *FileLogger) write(level Level, message string) error {
+	return l.writeString(fileLoggerLine(time.Now(), level, message))
+}
+
+// logBatch implements batchLogger with a single write.
+func (l *FileLogger) logBatch(records []logRecord) error {
+	b := &strings.Builder{}
+	for _, r := range records {
+		b.WriteString(fileLoggerLine(r.time, r.level, r.text()))
+	}
+	return l.writeString(b.String())
+}
+
+// Close closes the writer if it is an io.Closer.
+func (l *FileLogger) Close() error {
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (l *FileLogger) writeString(s string) error {
+	l.mu.Lock()
+	_, err := io.WriteString(l.w, s)
+	l.mu.Unlock()
+	return l.send(err)
+}
@@ -0,0 +1,168 @@
+package sysvc
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      RotateConfig
+		want     map[string]string
+		notExist []string
+	}{
+		{
+			name: "keeps generations",
+			cfg:  RotateConfig{MaxSize: 4, MaxBackups: 2},
+			want: map[string]string{
+				"svc.log":   "ddd\n",
+				"svc.log.1": "ccc\n",
+				"svc.log.2": "bbb\n",
+			},
+			notExist: []string{"svc.log.3"},
+		},
+		{
+			name: "compresses",
+			cfg:  RotateConfig{MaxSize: 4, MaxBackups: 2, Compress: true},
+			want: map[string]string{
+				"svc.log":      "ddd\n",
+				"svc.log.1.gz": "ccc\n",
+				"svc.log.2.gz": "bbb\n",
+			},
+			notExist: []string{"svc.log.1", "svc.log.3.gz"},
+		},
+		{
+			name:     "no backups",
+			cfg:      RotateConfig{MaxSize: 4},
+			want:     map[string]string{"svc.log": "ddd\n"},
+			notExist: []string{"svc.log.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "svc.log")
+			r, err := OpenRotatingFile(path, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range []string{"aaa\n", "bbb\n", "ccc\n", "ddd\n"} {
+				if _, err = r.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := readFile(t, filepath.Join(dir, name)); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			for _, name := range tt.notExist {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("%s exists", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svc.log")
+	r, err := OpenRotatingFile(path, RotateConfig{MaxAge: time.Hour, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Write([]byte("old\n"))
+	now = now.Add(59 * time.Minute)
+	r.Write([]byte("still\n"))
+	now = now.Add(time.Hour)
+	r.Write([]byte("new\n"))
+
+	if got := readFile(t, path+".1"); got != "old\nstill\n" {
+		t.Errorf("svc.log.1 = %q", got)
+	}
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("svc.log = %q", got)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svc.log")
+	r, err := OpenRotatingFile(path, RotateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("before\n"))
+	if err = os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("after\n"))
+
+	if got := readFile(t, path+".moved"); got != "before\n" {
+		t.Errorf("moved = %q", got)
+	}
+	if got := readFile(t, path); got != "after\n" {
+		t.Errorf("svc.log = %q", got)
+	}
+}
+
+func TestFileLogger(t *testing.T) {
+	b := &strings.Builder{}
+	l := NewFileLogger(b, nil)
+	l.Infof("started %d", 1)
+	l.Error("failed")
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []string{"info started 1", "error failed"}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %q", lines)
+	}
+	parse := timestampPrefixParser(fileLoggerTimeLayout, time.Local)
+	for i, line := range lines {
+		ts, msg := parse(line)
+		if ts.IsZero() || msg != want[i] {
+			t.Errorf("line %d = %q, want time and %q", i, line, want[i])
+		}
+	}
+}
@@ -0,0 +1,237 @@
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package sysvc
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// captureFDs are the descriptors the output files of each stream are put on.
+var captureFDs = map[LogStream]int{LogStreamStdout: 1, LogStreamStderr: 2}
+
+// captureCheckInterval is how often captured output files are checked for
+// rotation.
+var captureCheckInterval = 10 * time.Second
+
+// captureOutput makes files the stdout and stderr of the program, replacing
+// the descriptors the service manager opened. The program writes straight
+// to the files, so output written just before a crash is not lost. The files
+// are rotated as cfg says and reopened on SIGHUP, and the errors of doing so
+// are sent on errs: writing them to stderr would write them to the file.
+// stop ends both; the descriptors stay pointed at the last files.
+func captureOutput(files []logFile, cfg RotateConfig, errs *errorSink) (stop func(), err error) {
+	var rfs []*RotatingFile
+	closeAll := func() {
+		for _, rf := range rfs {
+			rf.Close()
+		}
+	}
+	for _, f := range files {
+		fd, ok := captureFDs[f.stream]
+		if !ok {
+			continue
+		}
+		rf := &RotatingFile{
+			path: f.path,
+			cfg:  cfg,
+			now:  time.Now,
+			onOpen: func(f *os.File) error {
+				return unix.Dup2(int(f.Fd()), fd)
+			},
+		}
+		if err = rf.open(); err != nil {
+			closeAll()
+			return nil, err
+		}
+		rfs = append(rfs, rf)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var tick <-chan time.Time
+		if cfg.MaxSize > 0 || cfg.MaxAge > 0 {
+			t := time.NewTicker(captureCheckInterval)
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+				for _, rf := range rfs {
+					errs.send(rf.Reopen())
+				}
+			case <-tick:
+				for _, rf := range rfs {
+					errs.send(rf.check())
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		close(done)
+		wg.Wait()
+		closeAll()
+	}, nil
+}
+
+// runServiceOutput is runService for services whose stdout and stderr are
+// written to files. With the LogRotate option set to "internal" the program
+// rotates the files itself while it runs. With "external" and a pidFile, the
+// PID is written to pidFile for the external rotator, which sends SIGHUP to
+// have the files reopened. Errors rotating or reopening the files are sent
+// on the errs channel the service's Logger was opened with.
+func runServiceOutput(s Service, i Interface, c *Config, files []logFile, pidFile string) error {
+	rotate, err := c.logRotate()
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 && !c.system().Interactive() {
+		var stop func()
+		switch {
+		case rotate == logRotateInternal:
+			stop, err = captureOutput(files, c.rotateConfig(), c.loggerList().errorSink())
+		case rotate == logRotateExternal && pidFile != "":
+			if err = os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+				return err
+			}
+			defer os.Remove(pidFile)
+			stop, err = captureOutput(files, RotateConfig{}, c.loggerList().errorSink())
+		}
+		if err != nil {
+			return err
+		}
+		if stop != nil {
+			defer stop()
+		}
+	}
+	return runService(s, i, c)
+}
+
+func logFilePaths(files []logFile) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths
+}
+
+// logrotateDir is where logrotate reads the configuration of packages from.
+var logrotateDir = "/etc/logrotate.d"
+
+// installLogrotate writes a logrotate configuration for files if the
+// LogRotate option is "external".
+func (c *Config) installLogrotate(files []logFile) error {
+	rotate, err := c.logRotate()
+	if err != nil || rotate != logRotateExternal || len(files) == 0 {
+		return err
+	}
+	conf := logrotateConfig(logFilePaths(files), c.rotateConfig())
+	return os.WriteFile(filepath.Join(logrotateDir, c.Name), []byte(conf), 0644)
+}
+
+// uninstallLogrotate removes the configuration written by installLogrotate.
+func (c *Config) uninstallLogrotate() error {
+	err := os.Remove(filepath.Join(logrotateDir, c.Name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// logrotateConfig renders a logrotate configuration for paths. The files are
+// copied and truncated, as the program keeps writing to the descriptors it
+// was started with. logrotate only rotates by time in whole periods, so
+// MaxAge is rounded down to a day, week, month or year.
+func logrotateConfig(paths []string, cfg RotateConfig) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s {\n", strings.Join(paths, " "))
+	if cfg.MaxAge > 0 {
+		days := cfg.MaxAge / (24 * time.Hour)
+		switch {
+		case days < 7:
+			b.WriteString("\tdaily\n")
+		case days < 30:
+			b.WriteString("\tweekly\n")
+		case days < 365:
+			b.WriteString("\tmonthly\n")
+		default:
+			b.WriteString("\tyearly\n")
+		}
+		if cfg.MaxSize > 0 {
+			fmt.Fprintf(b, "\tmaxsize %dk\n", cfg.MaxSize>>10)
+		}
+	} else if cfg.MaxSize > 0 {
+		fmt.Fprintf(b, "\tsize %dk\n", cfg.MaxSize>>10)
+	}
+	fmt.Fprintf(b, "\trotate %d\n", cfg.MaxBackups)
+	if cfg.Compress {
+		b.WriteString("\tcompress\n")
+	}
+	b.WriteString("\tmissingok\n\tnotifempty\n\tcopytruncate\n}\n")
+	return b.String()
+}
+
+// newsyslogDir is where newsyslog reads additional configuration from.
+var newsyslogDir = "/etc/newsyslog.d"
+
+// installNewsyslog writes a newsyslog configuration for files if the
+// LogRotate option is "external".
+func (c *Config) installNewsyslog(files []logFile, pidFile string) error {
+	rotate, err := c.logRotate()
+	if err != nil || rotate != logRotateExternal || len(files) == 0 {
+		return err
+	}
+	conf := newsyslogConfig(logFilePaths(files), pidFile, c.rotateConfig())
+	return os.WriteFile(filepath.Join(newsyslogDir, c.Name+".conf"), []byte(conf), 0644)
+}
+
+// uninstallNewsyslog removes the configuration written by installNewsyslog.
+func (c *Config) uninstallNewsyslog() error {
+	err := os.Remove(filepath.Join(newsyslogDir, c.Name+".conf"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// newsyslogConfig renders newsyslog.conf lines for paths. newsyslog cannot
+// truncate a file in place, so it sends SIGHUP to the PID in pidFile, on
+// which the program reopens its output.
+func newsyslogConfig(paths []string, pidFile string, cfg RotateConfig) string {
+	size, when, flags := "*", "*", "-"
+	if cfg.MaxSize > 0 {
+		size = strconv.FormatInt(cfg.MaxSize>>10, 10)
+	}
+	if cfg.MaxAge > 0 {
+		when = strconv.FormatInt(int64(cfg.MaxAge/time.Hour), 10)
+	}
+	if cfg.Compress {
+		flags = "Z"
+	}
+	b := &strings.Builder{}
+	b.WriteString("# logfilename\tmode\tcount\tsize\twhen\tflags\tpid_file\tsig_num\n")
+	for _, p := range paths {
+		fmt.Fprintf(b, "%s\t644\t%d\t%s\t%s\t%s\t%s\t%d\n", p, cfg.MaxBackups, size, when, flags, pidFile, syscall.SIGHUP)
+	}
+	return b.String()
+}
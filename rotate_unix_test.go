@@ -0,0 +1,175 @@
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package sysvc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	dir := t.TempDir()
+	// Capture onto a spare descriptor rather than the test's stdout.
+	spare, err := os.CreateTemp(dir, "spare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spare.Close()
+
+	oldFDs, oldInterval := captureFDs, captureCheckInterval
+	captureFDs = map[LogStream]int{LogStreamStdout: int(spare.Fd())}
+	captureCheckInterval = 10 * time.Millisecond
+	defer func() { captureFDs, captureCheckInterval = oldFDs, oldInterval }()
+
+	path := filepath.Join(dir, "svc.log")
+	files := []logFile{
+		{path: path, stream: LogStreamStdout},
+		{path: filepath.Join(dir, "svc.err"), stream: LogStreamStderr},
+	}
+	waitFor := func(path string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not created", path)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	stop, err := captureOutput(files, RotateConfig{MaxSize: 4, MaxBackups: 1}, newErrorSink(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spare.Write([]byte("first\n"))
+	waitFor(path + ".1")
+	stop()
+
+	// Without rotation, the file is reopened on SIGHUP after being moved
+	// away.
+	stop, err = captureOutput(files, RotateConfig{}, newErrorSink(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spare.Write([]byte("second\n"))
+	if err = os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	waitFor(path)
+	spare.Write([]byte("third\n"))
+	stop()
+
+	for name, want := range map[string]string{
+		"svc.log.1":     "first\n",
+		"svc.log.moved": "second\n",
+		"svc.log":       "third\n",
+	} {
+		if got := readFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "svc.err")); !os.IsNotExist(err) {
+		t.Error("stderr captured without a descriptor")
+	}
+}
+
+func TestRotatingFileReopenOnHangup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svc.log")
+	r, err := OpenRotatingFile(path, RotateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	r.reopenOnHangup(newErrorSink(errs))
+	defer r.Close()
+
+	r.Write([]byte("first\n"))
+	if err = os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not reopened", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Write([]byte("second\n"))
+
+	for name, want := range map[string]string{
+		"svc.log.moved": "first\n",
+		"svc.log":       "second\n",
+	} {
+		if got := readFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// Failing to reopen is reported on errs, not written to the file.
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	select {
+	case err = <-errs:
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("error = %v, want it to name %s", err, path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reopen error not sent on errs")
+	}
+}
+
+func Test_logrotateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RotateConfig
+		want string
+	}{
+		{
+			name: "size",
+			cfg:  RotateConfig{MaxSize: 100 << 20, MaxBackups: 7, Compress: true},
+			want: "/var/log/svc.log /var/log/svc.err {\n\tsize 102400k\n\trotate 7\n\tcompress\n\tmissingok\n\tnotifempty\n\tcopytruncate\n}\n",
+		},
+		{
+			name: "age and size",
+			cfg:  RotateConfig{MaxSize: 1 << 20, MaxAge: 7 * 24 * time.Hour, MaxBackups: 2},
+			want: "/var/log/svc.log /var/log/svc.err {\n\tweekly\n\tmaxsize 1024k\n\trotate 2\n\tmissingok\n\tnotifempty\n\tcopytruncate\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logrotateConfig([]string{"/var/log/svc.log", "/var/log/svc.err"}, tt.cfg)
+			if got != tt.want {
+				t.Errorf("logrotateConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newsyslogConfig(t *testing.T) {
+	got := newsyslogConfig([]string{"/var/log/svc.out.log"}, "/var/run/svc.pid",
+		RotateConfig{MaxSize: 1 << 20, MaxAge: 2 * 24 * time.Hour, MaxBackups: 3, Compress: true})
+	want := "# logfilename\tmode\tcount\tsize\twhen\tflags\tpid_file\tsig_num\n" +
+		"/var/log/svc.out.log\t644\t3\t1024\t48\tZ\t/var/run/svc.pid\t1\n"
+	if got != want {
+		t.Errorf("newsyslogConfig() = %q, want %q", got, want)
+	}
+}
@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 
 // Package sysvc provides a simple way to create a system service.
-// Currently supports Windows, Linux/(systemd | Upstart | SysV | OpenRC), and OSX/Launchd.
+// Currently supports Windows, Linux/(systemd | Upstart | SysV | OpenRC | runit | s6 | supervisord | dinit), and OSX/Launchd.
 //
 // Windows controls services by setting up callbacks that is non-trivial. This
 // is very different then other systems. This package provides the same API
@@ -62,8 +62,11 @@
 package sysvc // import "github.com/iyear/sysvc"
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"sync"
 )
 
 const (
@@ -91,14 +94,58 @@ const (
 
 	optionSuccessExitStatus = "SuccessExitStatus"
 
+	optionRemainAfterExit        = "RemainAfterExit"
+	optionRemainAfterExitDefault = false
+
+	optionSystemdDBus        = "SystemdDBus"
+	optionSystemdDBusDefault = false
+
 	optionSystemdScript = "SystemdScript"
 	optionSysvScript    = "SysvScript"
 	optionRCSScript     = "RCSScript"
 	optionUpstartScript = "UpstartScript"
 	optionLaunchdConfig = "LaunchdConfig"
 	optionOpenRCScript  = "OpenRCScript"
+	optionRunitScript   = "RunitScript"
+	optionS6Script      = "S6Script"
+	optionDinitConfig   = "DinitConfig"
+
+	optionSupervisordConfig           = "SupervisordConfig"
+	optionSupervisordConfigFile       = "SupervisordConfigFile"
+	optionSupervisordIncludeDirectory = "SupervisordIncludeDirectory"
+	optionStopSignal                  = "StopSignal"
+
+	optionSuperviseStateDirectory = "SuperviseStateDirectory"
+
+	optionReapChildren        = "ReapChildren"
+	optionReapChildrenDefault = true
+
+	optionS6ScanDirectory = "S6ScanDirectory"
+	optionS6RCSource      = "S6RCSource"
+	optionS6RCBundle      = "S6RCBundle"
 
 	optionLogDirectory = "LogDirectory"
+
+	optionLogRotate            = "LogRotate"
+	optionLogMaxSize           = "LogMaxSize"
+	optionLogMaxSizeDefault    = 100
+	optionLogMaxAge            = "LogMaxAge"
+	optionLogMaxAgeDefault     = 0
+	optionLogMaxBackups        = "LogMaxBackups"
+	optionLogMaxBackupsDefault = 7
+	optionLogCompress          = "LogCompress"
+	optionLogCompressDefault   = true
+
+	optionLogAsync        = "LogAsync"
+	optionLogAsyncDefault = false
+	optionLogQueueSize    = "LogQueueSize"
+
+	optionLogLevel          = "LogLevel"
+	optionLogFile           = "LogFile"
+	optionLogFileLevel      = "LogFileLevel"
+	optionLogConsole        = "LogConsole"
+	optionLogConsoleDefault = false
+	optionLogConsoleLevel   = "LogConsoleLevel"
 )
 
 // Status represents service status as an byte value
@@ -141,11 +188,41 @@ type Config struct {
 	Option KeyValue
 
 	EnvVars map[string]string
+
+	// Set by Manager.New; nil means the package-level defaults.
+	sys    System
+	runner CommandRunner
+	logger Logger
+
+	// loggers are the Loggers Close closes.
+	loggers *loggerList
+}
+
+// system returns the System the service was created with.
+func (c *Config) system() System {
+	if c.sys != nil {
+		return c.sys
+	}
+	return ChosenSystem()
+}
+
+// consoleLogger returns the Logger to use when running interactively.
+func (c *Config) consoleLogger() Logger {
+	if c.logger != nil {
+		return c.logger
+	}
+	return ConsoleLogger
 }
 
 var (
+	// systemMu guards system, systemRegistry, registrations and
+	// chosenName.
+	systemMu       sync.RWMutex
 	system         System
 	systemRegistry []System
+	// chosenName is the system named to ChooseSystemByName, kept when the
+	// registry changes.
+	chosenName string
 )
 
 var (
@@ -157,6 +234,9 @@ var (
 	ErrNotInstalled = errors.New("the service is not installed")
 	// ErrNoConfigPath is returned when the service does not have a configuration path.
 	ErrNoConfigPath = errors.New("the service does not have a configuration path")
+	// ErrUnsupportedInContainer is returned when the program runs as PID 1 in a
+	// container and there is no service manager to act on.
+	ErrUnsupportedInContainer = errors.New("not supported when running as PID 1 in a container")
 )
 
 // New creates a new service based on a service interface and configuration.
@@ -164,19 +244,92 @@ func New(i Interface, c *Config) (Service, error) {
 	if len(c.Name) == 0 {
 		return nil, ErrNameFieldRequired
 	}
-	if system == nil {
+	sys := ChosenSystem()
+	if sys == nil {
 		return nil, ErrNoServiceSystemDetected
 	}
-	return system.New(i, c)
+	c.loggerList()
+	return sys.New(i, c)
+}
+
+// NewWithSystem creates a new service managed by sys rather than the chosen
+// system.
+func NewWithSystem(sys System, i Interface, c *Config) (Service, error) {
+	m := &Manager{System: sys}
+	return m.New(i, c)
+}
+
+// CommandRunner runs the command line tools of a service manager, such as
+// systemctl. It returns the exit code and standard output of the command.
+//
+// Logs reads from commands such as journalctl through the CommandRunner too.
+// To follow a log, the CommandRunner must also have a method
+//
+//	Stream(ctx context.Context, command string, arguments ...string) (io.ReadCloser, error)
+//
+// returning the standard output of the running command. Otherwise Logs gets
+// the output from Run once the command has exited.
+type CommandRunner interface {
+	Run(command string, arguments ...string) (int, string, error)
+}
+
+// Manager creates services bound to its own System, CommandRunner and
+// Logger instead of the package-level ones, so services of different
+// systems can be used side by side.
+type Manager struct {
+	// System manages the services. If nil, the chosen system is used.
+	System System
+	// Runner runs service manager commands. If nil, they are executed.
+	Runner CommandRunner
+	// Logger is returned by Service.Logger when running interactively.
+	// If nil, ConsoleLogger is used.
+	Logger Logger
+}
+
+// New creates a new service. c is copied, so it may be reused.
+func (m *Manager) New(i Interface, c *Config) (Service, error) {
+	if len(c.Name) == 0 {
+		return nil, ErrNameFieldRequired
+	}
+	sys := m.System
+	if sys == nil {
+		sys = ChosenSystem()
+	}
+	if sys == nil {
+		return nil, ErrNoServiceSystemDetected
+	}
+	cc := *c
+	cc.sys = sys
+	cc.runner = m.Runner
+	cc.logger = m.Logger
+	cc.loggers = &loggerList{}
+	return sys.New(i, &cc)
 }
 
 // KeyValue provides a list of system specific options.
 //
+//   - All platforms
+//
+//   - LogAsync      bool   (false)            - Write to the system logger from a goroutine; Run flushes it
+//     after Stop returns.
+//
+//   - LogQueueSize  int    (1024)             - Messages LogAsync keeps waiting before dropping new ones.
+//
+//   - LogLevel      string (debug)            - Lowest level sent to the system logger (debug, info, warning, error).
+//
+//   - LogFile       string ()                 - Also log to this file, rotated as the LogMax* and LogCompress options say.
+//
+//   - LogFileLevel  string (debug)            - Lowest level written to LogFile.
+//
+//   - LogConsole    bool   (false)            - Also log to the console when stderr is a terminal.
+//
+//   - LogConsoleLevel string (debug)          - Lowest level written to the console.
+//
 //   - OS X
 //
 //   - LaunchdConfig string ()                 - Use custom launchd config.
 //
-//   - KeepAlive     bool   (true)             - Prevent the system from stopping the service automatically.
+//   - KeepAlive     bool   (true)             - Prevent the system from stopping the service automatically. False for tasks.
 //
 //   - RunAtLoad     bool   (false)            - Run the service after its job has been loaded.
 //
@@ -192,12 +345,22 @@ func New(i Interface, c *Config) (Service, error) {
 //
 //   - SystemdScript string ()                 - Use custom systemd script.
 //
+//   - SystemdDBus   bool   (false)            - Control systemd over D-Bus rather than with systemctl, which is still used if the bus cannot be reached.
+//     Jobs time out after 5 minutes. The connection is kept until the service or Controller is closed.
+//
 //   - UpstartScript string ()                 - Use custom upstart script.
 //
 //   - SysvScript    string ()                 - Use custom sysv script.
 //
 //   - OpenRCScript  string ()                 - Use custom OpenRC script.
 //
+//   - RunitScript   string ()                 - Use custom runit run script.
+//
+//   - S6Script      string ()                 - Use custom s6 run script.
+//     No notification-fd is written for a custom script, so s6 treats the service as ready once it is up.
+//
+//   - DinitConfig   string ()                 - Use custom dinit service description.
+//
 //   - RunWait       func() (wait for SIGNAL)  - Do not install signal but wait for this function to return.
 //
 //   - ReloadSignal  string () [USR1, ...]     - Signal to send on reload.
@@ -207,6 +370,7 @@ func New(i Interface, c *Config) (Service, error) {
 //   - LogOutput     bool   (false)            - Redirect StdErr & StandardOutPath to files.
 //
 //   - Restart       string (always)           - How shall service be restarted.
+//     Defaults to on-failure for services created with NewTask.
 //
 //   - RestartSec    int    (120)              - Delay seconds before restarting the service.
 //
@@ -215,11 +379,52 @@ func New(i Interface, c *Config) (Service, error) {
 //
 //   - LogDirectory string(/var/log)           - The path to the log files directory
 //
+//   - LogRotate     string ()                 - Rotation of the stdout and stderr files of sysv, rcs, upstart
+//     and launchd services. "internal": the program rotates them while it runs. "external": Install
+//     configures logrotate (Linux) or newsyslog (OS X).
+//
+//   - LogMaxSize    int    (100)              - Size in MB after which the files are rotated.
+//
+//   - LogMaxAge     int    (0)                - Days after which the files are rotated; 0 disables it.
+//
+//   - LogMaxBackups int    (7)                - Number of rotated files kept.
+//
+//   - LogCompress   bool   (true)             - Gzip rotated files.
+//
 //   - Linux (systemd)
 //
 //   - LimitNOFILE   int    (-1)               - Maximum open files (ulimit -n)
 //     (https://serverfault.com/questions/628610/increasing-nproc-for-processes-launched-by-systemd-on-centos-7)
 //
+//   - RemainAfterExit bool (false)            - Consider a Task active after it has exited.
+//
+//   - Linux (s6)
+//
+//   - S6ScanDirectory string (/run/service)   - Directory scanned by s6-svscan.
+//
+//   - S6RCSource    string ()                 - Register with this s6-rc source database instead of s6-svscan.
+//
+//   - S6RCBundle    string (default)          - s6-rc bundle the service is added to.
+//
+//   - Linux (supervisord)
+//
+//   - SupervisordConfig string ()             - Use custom [program:x] config.
+//
+//   - SupervisordConfigFile string ()         - supervisord.conf passed to supervisorctl with -c.
+//
+//   - SupervisordIncludeDirectory string (/etc/supervisor/conf.d) - Directory the program file is written to.
+//
+//   - StopSignal    string (TERM)             - Signal sent to stop the program.
+//
+//   - Linux (sysvc-supervise)
+//
+//   - SuperviseStateDirectory string (/var/lib/sysvc) - Directory holding the definition, PID files and logs.
+//
+//   - Linux (container)
+//
+//   - ReapChildren  bool   (true)             - Reap orphaned children when running as PID 1.
+//     This also collects children started with os/exec, so disable it if the program waits on its own children.
+//
 //   - Windows
 //
 //   - DelayedAutoStart  bool (false)                - After booting, start this service after some delay.
@@ -296,22 +501,43 @@ func (kv KeyValue) funcSingle(name string, defaultValue func()) func() {
 
 // Platform returns a description of the system service.
 func Platform() string {
-	if system == nil {
+	sys := ChosenSystem()
+	if sys == nil {
 		return ""
 	}
-	return system.String()
+	return sys.String()
 }
 
 // Interactive returns false if running under the OS service manager
 // and true otherwise.
 func Interactive() bool {
-	if system == nil {
+	sys := ChosenSystem()
+	if sys == nil {
 		return true
 	}
-	return system.Interactive()
+	return sys.Interactive()
 }
 
+// InteractiveReason describes why Interactive returns what it does, for
+// example "NOTIFY_SOCKET is set by systemd". It is empty if the system does
+// not provide a reason.
+func InteractiveReason() string {
+	if r, ok := ChosenSystem().(interface{ InteractiveReason() string }); ok {
+		return r.InteractiveReason()
+	}
+	return ""
+}
+
+// newSystem returns the system to use. systemMu must be held.
 func newSystem() System {
+	for _, name := range []string{chosenName, os.Getenv(envSystem)} {
+		if name == "" {
+			continue
+		}
+		if sys := findSystem(name); sys != nil {
+			return sys
+		}
+	}
 	for _, choice := range systemRegistry {
 		if choice.Detect() == false {
 			continue
@@ -325,19 +551,46 @@ func newSystem() System {
 // SystemServices are considered in the order they are suggested.
 // Calling this may change what Interactive and Platform return.
 func ChooseSystem(a ...System) {
-	systemRegistry = a
-	system = newSystem()
+	systemMu.Lock()
+	defer systemMu.Unlock()
+	registrations = nil
+	chosenName = ""
+	for _, sys := range a {
+		addRegistration(sys, 0)
+	}
+	updateRegistry()
+}
+
+// ChooseSystemByName chooses the registered system with the given name,
+// such as "linux-openrc", whether or not it detects itself. The
+// SYSVC_SYSTEM environment variable does the same when the package is
+// initialized. The choice holds when systems are registered or
+// unregistered later, for as long as the system is registered.
+func ChooseSystemByName(name string) error {
+	systemMu.Lock()
+	defer systemMu.Unlock()
+	sys := findSystem(name)
+	if sys == nil {
+		return unknownSystemError(name)
+	}
+	system = sys
+	chosenName = name
+	return nil
 }
 
 // ChosenSystem returns the system that service will use.
 func ChosenSystem() System {
+	systemMu.RLock()
+	defer systemMu.RUnlock()
 	return system
 }
 
 // AvailableSystems returns the list of system services considered
 // when choosing the system service.
 func AvailableSystems() []System {
-	return systemRegistry
+	systemMu.RLock()
+	defer systemMu.RUnlock()
+	return append([]System(nil), systemRegistry...)
 }
 
 // System represents the service manager that is available.
@@ -393,7 +646,23 @@ type Shutdowner interface {
 
 // TODO: Add Configure to Service interface.
 
+// TransientStarter is implemented by the Services of systems that can run a
+// service without installing it, such as systemd with transient units.
+type TransientStarter interface {
+	// StartTransient starts the service with the settings Install would
+	// write, but without writing them to disk. Status, Stop, Logs and
+	// Watch work on the running service; the system forgets it once it
+	// stops.
+	StartTransient(ctx context.Context) error
+}
+
 // Service represents a service that can be run or controlled.
+//
+// The Services of this package also implement io.Closer. Close closes the
+// Loggers that Logger built from the logging options, which Run does when
+// it returns, and anything else the service holds, such as a connection to
+// systemd over D-Bus. A program that logs without calling Run closes the
+// service once it is done logging.
 type Service interface {
 	// Run should be called shortly after the program entry point.
 	// After Interface.Stop has finished running, Run will stop blocking.
@@ -479,3 +748,40 @@ type Logger interface {
 	Warningf(format string, a ...interface{}) error
 	Infof(format string, a ...interface{}) error
 }
+
+// DebugLogger is implemented by Loggers whose sink has a debug level.
+type DebugLogger interface {
+	Debug(v ...interface{}) error
+	Debugf(format string, a ...interface{}) error
+}
+
+// fieldLogger is implemented by Loggers that keep structured fields, such
+// as JournalLogger. pc, if non-zero, identifies the caller.
+type fieldLogger interface {
+	logFields(level Level, message string, pc uintptr, fields map[string]string) error
+}
+
+// Level is the severity of a log message.
+type Level int
+
+// Levels in increasing severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
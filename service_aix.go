@@ -13,11 +13,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
@@ -106,6 +104,7 @@ func (s *aixService) template() *template.Template {
 			}
 			return "false"
 		},
+		"sysvcMarker": sysvcMarker,
 	}
 
 	customConfig := s.Option.string(optionSysvScript, "")
@@ -122,13 +121,18 @@ func (s *aixService) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister.
+func (s *aixService) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles("/etc/rc.d/init.d/*")
+}
+
 func (s *aixService) Install() error {
 	// install service
 	path, err := s.execPath()
 	if err != nil {
 		return err
 	}
-	err = run("mkssys", "-s", s.Name, "-p", path, "-u", "0", "-R", "-Q", "-S", "-n", "15", "-f", "9", "-d", "-w", "30")
+	err = s.run("mkssys", "-s", s.Name, "-p", path, "-u", "0", "-R", "-Q", "-S", "-n", "15", "-f", "9", "-d", "-w", "30")
 	if err != nil {
 		return err
 	}
@@ -184,7 +188,7 @@ func (s *aixService) Install() error {
 func (s *aixService) Uninstall() error {
 	_ = s.Stop() // stop first with best effort
 
-	err := run("rmssys", "-s", s.Name)
+	err := s.run("rmssys", "-s", s.Name)
 	if err != nil {
 		return err
 	}
@@ -197,7 +201,7 @@ func (s *aixService) Uninstall() error {
 }
 
 func (s *aixService) Status() (Status, error) {
-	exitCode, out, err := runWithOutput("lssrc", "-s", s.Name)
+	exitCode, out, err := s.runWithOutput("lssrc", "-s", s.Name)
 	if exitCode == 0 && err != nil {
 		if !strings.Contains(err.Error(), "failed with stderr") {
 			return StatusUnknown, err
@@ -231,11 +235,11 @@ func (s *aixService) Status() (Status, error) {
 }
 
 func (s *aixService) Start() error {
-	return run("startsrc", "-s", s.Name)
+	return s.run("startsrc", "-s", s.Name)
 }
 
 func (s *aixService) Stop() error {
-	return run("stopsrc", "-s", s.Name)
+	return s.run("stopsrc", "-s", s.Name)
 }
 
 func (s *aixService) Restart() error {
@@ -248,29 +252,48 @@ func (s *aixService) Restart() error {
 }
 
 func (s *aixService) Run() error {
-	var err error
-
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+	return runService(s, s.i, s.Config)
+}
 
-	return s.i.Stop(s)
+func (s *aixService) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *aixService) Logger(errs chan<- error) (Logger, error) {
 	if interactive {
-		return ConsoleLogger, nil
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 
 func (s *aixService) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
+
+// controller implements controlOpener.
+func (s *aixService) controller() controllable {
+	return s
+}
+
+// exists asks the System Resource Controller about the subsystem.
+func (s *aixService) exists() (bool, error) {
+	exitCode, _, err := s.runWithOutput("lssrc", "-s", s.Name)
+	if err != nil && exitCode == 0 && !strings.Contains(err.Error(), "failed with stderr") {
+		return false, err
+	}
+	return err == nil, nil
+}
+
+// enable returns ErrControlUnsupported: subsystems are started at boot by
+// entries in /etc/inittab or rc scripts, which sysvc does not edit.
+func (s *aixService) enable() error {
+	return ErrControlUnsupported
+}
+
+func (s *aixService) disable() error {
+	return ErrControlUnsupported
+}
+
+func (s *aixService) reload() error {
+	return s.run("refresh", "-s", s.Name)
+}
@@ -0,0 +1,211 @@
+package sysvc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// isContainerInit reports whether the program is PID 1, as it is in a
+// container started without an init process.
+func isContainerInit(p *prober) bool {
+	pid := os.Getpid()
+	p.record(Probe{Kind: "pid", Target: "self", Result: strconv.Itoa(pid), OK: pid == 1})
+	return pid == 1
+}
+
+// container runs the program as PID 1. There is no service manager to talk
+// to, so only Run is supported; it takes over the duties of an init process.
+type container struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newContainerService(i Interface, platform string, c *Config) (Service, error) {
+	s := &container{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+
+	return s, nil
+}
+
+func (s *container) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *container) Platform() string {
+	return s.platform
+}
+
+func (s *container) ConfigPath() (string, error) {
+	return "", ErrUnsupportedInContainer
+}
+
+func (s *container) Install() error {
+	return ErrUnsupportedInContainer
+}
+
+func (s *container) Uninstall() error {
+	return ErrUnsupportedInContainer
+}
+
+func (s *container) Start() error {
+	return ErrUnsupportedInContainer
+}
+
+func (s *container) Stop() error {
+	return ErrUnsupportedInContainer
+}
+
+func (s *container) Restart() error {
+	return ErrUnsupportedInContainer
+}
+
+func (s *container) Status() (Status, error) {
+	return StatusUnknown, ErrUnsupportedInContainer
+}
+
+func (s *container) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	return nil, ErrUnsupportedInContainer
+}
+
+func (s *container) Logger(errs chan<- error) (Logger, error) {
+	// The container runtime collects the output of PID 1.
+	return s.consoleLogger(), nil
+}
+
+func (s *container) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+// Run starts the program, then reaps orphaned children and forwards
+// SIGTERM, SIGINT and SIGHUP to the process groups of its children until
+// SIGTERM or SIGINT arrives, at which point Interface.Stop is called.
+func (s *container) Run() error {
+	sigChan := make(chan os.Signal, 8)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGCHLD)
+	defer signal.Stop(sigChan)
+
+	if err := s.i.Start(s); err != nil {
+		return err
+	}
+
+	var taskDone <-chan struct{}
+	if t, ok := s.i.(*taskProgram); ok {
+		taskDone = t.done
+	}
+
+	reap := s.Option.bool(optionReapChildren, optionReapChildrenDefault)
+loop:
+	for {
+		select {
+		case <-taskDone:
+			break loop
+		case sig := <-sigChan:
+			switch sig {
+			case syscall.SIGCHLD:
+				if reap {
+					reapChildren()
+				}
+			case syscall.SIGHUP:
+				forwardSignal(sig.(syscall.Signal))
+			default:
+				forwardSignal(sig.(syscall.Signal))
+				break loop
+			}
+		}
+	}
+
+	err := s.i.Stop(s)
+	if reap {
+		reapChildren()
+	}
+	return err
+}
+
+func (s *container) Close() error {
+	return s.closeLoggers()
+}
+
+// reapChildren collects every child that has exited. As PID 1, orphaned
+// processes anywhere in the container are re-parented to us and would
+// otherwise stay zombies.
+func reapChildren() {
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if pid <= 0 || err != nil {
+			return
+		}
+	}
+}
+
+// forwardSignal sends sig to the process group of every child. Children in
+// our own process group are signaled individually so we do not signal
+// ourselves.
+func forwardSignal(sig syscall.Signal) {
+	self := os.Getpid()
+	ownGroup := syscall.Getpgrp()
+	groups := map[int]bool{}
+	for _, child := range childProcesses(self) {
+		pgid, err := syscall.Getpgid(child)
+		if err != nil {
+			continue
+		}
+		if pgid == ownGroup {
+			syscall.Kill(child, sig)
+			continue
+		}
+		if !groups[pgid] {
+			groups[pgid] = true
+			syscall.Kill(-pgid, sig)
+		}
+	}
+}
+
+// childProcesses lists the PIDs whose parent is ppid.
+func childProcesses(ppid int) []int {
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var children []int
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		if parent, err := parentPID(pid); err == nil && parent == ppid {
+			children = append(children, pid)
+		}
+	}
+	return children
+}
+
+// parentPID reads the parent PID of pid from /proc/<pid>/stat.
+func parentPID(pid int) (int, error) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	// The command name is in parentheses and may contain spaces.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 2 {
+		return 0, syscall.EINVAL
+	}
+	return strconv.Atoi(fields[1])
+}
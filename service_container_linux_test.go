@@ -0,0 +1,148 @@
+package sysvc
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestContainerUnsupported(t *testing.T) {
+	s, _ := newContainerService(nil, "linux-container", &Config{Name: "go_container_test"})
+	for name, fn := range map[string]func() error{
+		"Install":   s.Install,
+		"Uninstall": s.Uninstall,
+		"Start":     s.Start,
+		"Stop":      s.Stop,
+		"Restart":   s.Restart,
+	} {
+		if err := fn(); err != ErrUnsupportedInContainer {
+			t.Errorf("%s() err = %v, want ErrUnsupportedInContainer", name, err)
+		}
+	}
+	if _, err := s.Status(); err != ErrUnsupportedInContainer {
+		t.Errorf("Status() err = %v, want ErrUnsupportedInContainer", err)
+	}
+}
+
+func Test_childProcesses(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	for _, pid := range childProcesses(os.Getpid()) {
+		if pid == cmd.Process.Pid {
+			return
+		}
+	}
+	t.Errorf("childProcesses() does not include %d", cmd.Process.Pid)
+}
+
+// containerProgram is an Interface made of functions, for running under
+// the container system.
+type containerProgram struct {
+	start, stop func() error
+}
+
+func (p *containerProgram) Start(Service) error { return p.start() }
+func (p *containerProgram) Stop(Service) error  { return p.stop() }
+
+// runContainer runs p as the container system would, and sends SIGTERM to
+// the test once started is closed. It returns the result of Run.
+func runContainer(t *testing.T, p *containerProgram, started <-chan struct{}) error {
+	t.Helper()
+	s, _ := newContainerService(p, "linux-container", &Config{Name: "go_container_test"})
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	select {
+	case <-started:
+	case err := <-done:
+		t.Fatalf("Run() returned before starting: %v", err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() did not return after SIGTERM")
+		return nil
+	}
+}
+
+func TestContainerReapsOrphans(t *testing.T) {
+	// Orphans are re-parented to a subreaper as they are to PID 1.
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		t.Skip(err)
+	}
+	defer unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 0, 0, 0, 0)
+
+	var orphan int
+	started, reaped := make(chan struct{}), make(chan struct{})
+	p := &containerProgram{
+		start: func() error {
+			// sh exits at once, leaving sleep without its parent.
+			out, err := exec.Command("sh", "-c", "sleep 0.2 >/dev/null & echo $!").Output()
+			if err != nil {
+				return err
+			}
+			if orphan, err = strconv.Atoi(strings.TrimSpace(string(out))); err != nil {
+				return err
+			}
+			go func() {
+				defer close(reaped)
+				deadline := time.Now().Add(5 * time.Second)
+				for time.Now().Before(deadline) {
+					if _, err := os.Stat("/proc/" + strconv.Itoa(orphan)); os.IsNotExist(err) {
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				t.Errorf("orphan %d was not reaped", orphan)
+			}()
+			return nil
+		},
+		stop: func() error { return nil },
+	}
+
+	// SIGTERM is only sent once the orphan is gone, so it is Run that
+	// reaped it and not the reaping on the way out.
+	go func() {
+		<-reaped
+		close(started)
+	}()
+	if err := runContainer(t, p, started); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerForwardsSIGTERM(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	started := make(chan struct{})
+	p := &containerProgram{
+		start: func() error {
+			defer close(started)
+			return cmd.Start()
+		},
+		stop: cmd.Wait,
+	}
+
+	err := runContainer(t, p, started)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Run() = %v, want the child to have been killed", err)
+	}
+	if ws := exitErr.Sys().(syscall.WaitStatus); !ws.Signaled() || ws.Signal() != syscall.SIGTERM {
+		t.Errorf("child exited with %v, want killed by SIGTERM", ws)
+	}
+}
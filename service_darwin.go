@@ -5,16 +5,16 @@
 package sysvc
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
@@ -108,6 +108,15 @@ func (s *darwinLaunchdService) ConfigPath() (string, error) {
 	return "/Library/LaunchDaemons/" + s.Name + ".plist", nil
 }
 
+// listInstalled implements installedLister for daemons and agents.
+func (s *darwinLaunchdService) listInstalled() ([]InstalledService, error) {
+	patterns := []string{"/Library/LaunchDaemons/*.plist"}
+	if homeDir, err := s.getHomeDir(); err == nil {
+		patterns = append(patterns, homeDir+"/Library/LaunchAgents/*.plist")
+	}
+	return listInstalledFiles(patterns...)
+}
+
 func (s *darwinLaunchdService) logDir() (string, error) {
 	if customDir := s.Option.string(optionLogDirectory, ""); customDir != "" {
 		return customDir, nil
@@ -130,6 +139,33 @@ func (s *darwinLaunchdService) getLogPath(logDir, logType string) string {
 	return fmt.Sprintf("%s/%s.%s.log", logDir, s.Name, logType)
 }
 
+func (s *darwinLaunchdService) logFiles() ([]logFile, error) {
+	stdout, stderr, err := s.getLogPaths()
+	if err != nil {
+		return nil, err
+	}
+	return []logFile{
+		{path: stdout, stream: LogStreamStdout},
+		{path: stderr, stream: LogStreamStderr},
+	}, nil
+}
+
+// pidPath returns the PID file newsyslog signals to have the log files
+// reopened.
+func (s *darwinLaunchdService) pidPath() (string, error) {
+	if p := s.Option.string(optionPIDFile, ""); p != "" {
+		return p, nil
+	}
+	if !s.userService {
+		return "/var/run/" + s.Name + ".pid", nil
+	}
+	logDir, err := s.logDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(logDir, s.Name+".pid"), nil
+}
+
 func (s *darwinLaunchdService) template() *template.Template {
 	functions := template.FuncMap{
 		"bool": func(v bool) string {
@@ -138,6 +174,7 @@ func (s *darwinLaunchdService) template() *template.Template {
 			}
 			return "false"
 		},
+		"sysvcMarker": sysvcMarker,
 	}
 
 	customConfig := s.Option.string(optionLaunchdConfig, "")
@@ -158,6 +195,18 @@ func (s *darwinLaunchdService) Install() error {
 		return fmt.Errorf("Init already exists: %s", confPath)
 	}
 
+	files, err := s.logFiles()
+	if err != nil {
+		return err
+	}
+	pidPath, err := s.pidPath()
+	if err != nil {
+		return err
+	}
+	if err = s.installNewsyslog(files, pidPath); err != nil {
+		return err
+	}
+
 	if s.userService {
 		// Ensure that ~/Library/LaunchAgents exists.
 		err = os.MkdirAll(filepath.Dir(confPath), 0700)
@@ -177,6 +226,9 @@ func (s *darwinLaunchdService) Install() error {
 		return err
 	}
 
+	// launchd would run a task again as soon as it exits.
+	keepAlive := optionKeepAliveDefault && !isTask(s.i)
+
 	stdOutPath, stdErrPath, _ := s.getLogPaths()
 	var to = &struct {
 		*Config
@@ -189,7 +241,7 @@ func (s *darwinLaunchdService) Install() error {
 	}{
 		Config:            s.Config,
 		Path:              path,
-		KeepAlive:         s.Option.bool(optionKeepAlive, optionKeepAliveDefault),
+		KeepAlive:         s.Option.bool(optionKeepAlive, keepAlive),
 		RunAtLoad:         s.Option.bool(optionRunAtLoad, optionRunAtLoadDefault),
 		SessionCreate:     s.Option.bool(optionSessionCreate, optionSessionCreateDefault),
 		StandardOutPath:   stdOutPath,
@@ -206,11 +258,14 @@ func (s *darwinLaunchdService) Uninstall() error {
 	if err != nil {
 		return err
 	}
-	return os.Remove(confPath)
+	if err = os.Remove(confPath); err != nil {
+		return err
+	}
+	return s.uninstallNewsyslog()
 }
 
 func (s *darwinLaunchdService) Status() (Status, error) {
-	exitCode, out, err := runWithOutput("launchctl", "list", s.Name)
+	exitCode, out, err := s.runWithOutput("launchctl", "list", s.Name)
 	if exitCode == 0 && err != nil {
 		if !strings.Contains(err.Error(), "failed with stderr") {
 			return StatusUnknown, err
@@ -235,12 +290,20 @@ func (s *darwinLaunchdService) Status() (Status, error) {
 	return StatusUnknown, ErrNotInstalled
 }
 
+func (s *darwinLaunchdService) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	files, err := s.logFiles()
+	if err != nil {
+		return nil, err
+	}
+	return tailLogFiles(ctx, q, files)
+}
+
 func (s *darwinLaunchdService) Start() error {
 	confPath, err := s.ConfigPath()
 	if err != nil {
 		return err
 	}
-	return run("launchctl", "load", confPath)
+	return s.run("launchctl", "load", confPath)
 }
 
 func (s *darwinLaunchdService) Stop() error {
@@ -248,7 +311,7 @@ func (s *darwinLaunchdService) Stop() error {
 	if err != nil {
 		return err
 	}
-	return run("launchctl", "unload", confPath)
+	return s.run("launchctl", "unload", confPath)
 }
 
 func (s *darwinLaunchdService) Restart() error {
@@ -261,27 +324,178 @@ func (s *darwinLaunchdService) Restart() error {
 }
 
 func (s *darwinLaunchdService) Run() error {
-	err := s.i.Start(s)
+	var files []logFile
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		var err error
+		if files, err = s.logFiles(); err != nil {
+			return err
+		}
+	}
+	pidPath, err := s.pidPath()
 	if err != nil {
 		return err
 	}
+	return runServiceOutput(s, s.i, s.Config, files, pidPath)
+}
 
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
-
-	return s.i.Stop(s)
+func (s *darwinLaunchdService) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *darwinLaunchdService) Logger(errs chan<- error) (Logger, error) {
 	if interactive {
-		return ConsoleLogger, nil
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 
 func (s *darwinLaunchdService) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
+
+// launchdControl controls launchd jobs by label, wherever their plist is.
+type launchdControl struct {
+	*darwinLaunchdService
+}
+
+// controller implements controlOpener.
+func (s *darwinLaunchdService) controller() controllable {
+	return launchdControl{s}
+}
+
+// domain returns the launchd domain of the job: the system domain for
+// daemons and the GUI domain of the user for agents.
+func (s launchdControl) domain() string {
+	if s.userService {
+		return "gui/" + strconv.Itoa(os.Getuid())
+	}
+	return "system"
+}
+
+func (s launchdControl) target() string {
+	return s.domain() + "/" + s.Name
+}
+
+// loaded reports whether the job is loaded into its domain.
+func (s launchdControl) loaded() bool {
+	_, _, err := s.runWithOutput("launchctl", "print", s.target())
+	return err == nil
+}
+
+// plistPath returns the plist of the job, or "" if there is none.
+func (s launchdControl) plistPath() (string, error) {
+	dirs := []string{"/Library/LaunchDaemons", "/System/Library/LaunchDaemons"}
+	if s.userService {
+		homeDir, err := s.getHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dirs = []string{homeDir + "/Library/LaunchAgents", "/Library/LaunchAgents", "/System/Library/LaunchAgents"}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, s.Name+".plist")
+		if ok, err := pathExists(path); ok || err != nil {
+			return path, err
+		}
+	}
+	return "", nil
+}
+
+func (s launchdControl) exists() (bool, error) {
+	if s.loaded() {
+		return true, nil
+	}
+	path, err := s.plistPath()
+	return path != "", err
+}
+
+// Start loads the job if Stop unloaded it, then starts it.
+func (s launchdControl) Start() error {
+	if !s.loaded() {
+		path, err := s.plistPath()
+		if err != nil {
+			return err
+		}
+		if err = s.run("launchctl", "bootstrap", s.domain(), path); err != nil {
+			return err
+		}
+	}
+	return s.run("launchctl", "kickstart", s.target())
+}
+
+// Stop unloads the job, as launchd would restart a KeepAlive job that is
+// only killed.
+func (s launchdControl) Stop() error {
+	return s.run("launchctl", "bootout", s.target())
+}
+
+func (s launchdControl) Restart() error {
+	if !s.loaded() {
+		return s.Start()
+	}
+	return s.run("launchctl", "kickstart", "-k", s.target())
+}
+
+func (s launchdControl) Status() (Status, error) {
+	_, out, _ := s.runWithOutput("launchctl", "list", s.Name)
+	if regexp.MustCompile(`"PID" = ([0-9]+);`).MatchString(out) {
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
+func (s launchdControl) enable() error {
+	return s.run("launchctl", "enable", s.target())
+}
+
+func (s launchdControl) disable() error {
+	return s.run("launchctl", "disable", s.target())
+}
+
+// statusMany implements statusBatcher with a single launchctl list. Jobs
+// that are not loaded are stopped if their plist exists.
+func (s *darwinLaunchdService) statusMany(names []string) (map[string]StatusInfo, error) {
+	_, out, err := s.runWithOutput("launchctl", "list")
+	if err != nil {
+		return nil, err
+	}
+	pids := parseLaunchctlList(out)
+	infos := make(map[string]StatusInfo, len(names))
+	for _, name := range names {
+		if pid, ok := pids[name]; ok {
+			if pid > 0 {
+				infos[name] = StatusInfo{Status: StatusRunning, PID: pid}
+			} else {
+				infos[name] = StatusInfo{Status: StatusStopped}
+			}
+			continue
+		}
+		c := *s.Config
+		c.Name = name
+		path, err := launchdControl{&darwinLaunchdService{Config: &c, userService: s.userService}}.plistPath()
+		switch {
+		case err != nil:
+			infos[name] = StatusInfo{Err: err}
+		case path == "":
+			infos[name] = StatusInfo{Err: ErrNotInstalled}
+		default:
+			infos[name] = StatusInfo{Status: StatusStopped}
+		}
+	}
+	return infos, nil
+}
+
+// parseLaunchctlList parses the PID, status and label columns of launchctl
+// list into the PID of each label, 0 for jobs that are not running.
+func parseLaunchctlList(out string) map[string]int {
+	pids := map[string]int{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "PID" {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		pids[fields[2]] = pid
+	}
+	return pids
+}
@@ -0,0 +1,453 @@
+package sysvc
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// https://davmac.org/projects/dinit/man-pages-html/dinit-service.5.html
+//
+//go:embed service_dinit_linux.tmpl
+var dinitConfig string
+
+const dinitServiceDir = "/etc/dinit.d"
+
+func isDinit(p *prober) bool {
+	if p.pid1Comm() == "dinit" {
+		return true
+	}
+	if _, err := p.lookPath("dinitctl"); err != nil {
+		return false
+	}
+	// dinitctl may be installed where another init runs, so also require a
+	// dinit instance to be listening.
+	for _, path := range dinitSockets() {
+		if p.dial(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// dinitSockets returns where the control sockets of the system and the
+// user instance of dinit are.
+func dinitSockets() []string {
+	sockets := []string{"/run/dinitctl", "/dev/dinitctl"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "dinitctl"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		sockets = append(sockets, filepath.Join(home, ".dinitctl"))
+	}
+	return sockets
+}
+
+type dinit struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newDinitService(i Interface, platform string, c *Config) (Service, error) {
+	s := &dinit{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+
+	return s, nil
+}
+
+func (s *dinit) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *dinit) Platform() string {
+	return s.platform
+}
+
+func (s *dinit) isUserService() bool {
+	return s.Option.bool(optionUserService, optionUserServiceDefault)
+}
+
+func (s *dinit) serviceDir() (string, error) {
+	if !s.isUserService() {
+		return dinitServiceDir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config/dinit.d"), nil
+}
+
+func (s *dinit) ConfigPath() (string, error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.Name), nil
+}
+
+// listInstalled implements installedLister for system and user services.
+func (s *dinit) listInstalled() ([]InstalledService, error) {
+	patterns := append([]string{filepath.Join(dinitServiceDir, "*")}, userConfigPatterns(".config/dinit.d/*")...)
+	return listInstalledFiles(patterns...)
+}
+
+func (s *dinit) template() *template.Template {
+	customConfig := s.Option.string(optionDinitConfig, "")
+
+	if customConfig != "" {
+		return template.Must(template.New("").Funcs(tf).Parse(customConfig))
+	}
+	return template.Must(template.New("").Funcs(tf).Parse(dinitConfig))
+}
+
+// dinitRestart maps a Restart option onto the restart setting.
+func dinitRestart(restart string) string {
+	switch restart {
+	case "no":
+		return "false"
+	case "on-failure", "on-abnormal":
+		return "on-failure"
+	default:
+		return "true"
+	}
+}
+
+// dinitDependencies turns Dependencies into dependency settings. Entries that
+// are already settings, such as "waits-for = network", are kept as they are;
+// a bare service name becomes a depends-on setting.
+func dinitDependencies(deps []string) []string {
+	lines := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		dep = strings.TrimSpace(dep)
+		switch {
+		case dep == "":
+			continue
+		case strings.ContainsAny(dep, "=:"):
+			lines = append(lines, dep)
+		default:
+			lines = append(lines, "depends-on = "+dep)
+		}
+	}
+	return lines
+}
+
+func (s *dinit) envFile() string {
+	if len(s.EnvVars) == 0 {
+		return ""
+	}
+	dir, _ := s.serviceDir()
+	return filepath.Join(dir, s.Name+".env")
+}
+
+func (s *dinit) writeEnvFile() error {
+	envFile := s.envFile()
+	if envFile == "" {
+		return nil
+	}
+	keys := make([]string, 0, len(s.EnvVars))
+	for k := range s.EnvVars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, s.EnvVars[k])
+	}
+	return os.WriteFile(envFile, []byte(b.String()), 0644)
+}
+
+func (s *dinit) Install() error {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(confPath); err == nil {
+		return fmt.Errorf("Init already exists: %s", confPath)
+	}
+	if err = os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return err
+	}
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Path         string
+		Task         bool
+		Restart      string
+		EnvFile      string
+		LogOutput    bool
+		LogDirectory string
+		Dependencies []string
+	}{
+		s.Config,
+		path,
+		isTask(s.i),
+		dinitRestart(restartPolicy(s.i, s.Option)),
+		s.envFile(),
+		s.Option.bool(optionLogOutput, optionLogOutputDefault),
+		s.Option.string(optionLogDirectory, defaultLogDirectory),
+		dinitDependencies(s.Dependencies),
+	}
+
+	if err = s.writeConfig(confPath, to); err != nil {
+		s.removeConfig(confPath)
+		return err
+	}
+	return nil
+}
+
+// writeConfig writes the service and its environment file, and links it
+// into the boot service so that it starts at boot. Unlike dinitctl enable,
+// this does not start it now.
+func (s *dinit) writeConfig(confPath string, to interface{}) error {
+	f, err := os.Create(confPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = s.template().Execute(f, to); err != nil {
+		return err
+	}
+	if err = s.writeEnvFile(); err != nil {
+		return err
+	}
+
+	bootDir, err := s.bootDir()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(bootDir, 0755); err != nil {
+		return err
+	}
+	return os.Symlink(confPath, filepath.Join(bootDir, s.Name))
+}
+
+// removeConfig removes what writeConfig wrote.
+func (s *dinit) removeConfig(confPath string) error {
+	if bootDir, err := s.bootDir(); err == nil {
+		os.Remove(filepath.Join(bootDir, s.Name))
+	}
+	if envFile := s.envFile(); envFile != "" {
+		os.Remove(envFile)
+	}
+	return os.Remove(confPath)
+}
+
+// bootDir returns the waits-for.d directory of the boot service, whose
+// services dinit starts at boot. It is boot.d in the service directory
+// unless the boot service says otherwise.
+func (s *dinit) bootDir() (string, error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return "", err
+	}
+	dirs := []string{dir}
+	if !s.isUserService() {
+		dirs = dinitServiceDirs
+	}
+	for _, d := range dirs {
+		data, err := os.ReadFile(filepath.Join(d, "boot"))
+		if err != nil {
+			continue
+		}
+		waitsFor := dinitSetting(string(data), "waits-for.d")
+		if waitsFor == "" {
+			break
+		}
+		if !filepath.IsAbs(waitsFor) {
+			waitsFor = filepath.Join(d, waitsFor)
+		}
+		return waitsFor, nil
+	}
+	return filepath.Join(dir, "boot.d"), nil
+}
+
+// dinitSetting returns the value of the first setting named key in a
+// service description, or "".
+func dinitSetting(desc, key string) string {
+	for _, line := range strings.Split(desc, "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.IndexAny(line, "=:")
+		if i < 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.TrimSpace(line[:i]) == key {
+			return strings.TrimSpace(line[i+1:])
+		}
+	}
+	return ""
+}
+
+func (s *dinit) Uninstall() error {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(confPath); os.IsNotExist(err) {
+		return ErrNotInstalled
+	}
+	_ = s.run("stop", s.Name)
+	return s.removeConfig(confPath)
+}
+
+func (s *dinit) Logger(errs chan<- error) (Logger, error) {
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
+	}
+	return s.serviceLogger(errs, s.SystemLogger)
+}
+
+func (s *dinit) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *dinit) Run() error {
+	return runService(s, s.i, s.Config)
+}
+
+func (s *dinit) Close() error {
+	return s.closeLoggers()
+}
+
+func (s *dinit) Status() (Status, error) {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err = os.Stat(confPath); os.IsNotExist(err) {
+		return StatusUnknown, ErrNotInstalled
+	}
+
+	_, out, err := s.runWithOutput("status", s.Name)
+	if out == "" && err != nil {
+		return StatusUnknown, err
+	}
+	return parseDinitStatus(out)
+}
+
+func (s *dinit) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	if !s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		return nil, ErrLogsUnsupported
+	}
+	// dinit writes stdout and stderr to the same file.
+	path := filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name+".log")
+	return tailLogFiles(ctx, q, []logFile{{path: path, stream: LogStreamAll}})
+}
+
+// parseDinitStatus parses the output of `dinitctl status`, which includes
+// a line such as "    State: STARTED".
+func parseDinitStatus(out string) (Status, error) {
+	for _, line := range strings.Split(out, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found || key != "State" {
+			continue
+		}
+		state := strings.Fields(value)
+		if len(state) == 0 {
+			break
+		}
+		switch state[0] {
+		case "STARTED", "STARTING":
+			return StatusRunning, nil
+		case "STOPPED", "STOPPING":
+			return StatusStopped, nil
+		default:
+			return StatusUnknown, fmt.Errorf("unknown dinit state %q", state[0])
+		}
+	}
+	return StatusUnknown, ErrNotInstalled
+}
+
+func (s *dinit) Start() error {
+	return s.run("start", s.Name)
+}
+
+func (s *dinit) Stop() error {
+	return s.run("stop", s.Name)
+}
+
+func (s *dinit) Restart() error {
+	return s.run("restart", s.Name)
+}
+
+func (s *dinit) args(args []string) []string {
+	if s.isUserService() {
+		return append([]string{"--user"}, args...)
+	}
+	return args
+}
+
+func (s *dinit) run(args ...string) error {
+	return s.Config.run("dinitctl", s.args(args)...)
+}
+
+func (s *dinit) runWithOutput(args ...string) (int, string, error) {
+	return s.Config.runWithOutput("dinitctl", s.args(args)...)
+}
+
+// dinitServiceDirs are the directories dinit loads system services from, in
+// its order.
+var dinitServiceDirs = []string{dinitServiceDir, "/run/dinit.d", "/usr/local/lib/dinit.d", "/lib/dinit.d"}
+
+// dinitControl controls services that sysvc did not necessarily write,
+// which may be in any of the service directories.
+type dinitControl struct {
+	*dinit
+}
+
+// controller implements controlOpener.
+func (s *dinit) controller() controllable {
+	return dinitControl{s}
+}
+
+func (s dinitControl) exists() (bool, error) {
+	dirs := dinitServiceDirs
+	if s.isUserService() {
+		dir, err := s.serviceDir()
+		if err != nil {
+			return false, err
+		}
+		dirs = []string{dir}
+	}
+	for _, dir := range dirs {
+		if ok, err := pathExists(filepath.Join(dir, s.Name)); ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (s dinitControl) Status() (Status, error) {
+	_, out, err := s.runWithOutput("status", s.Name)
+	if out == "" && err != nil {
+		return StatusUnknown, err
+	}
+	return parseDinitStatus(out)
+}
+
+func (s dinitControl) enable() error {
+	return s.run("enable", s.Name)
+}
+
+func (s dinitControl) disable() error {
+	return s.run("disable", s.Name)
+}
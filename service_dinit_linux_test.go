@@ -0,0 +1,97 @@
+package sysvc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseDinitStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    Status
+		wantErr bool
+	}{
+		{"started", "Service: foo\n    State: STARTED\n    Activation: explicitly started\n    Process ID: 1234\n", StatusRunning, false},
+		{"starting", "Service: foo\n    State: STARTING\n", StatusRunning, false},
+		{"stopped", "Service: foo\n    State: STOPPED (terminated; exited - status 1)\n", StatusStopped, false},
+		{"not-found", "dinitctl: service not found: foo\n", StatusUnknown, true},
+		{"unknown", "Service: foo\n    State: WEIRD\n", StatusUnknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDinitStatus(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDinitStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseDinitStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dinitDependencies(t *testing.T) {
+	got := dinitDependencies([]string{"network", "waits-for = syslog", "", "depends-ms: dbus"})
+	want := []string{"depends-on = network", "waits-for = syslog", "depends-ms: dbus"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dinitDependencies() = %v, want %v", got, want)
+	}
+}
+
+func TestDinitInstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".config/dinit.d")
+	runner := &recordingRunner{}
+	m := &Manager{
+		System: NewSystem("test-dinit", func() bool { return true }, func() bool { return false }, newDinitService),
+		Runner: runner,
+	}
+	s, err := m.New(nil, &Config{
+		Name:       "app",
+		Executable: "/opt/app",
+		EnvVars:    map[string]string{"A": "1"},
+		Option:     KeyValue{"UserService": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "boot.d", "app")); err != nil || target != filepath.Join(dir, "app") {
+		t.Errorf("boot link = %q, %v", target, err)
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("Install() ran %q, want nothing started", runner.commands)
+	}
+	if err = s.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "boot.d"))
+	if len(entries) != 0 {
+		t.Errorf("boot.d has %d entries after Uninstall", len(entries))
+	}
+
+	// The boot service may name another directory. Failing to link the
+	// service leaves nothing behind.
+	if err = os.WriteFile(filepath.Join(dir, "boot"), []byte("type = internal\nwaits-for.d = enabled\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "enabled"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Install(); err == nil {
+		t.Fatal("Install() succeeded with enabled being a file")
+	}
+	for _, name := range []string{"app", "app.env"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left after failed Install: %v", name, err)
+		}
+	}
+}
@@ -8,9 +8,7 @@ import (
 	_ "embed"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
 	"text/template"
 )
 
@@ -81,6 +79,7 @@ func (s *freebsdService) template() *template.Template {
 			}
 			return "false"
 		},
+		"sysvcMarker": sysvcMarker,
 	}
 
 	customConfig := s.Option.string(optionSysvScript, "")
@@ -101,6 +100,11 @@ func (s *freebsdService) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister.
+func (s *freebsdService) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles(filepath.Join(configDir, "*"))
+}
+
 func (s *freebsdService) Install() error {
 	path, err := s.execPath()
 	if err != nil {
@@ -172,38 +176,77 @@ func (s *freebsdService) Status() (Status, error) {
 }
 
 func (s *freebsdService) Start() error {
-	return run("service", s.Name, "start")
+	return s.run("service", s.Name, "start")
 }
 
 func (s *freebsdService) Stop() error {
-	return run("service", s.Name, "stop")
+	return s.run("service", s.Name, "stop")
 }
 
 func (s *freebsdService) Restart() error {
-	return run("service", s.Name, "restart")
+	return s.run("service", s.Name, "restart")
 }
 
 func (s *freebsdService) Run() error {
-	if err := s.i.Start(s); err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+	return runService(s, s.i, s.Config)
+}
 
-	return s.i.Stop(s)
+func (s *freebsdService) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *freebsdService) Logger(errs chan<- error) (Logger, error) {
 	if interactive {
-		return ConsoleLogger, nil
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 
 func (s *freebsdService) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
+
+// freebsdControl controls rc.d scripts of the base system as well as of
+// packages.
+type freebsdControl struct {
+	*freebsdService
+}
+
+// controller implements controlOpener.
+func (s *freebsdService) controller() controllable {
+	return freebsdControl{s}
+}
+
+func (s freebsdControl) exists() (bool, error) {
+	for _, dir := range []string{"/etc/rc.d", configDir} {
+		if ok, err := pathExists(filepath.Join(dir, s.Name)); ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (s freebsdControl) Status() (Status, error) {
+	exitCode, _, err := s.runWithOutput("service", s.Name, "status")
+	switch {
+	case err == nil:
+		return StatusRunning, nil
+	case exitCode != 0:
+		return StatusStopped, nil
+	}
+	return StatusUnknown, err
+}
+
+// enable sets the rc.conf variable of the script, with service(8) doing
+// what sysrc would.
+func (s freebsdControl) enable() error {
+	return s.run("service", s.Name, "enable")
+}
+
+func (s freebsdControl) disable() error {
+	return s.run("service", s.Name, "disable")
+}
+
+func (s freebsdControl) reload() error {
+	return s.run("service", s.Name, "reload")
+}
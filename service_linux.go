@@ -6,18 +6,20 @@ package sysvc
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"text/template"
 )
 
-var cgroupFile = "/proc/1/cgroup"
-
 type linuxSystemService struct {
 	name        string
-	detect      func() bool
-	interactive func() bool
+	detect      func(p *prober) bool
+	interactive func() (bool, string)
 	new         func(i Interface, platform string, c *Config) (Service, error)
 }
 
@@ -25,65 +27,93 @@ func (sc linuxSystemService) String() string {
 	return sc.name
 }
 func (sc linuxSystemService) Detect() bool {
-	return sc.detect()
+	return sc.detect(nil)
+}
+
+// detectProbes implements probeDetector.
+func (sc linuxSystemService) detectProbes(p *prober) bool {
+	return sc.detect(p)
 }
 func (sc linuxSystemService) Interactive() bool {
-	return sc.interactive()
+	is, _ := sc.interactive()
+	return is
+}
+func (sc linuxSystemService) InteractiveReason() string {
+	_, reason := sc.interactive()
+	return reason
 }
 func (sc linuxSystemService) New(i Interface, c *Config) (Service, error) {
 	return sc.new(i, sc.String(), c)
 }
 
 func init() {
-	ChooseSystem(linuxSystemService{
-		name:   "linux-systemd",
-		detect: isSystemd,
-		interactive: func() bool {
-			is, _ := isInteractive()
-			return is
-		},
-		new: newSystemdService,
-	}, linuxSystemService{
-		name:   "linux-upstart",
-		detect: isUpstart,
-		interactive: func() bool {
-			is, _ := isInteractive()
-			return is
-		},
-		new: newUpstartService,
-	}, linuxSystemService{
-		name:   "linux-openrc",
-		detect: isOpenRC,
-		interactive: func() bool {
-			is, _ := isInteractive()
-			return is
-		},
-		new: newOpenRCService,
-	}, linuxSystemService{
-		name:   "linux-rcs",
-		detect: isRCS,
-		interactive: func() bool {
-			is, _ := isInteractive()
-			return is
-		},
-		new: newRCSService,
-	}, linuxSystemService{
-		name:   "linux-procd",
-		detect: isProcd,
-		interactive: func() bool {
-			is, _ := isInteractive()
-			return is
-		},
-		new: newProcdService,
-	}, linuxSystemService{
-		name:   "unix-systemv",
-		detect: func() bool { return true },
-		interactive: func() bool {
-			is, _ := isInteractive()
-			return is
-		},
-		new: newSystemVService,
-	})
+	builtin := []linuxSystemService{{
+		name:        "linux-container",
+		detect:      isContainerInit,
+		interactive: func() (bool, string) { return true, "running as PID 1" },
+		new:         newContainerService,
+	}, {
+		name:        "linux-systemd",
+		detect:      isSystemd,
+		interactive: linuxInteractive,
+		new:         newSystemdService,
+	}, {
+		name:        "linux-upstart",
+		detect:      isUpstart,
+		interactive: linuxInteractive,
+		new:         newUpstartService,
+	}, {
+		name:        "linux-openrc",
+		detect:      isOpenRC,
+		interactive: linuxInteractive,
+		new:         newOpenRCService,
+	}, {
+		name:        "linux-rcs",
+		detect:      isRCS,
+		interactive: linuxInteractive,
+		new:         newRCSService,
+	}, {
+		name:        "linux-procd",
+		detect:      isProcd,
+		interactive: linuxInteractive,
+		new:         newProcdService,
+	}, {
+		name:        "linux-dinit",
+		detect:      isDinit,
+		interactive: linuxInteractive,
+		new:         newDinitService,
+	}, {
+		name:        "linux-runit",
+		detect:      isRunit,
+		interactive: linuxInteractive,
+		new:         newRunitService,
+	}, {
+		name:        "linux-s6",
+		detect:      isS6,
+		interactive: linuxInteractive,
+		new:         newS6Service,
+	}, {
+		name:        "linux-supervisord",
+		detect:      isSupervisord,
+		interactive: linuxInteractive,
+		new:         newSupervisordService,
+	}, {
+		name:        "unix-systemv",
+		detect:      func(*prober) bool { return true },
+		interactive: linuxInteractive,
+		new:         newSystemVService,
+	}, {
+		// sysvc-supervise is only used when chosen by name.
+		name:        "sysvc-supervise",
+		detect:      func(*prober) bool { return false },
+		interactive: superviseInteractive,
+		new:         newSuperviseService,
+	}}
+	// The first system gets the highest priority; see RegisterSystem.
+	for i, sys := range builtin {
+		addRegistration(sys, 10*(len(builtin)-1-i))
+	}
+	updateRegistry()
 }
 
 func binaryName(pid int) (string, error) {
@@ -100,49 +130,50 @@ func binaryName(pid int) (string, error) {
 	return data[binStart : binStart+binEnd], nil
 }
 
-func isInteractive() (bool, error) {
-	inContainer, err := isInContainer(cgroupFile)
+// pid1Comm returns the command name of PID 1, or "" if it cannot be read.
+func (p *prober) pid1Comm() string {
+	data, err := ioutil.ReadFile("/proc/1/comm")
 	if err != nil {
-		return false, err
+		p.record(Probe{Kind: "pid1", Target: "/proc/1/comm", Result: probeError(err)})
+		return ""
 	}
+	comm := strings.TrimSpace(string(data))
+	p.record(Probe{Kind: "pid1", Target: "/proc/1/comm", Result: comm, OK: true})
+	return comm
+}
 
-	if inContainer {
-		return true, nil
+// isProcessRunning reports whether any process has the given command name.
+func (p *prober) isProcessRunning(comm string) bool {
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		p.record(Probe{Kind: "process", Target: comm, Result: probeError(err)})
+		return false
 	}
-
-	ppid := os.Getppid()
-	if ppid == 1 {
-		return false, nil
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		if name, err := binaryName(pid); err == nil && name == comm {
+			p.record(Probe{Kind: "process", Target: comm, Result: "running as PID " + proc.Name(), OK: true})
+			return true
+		}
 	}
-
-	binary, _ := binaryName(ppid)
-	return binary != "systemd", nil
+	p.record(Probe{Kind: "process", Target: comm, Result: "not running"})
+	return false
 }
 
-// isInContainer checks if the service is being executed in docker or lxc
-// container.
-func isInContainer(cgroupPath string) (bool, error) {
-	const maxlines = 5 // maximum lines to scan
-
-	f, err := os.Open(cgroupPath)
+// writeScript renders t with data into an executable file at path.
+func writeScript(path string, t *template.Template, data interface{}) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
-		return false, err
+		return err
 	}
-	defer f.Close()
-	scan := bufio.NewScanner(f)
-
-	lines := 0
-	for scan.Scan() && !(lines > maxlines) {
-		if strings.Contains(scan.Text(), "docker") || strings.Contains(scan.Text(), "lxc") {
-			return true, nil
-		}
-		lines++
-	}
-	if err := scan.Err(); err != nil {
-		return false, err
+	if err = t.Execute(f, data); err != nil {
+		f.Close()
+		return err
 	}
-
-	return false, nil
+	return f.Close()
 }
 
 var tf = map[string]interface{}{
@@ -152,4 +183,45 @@ var tf = map[string]interface{}{
 	"cmdEscape": func(s string) string {
 		return strings.Replace(s, " ", `\x20`, -1)
 	},
+	"sysvcMarker": sysvcMarker,
+}
+
+// commandLogs implements LogReader by running a command that prints log
+// lines, such as journalctl, with the CommandRunner of c. parse turns a line
+// into an entry, or reports false to skip it. The command is killed when ctx
+// is done.
+func (c *Config) commandLogs(ctx context.Context, parse func(line []byte) (LogEntry, bool), command string, arguments ...string) (<-chan LogEntry, error) {
+	var out io.ReadCloser
+	if sr, ok := c.commandRunner().(streamRunner); ok {
+		var err error
+		if out, err = sr.Stream(ctx, command, arguments...); err != nil {
+			return nil, err
+		}
+	} else {
+		_, output, err := c.runContext(ctx, command, arguments...)
+		if err != nil {
+			return nil, err
+		}
+		out = ioutil.NopCloser(strings.NewReader(output))
+	}
+
+	ch := make(chan LogEntry)
+	go func() {
+		defer close(ch)
+		defer out.Close()
+		scan := bufio.NewScanner(out)
+		scan.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scan.Scan() {
+			e, ok := parse(scan.Bytes())
+			if !ok {
+				continue
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
 }
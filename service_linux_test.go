@@ -8,6 +8,9 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -171,3 +174,312 @@ const (
 1:name=systemd:/init.scope
 0::/init.scope`
 )
+
+func Test_interactiveDetector(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := dir + "/" + name
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	hostCgroup := writeFile("host-cgroup", "0::/init.scope\n")
+	hostMounts := writeFile("host-mountinfo", "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n")
+	serviceCgroup := writeFile("service-cgroup", "0::/system.slice/foo.service\n")
+	serviceCgroupV1 := writeFile("service-cgroup-v1", "4:memory:/system.slice/foo.service\n1:name=systemd:/system.slice/foo.service\n")
+	sessionCgroup := writeFile("session-cgroup", "0::/user.slice/user-1000.slice/session-3.scope\n")
+	kubeCgroup := writeFile("kube-cgroup", "0::/kubepods/besteffort/pod1234/abcdef\n")
+	// A host running containers has their mounts, but not its root.
+	dockerHostMounts := writeFile("docker-host-mountinfo", "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n"+
+		"310 22 0:60 / /var/lib/docker/overlay2/abc/merged rw - overlay overlay rw,lowerdir=/var/lib/docker/overlay2/l/X\n"+
+		"320 22 0:61 / /var/lib/kubelet/pods/123/volumes/kubernetes.io~projected/kube-api rw - tmpfs tmpfs rw\n"+
+		"330 22 0:62 / /run/containerd/io.containerd.runtime.v2.task/k8s.io/abc/rootfs rw - overlay overlay rw\n")
+	podmanMounts := writeFile("podman-mountinfo", "600 500 0:50 / / rw - overlay overlay rw,lowerdir=/var/lib/containers/storage/overlay/l/ABC\n")
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		files      []string
+		cgroup     string
+		selfCgroup string
+		mountInfo  string
+		ppid       int
+		parent     string
+		stderrID   string
+		want       bool
+		wantErr    bool
+	}{
+		{name: "terminal", want: true},
+		{name: "override-false", env: map[string]string{envInteractive: "0"}, want: false},
+		{name: "override-true", env: map[string]string{envInteractive: "true", "INVOCATION_ID": "abc"}, want: true},
+		{name: "override-invalid", env: map[string]string{envInteractive: "maybe"}, wantErr: true},
+		{name: "invocation-id", env: map[string]string{"INVOCATION_ID": "abc"}, files: []string{"/.dockerenv"}, selfCgroup: serviceCgroup, want: false},
+		{name: "invocation-id-scope", env: map[string]string{"INVOCATION_ID": "abc"}, want: true},
+		{name: "journal-stream", env: map[string]string{"JOURNAL_STREAM": "8:1234"}, stderrID: "8:1234", want: false},
+		{name: "journal-stream-inherited", env: map[string]string{"JOURNAL_STREAM": "8:1234"}, stderrID: "136:3", want: true},
+		{name: "notify-socket", env: map[string]string{"NOTIFY_SOCKET": "/run/systemd/notify"}, want: false},
+		{name: "podman-env", env: map[string]string{"container": "podman"}, ppid: 1, want: true},
+		{name: "kubernetes-env", env: map[string]string{"KUBERNETES_SERVICE_HOST": "10.0.0.1"}, ppid: 1, want: true},
+		{name: "dockerenv", files: []string{"/.dockerenv"}, ppid: 1, want: true},
+		{name: "containerenv", files: []string{"/run/.containerenv"}, ppid: 1, want: true},
+		{name: "kubepods-cgroup", cgroup: kubeCgroup, ppid: 1, want: true},
+		{name: "podman-mountinfo", mountInfo: podmanMounts, ppid: 1, want: true},
+		{name: "docker-host-mountinfo", mountInfo: dockerHostMounts, ppid: 1, want: false},
+		{name: "service-cgroup-v2", selfCgroup: serviceCgroup, want: false},
+		{name: "service-cgroup-v1", selfCgroup: serviceCgroupV1, want: false},
+		{name: "session-cgroup", selfCgroup: sessionCgroup, want: true},
+		{name: "parent-pid-1", ppid: 1, want: false},
+		{name: "parent-systemd", ppid: 1234, parent: "systemd", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := interactiveDetector{
+				getenv: func(key string) string { return tt.env[key] },
+				stat: func(path string) error {
+					for _, f := range tt.files {
+						if f == path {
+							return nil
+						}
+					}
+					return os.ErrNotExist
+				},
+				cgroupFile:     hostCgroup,
+				selfCgroupFile: sessionCgroup,
+				mountInfoFile:  hostMounts,
+				ppid:           tt.ppid,
+				parentName:     func(int) (string, error) { return tt.parent, nil },
+				stderrID:       func() (string, error) { return tt.stderrID, nil },
+			}
+			if d.ppid == 0 {
+				d.ppid = 1234
+			}
+			if tt.cgroup != "" {
+				d.cgroupFile = tt.cgroup
+			}
+			if tt.selfCgroup != "" {
+				d.selfCgroupFile = tt.selfCgroup
+			}
+			if tt.mountInfo != "" {
+				d.mountInfoFile = tt.mountInfo
+			}
+			got, reason, err := d.detect()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("detect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("detect() = %v (%s), want %v", got, reason, tt.want)
+			}
+			if err == nil && reason == "" {
+				t.Error("detect() returned no reason")
+			}
+		})
+	}
+}
+
+func Test_systemdUnitFromCgroup(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"v2", "0::/system.slice/foo.service\n", "foo.service"},
+		{"v1", "4:memory:/system.slice/bar.service\n1:name=systemd:/system.slice/foo.service\n", "foo.service"},
+		{"root", "0::/\n", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := dir + "/" + tt.name
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := systemdUnitFromCgroup(path); got != tt.want {
+				t.Errorf("systemdUnitFromCgroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type recordingRunner struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (r *recordingRunner) Run(command string, arguments ...string) (int, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, strings.Join(append([]string{command}, arguments...), " "))
+	return 0, "", nil
+}
+
+func (r *recordingRunner) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.commands...)
+}
+
+func TestManager(t *testing.T) {
+	t.Setenv("SVDIR", "/srv/sv")
+	tests := []struct {
+		name string
+		new  func(i Interface, platform string, c *Config) (Service, error)
+		want []string
+	}{
+		{"openrc", newOpenRCService, []string{"rc-service test-manager start", "rc-service test-manager stop"}},
+		{"runit", newRunitService, []string{"sv up /srv/sv/test-manager", "sv down /srv/sv/test-manager"}},
+		{"sysv", newSystemVService, []string{"service test-manager start", "service test-manager stop"}},
+	}
+
+	var wg sync.WaitGroup
+	for _, tt := range tests {
+		tt := tt
+		runner := &recordingRunner{}
+		logger := ConsoleLogger
+		m := &Manager{
+			System: NewSystem("test-"+tt.name, func() bool { return true }, func() bool { return true }, tt.new),
+			Runner: runner,
+			Logger: logger,
+		}
+		c := &Config{Name: "test-manager"}
+		s, err := m.New(nil, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.sys != nil || c.runner != nil {
+			t.Errorf("%s: Manager.New modified the Config", tt.name)
+		}
+		if got := s.Platform(); got != "test-"+tt.name {
+			t.Errorf("%s: Platform() = %q", tt.name, got)
+		}
+		if got, err := s.Logger(nil); err != nil || got != logger {
+			t.Errorf("%s: Logger() = %v, %v, want the Manager's logger", tt.name, got, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Start()
+			s.Stop()
+		}()
+		defer func(name string, want []string) {
+			if !reflect.DeepEqual(runner.commands, want) {
+				t.Errorf("%s: commands = %q, want %q", name, runner.commands, want)
+			}
+		}(tt.name, tt.want)
+	}
+	wg.Wait()
+}
+
+func TestNewWithSystem(t *testing.T) {
+	sys := NewSystem("test-sysv", func() bool { return false }, func() bool { return false }, newSystemVService)
+	if _, err := NewWithSystem(sys, nil, &Config{}); err != ErrNameFieldRequired {
+		t.Errorf("NewWithSystem() error = %v, want ErrNameFieldRequired", err)
+	}
+	s, err := NewWithSystem(sys, nil, &Config{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Platform(); got != "test-sysv" {
+		t.Errorf("Platform() = %q, want test-sysv", got)
+	}
+}
+
+// scriptedRunner records commands like recordingRunner and answers those
+// starting with a key of out with its output.
+type scriptedRunner struct {
+	recordingRunner
+	out map[string]string
+}
+
+func (r *scriptedRunner) Run(command string, arguments ...string) (int, string, error) {
+	r.recordingRunner.Run(command, arguments...)
+	line := strings.Join(append([]string{command}, arguments...), " ")
+	for prefix, out := range r.out {
+		if strings.HasPrefix(line, prefix) {
+			return 0, out, nil
+		}
+	}
+	return 0, "", nil
+}
+
+func TestSystemdOpen(t *testing.T) {
+	runner := &scriptedRunner{out: map[string]string{
+		"systemctl show -p LoadState nginx.service":   "LoadState=loaded\n",
+		"systemctl show -p LoadState missing.service": "LoadState=not-found\n",
+		"systemctl is-active nginx.service":           "active\n",
+	}}
+	m := &Manager{
+		System: NewSystem("test-systemd", func() bool { return true }, func() bool { return false }, newSystemdService),
+		Runner: runner,
+	}
+
+	if _, err := m.Open("missing", nil); err != ErrNotInstalled {
+		t.Errorf("Open(missing) = %v, want ErrNotInstalled", err)
+	}
+	c, err := m.Open("nginx.service", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.commands = nil
+	if status, err := c.Status(); status != StatusRunning || err != nil {
+		t.Errorf("Status() = %v, %v; want StatusRunning", status, err)
+	}
+	c.Disable()
+	c.(Reloader).Reload()
+	want := []string{
+		"systemctl show -p LoadState nginx.service",
+		"systemctl is-active nginx.service",
+		"systemctl show -p LoadState nginx.service",
+		"systemctl disable nginx.service",
+		"systemctl show -p LoadState nginx.service",
+		"systemctl reload nginx.service",
+	}
+	if !reflect.DeepEqual(runner.commands, want) {
+		t.Errorf("commands = %q, want %q", runner.commands, want)
+	}
+}
+
+func TestRunitOpen(t *testing.T) {
+	t.Setenv("SVDIR", "/srv/sv")
+	runner := &recordingRunner{}
+	m := &Manager{
+		System: NewSystem("test-runit", func() bool { return true }, func() bool { return false }, newRunitService),
+		Runner: runner,
+	}
+	if _, err := m.Open("go_runit_open_missing", nil); err != ErrNotInstalled {
+		t.Errorf("Open() = %v, want ErrNotInstalled", err)
+	}
+}
+
+func TestSystemdStatusMany(t *testing.T) {
+	runner := &scriptedRunner{out: map[string]string{
+		"systemctl show": "Id=a.service\nLoadState=loaded\nActiveState=active\nSubState=running\nMainPID=7\n\n" +
+			"Id=b.service\nLoadState=not-found\nActiveState=inactive\nSubState=dead\nMainPID=0\n",
+	}}
+	m := &Manager{
+		System: NewSystem("test-systemd", func() bool { return true }, func() bool { return false }, newSystemdService),
+		Runner: runner,
+	}
+	infos, err := m.StatusMany([]string{"a", "b"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.commands) != 1 {
+		t.Errorf("commands = %q, want one", runner.commands)
+	}
+	if infos["a"].Status != StatusRunning || infos["a"].PID != 7 || infos["b"].Err != ErrNotInstalled {
+		t.Errorf("StatusMany() = %+v", infos)
+	}
+}
+
+func Test_parseRCStatus(t *testing.T) {
+	out := "Runlevel: default\n sshd                     [  started  ]\n" +
+		" crond                    [  started 2 day(s) (0)  ]\n local   [  stopped  ]\n netmount [ crashed ]\n"
+	want := map[string]string{"sshd": "started", "crond": "started", "local": "stopped", "netmount": "crashed"}
+	if got := parseRCStatus(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRCStatus() = %v, want %v", got, want)
+	}
+}
@@ -1,15 +1,14 @@
 package sysvc
 
 import (
-	"bytes"
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"os/signal"
 	"regexp"
-	"syscall"
+	"strings"
 	"text/template"
 	"time"
 )
@@ -20,27 +19,12 @@ import (
 //go:embed service_openrc_linux.tmpl
 var openRCScript string
 
-func isOpenRC() bool {
-	if _, err := exec.LookPath("openrc-init"); err == nil {
+func isOpenRC(p *prober) bool {
+	if _, err := p.lookPath("openrc-init"); err == nil {
 		return true
 	}
-	if _, err := os.Stat("/etc/inittab"); err == nil {
-		filerc, err := os.Open("/etc/inittab")
-		if err != nil {
-			return false
-		}
-		defer filerc.Close()
-
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(filerc)
-		contents := buf.String()
-
-		re := regexp.MustCompile(`::sysinit:.*openrc.*sysinit`)
-		matches := re.FindStringSubmatch(contents)
-		if len(matches) > 0 {
-			return true
-		}
-		return false
+	if err := p.stat("/etc/inittab"); err == nil {
+		return p.fileMatch("/etc/inittab", regexp.MustCompile(`::sysinit:.*openrc.*sysinit`))
 	}
 	return false
 }
@@ -91,6 +75,11 @@ func (s *openrc) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister.
+func (s *openrc) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles("/etc/init.d/*")
+}
+
 func (s *openrc) Install() error {
 	confPath, err := s.ConfigPath()
 	if err != nil {
@@ -120,9 +109,11 @@ func (s *openrc) Install() error {
 	var to = &struct {
 		*Config
 		Path string
+		Task bool
 	}{
 		s.Config,
 		path,
+		isTask(s.i),
 	}
 
 	err = s.template().Execute(f, to)
@@ -145,29 +136,22 @@ func (s *openrc) Uninstall() error {
 }
 
 func (s *openrc) Logger(errs chan<- error) (Logger, error) {
-	if system.Interactive() {
-		return ConsoleLogger, nil
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 
 func (s *openrc) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *openrc) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *openrc) Run() error {
+	return runService(s, s.i, s.Config)
+}
 
-	return s.i.Stop(s)
+func (s *openrc) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *openrc) Status() (Status, error) {
@@ -177,7 +161,7 @@ func (s *openrc) Status() (Status, error) {
 	// errno 2 = ENOENT 2 No such file or directory
 	// errno 3 = ESRCH 3 No such process
 	// for more info, see https://man7.org/linux/man-pages/man3/errno.3.html
-	_, out, err := runWithOutput("rc-service", s.Name, "status")
+	_, out, err := s.Config.runWithOutput("rc-service", s.Name, "status")
 	if err != nil {
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			// The program has exited with an exit code != 0
@@ -199,12 +183,18 @@ func (s *openrc) Status() (Status, error) {
 	return StatusRunning, nil
 }
 
+// Watch polls the status early when the PID file of the init script
+// changes.
+func (s *openrc) Watch(ctx context.Context) <-chan StatusEvent {
+	return watchStatus(ctx, s.Status, inotifyWake(ctx, "/var/run/"+s.Name+".pid"))
+}
+
 func (s *openrc) Start() error {
-	return run("rc-service", s.Name, "start")
+	return s.Config.run("rc-service", s.Name, "start")
 }
 
 func (s *openrc) Stop() error {
-	return run("rc-service", s.Name, "stop")
+	return s.Config.run("rc-service", s.Name, "stop")
 }
 
 func (s *openrc) Restart() error {
@@ -221,5 +211,68 @@ func (s *openrc) runAction(action string) error {
 }
 
 func (s *openrc) run(action string, args ...string) error {
-	return run("rc-update", append([]string{action}, args...)...)
+	return s.Config.run("rc-update", append([]string{action}, args...)...)
+}
+
+// controller implements controlOpener.
+func (s *openrc) controller() controllable {
+	return s
+}
+
+func (s *openrc) exists() (bool, error) {
+	return pathExists("/etc/init.d/" + s.Name)
+}
+
+func (s *openrc) enable() error {
+	return s.runAction("add")
+}
+
+func (s *openrc) disable() error {
+	return s.runAction("delete")
+}
+
+func (s *openrc) reload() error {
+	return s.Config.run("rc-service", s.Name, "reload")
+}
+
+// statusMany implements statusBatcher with a single rc-status, which lists
+// every service with its state.
+func (s *openrc) statusMany(names []string) (map[string]StatusInfo, error) {
+	_, out, err := s.Config.runWithOutput("rc-status", "--servicelist", "--nocolor")
+	if out == "" && err != nil {
+		return nil, err
+	}
+	states := parseRCStatus(out)
+	infos := make(map[string]StatusInfo, len(names))
+	for _, name := range names {
+		state, ok := states[name]
+		switch {
+		case !ok:
+			infos[name] = StatusInfo{Err: ErrNotInstalled}
+		case state == "started" || state == "starting" || state == "stopping":
+			infos[name] = StatusInfo{Status: StatusRunning, State: state}
+		default:
+			infos[name] = StatusInfo{Status: StatusStopped, State: state}
+		}
+	}
+	return infos, nil
+}
+
+// parseRCStatus parses lines such as " sshd   [  started  ]" into the state
+// of each service.
+func parseRCStatus(out string) map[string]string {
+	states := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		start, end := strings.LastIndex(line, "["), strings.LastIndex(line, "]")
+		if start < 0 || end < start {
+			continue
+		}
+		name := strings.Fields(line[:start])
+		state := strings.Fields(line[start+1 : end])
+		if len(name) != 1 || len(state) == 0 {
+			continue
+		}
+		states[name[0]] = state[0]
+	}
+	return states
 }
@@ -5,10 +5,11 @@
 package sysvc
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -25,8 +26,8 @@ const (
 	OptionRestartRetry            = "RestartRetry"
 )
 
-func isProcd() bool {
-	if _, err := exec.LookPath("procd"); err == nil {
+func isProcd(p *prober) bool {
+	if _, err := p.lookPath("procd"); err == nil {
 		return true
 	}
 	return false
@@ -113,7 +114,7 @@ func (p *procd) Install() error {
 }
 
 func (p *procd) Uninstall() error {
-	if err := run(p.scriptPath, "disable"); err != nil {
+	if err := p.run(p.scriptPath, "disable"); err != nil {
 		return err
 	}
 	cp, err := p.ConfigPath()
@@ -127,7 +128,7 @@ func (p *procd) Uninstall() error {
 }
 
 func (p *procd) Status() (Status, error) {
-	_, out, err := runWithOutput(p.scriptPath, "status")
+	_, out, err := p.runWithOutput(p.scriptPath, "status")
 	if err != nil && !(err.Error() == "exit status 3") {
 		return StatusUnknown, err
 	}
@@ -142,12 +143,52 @@ func (p *procd) Status() (Status, error) {
 	}
 }
 
+// Logs reads the output procd forwards to logd with logread.
+func (p *procd) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	if q.Stream != LogStreamAll {
+		return nil, fmt.Errorf("%w: logd does not tell stdout and stderr apart", ErrLogsUnsupported)
+	}
+	args := []string{"-e", p.Name}
+	if q.Lines > 0 {
+		args = append(args, "-l", strconv.Itoa(q.Lines))
+	}
+	if q.Follow {
+		args = append(args, "-f")
+	}
+	return p.commandLogs(ctx, func(line []byte) (LogEntry, bool) {
+		e, ok := parseLogread(string(line))
+		if !ok || !q.Since.IsZero() && e.Time.Before(q.Since) {
+			return LogEntry{}, false
+		}
+		return e, true
+	}, "logread", args...)
+}
+
+// parseLogread parses a line of logread output, such as
+// "Mon Jan  2 15:04:05 2006 daemon.info name[123]: message".
+func parseLogread(line string) (LogEntry, bool) {
+	const layout = "Mon Jan _2 15:04:05 2006"
+	if len(line) < len(layout) {
+		return LogEntry{}, false
+	}
+	t, err := time.ParseInLocation(layout, line[:len(layout)], time.Local)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	msg := line[len(layout):]
+	// Skip the facility.level and the tag.
+	if i := strings.Index(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	return LogEntry{Time: t, Stream: LogStreamAll, Message: msg}, true
+}
+
 func (p *procd) Start() error {
-	return run(p.scriptPath, "start")
+	return p.run(p.scriptPath, "start")
 }
 
 func (p *procd) Stop() error {
-	return run(p.scriptPath, "stop")
+	return p.run(p.scriptPath, "stop")
 }
 
 func (p *procd) Restart() error {
@@ -157,3 +198,24 @@ func (p *procd) Restart() error {
 	time.Sleep(50 * time.Millisecond)
 	return p.Start()
 }
+
+// controller implements controlOpener, overriding the one of sysv.
+func (p *procd) controller() controllable {
+	return p
+}
+
+func (p *procd) exists() (bool, error) {
+	return pathExists(p.scriptPath)
+}
+
+func (p *procd) enable() error {
+	return p.run(p.scriptPath, "enable")
+}
+
+func (p *procd) disable() error {
+	return p.run(p.scriptPath, "disable")
+}
+
+func (p *procd) reload() error {
+	return p.run(p.scriptPath, "reload")
+}
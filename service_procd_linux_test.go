@@ -0,0 +1,37 @@
+package sysvc
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseLogread(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+		ok   bool
+	}{
+		{"tagged", "Tue Jan  2 03:04:05 2024 daemon.info api[123]: listening on :80", "listening on :80", true},
+		{"colon-in-message", "Tue Jan  2 03:04:05 2024 daemon.err api[123]: error: a: b", "error: a: b", true},
+		{"short", "Tue Jan  2", "", false},
+		{"garbage", "this line is not from logread at all", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLogread(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("parseLogread() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Message != tt.want {
+				t.Errorf("Message = %q, want %q", got.Message, tt.want)
+			}
+			if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local); !got.Time.Equal(want) {
+				t.Errorf("Time = %v, want %v", got.Time, want)
+			}
+		})
+	}
+}
@@ -5,16 +5,14 @@
 package sysvc
 
 import (
-	"bytes"
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"os/signal"
+	"path/filepath"
 	"regexp"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
@@ -28,30 +26,15 @@ type rcs struct {
 	*Config
 }
 
-func isRCS() bool {
-	if _, err := os.Stat("/etc/init.d/rcS"); err != nil {
+func isRCS(p *prober) bool {
+	if err := p.stat("/etc/init.d/rcS"); err != nil {
 		return false
 	}
-	if _, err := exec.LookPath("service"); err == nil {
+	if _, err := p.lookPath("service"); err == nil {
 		return false
 	}
-	if _, err := os.Stat("/etc/inittab"); err == nil {
-		filerc, err := os.Open("/etc/inittab")
-		if err != nil {
-			return false
-		}
-		defer filerc.Close()
-
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(filerc)
-		contents := buf.String()
-
-		re := regexp.MustCompile(`::sysinit:.*rcS`)
-		matches := re.FindStringSubmatch(contents)
-		if len(matches) > 0 {
-			return true
-		}
-		return false
+	if err := p.stat("/etc/inittab"); err == nil {
+		return p.fileMatch("/etc/inittab", regexp.MustCompile(`::sysinit:.*rcS`))
 	}
 	return false
 }
@@ -89,6 +72,11 @@ func (s *rcs) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister.
+func (s *rcs) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles("/etc/init.d/*")
+}
+
 func (s *rcs) template() *template.Template {
 	customScript := s.Option.string(optionRCSScript, "")
 
@@ -107,6 +95,9 @@ func (s *rcs) Install() error {
 	if err == nil {
 		return fmt.Errorf("Init already exists: %s", confPath)
 	}
+	if err = s.installLogrotate(s.logFiles()); err != nil {
+		return err
+	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
@@ -155,36 +146,29 @@ func (s *rcs) Uninstall() error {
 	if err := os.Remove("/etc/rc.d/S50" + s.Name); err != nil {
 		return err
 	}
-	return nil
+	return s.uninstallLogrotate()
 }
 
 func (s *rcs) Logger(errs chan<- error) (Logger, error) {
-	if system.Interactive() {
-		return ConsoleLogger, nil
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 func (s *rcs) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *rcs) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *rcs) Run() error {
+	return runServiceOutput(s, s.i, s.Config, s.logFiles(), "")
+}
 
-	return s.i.Stop(s)
+func (s *rcs) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *rcs) Status() (Status, error) {
-	_, out, err := runWithOutput("/etc/init.d/"+s.Name, "status")
+	_, out, err := s.runWithOutput("/etc/init.d/"+s.Name, "status")
 	if err != nil {
 		return StatusUnknown, err
 	}
@@ -199,12 +183,26 @@ func (s *rcs) Status() (Status, error) {
 	}
 }
 
+func (s *rcs) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	return tailLogFiles(ctx, q, s.logFiles())
+}
+
+// Watch polls the status early when the PID file of the init script
+// changes.
+func (s *rcs) Watch(ctx context.Context) <-chan StatusEvent {
+	return watchStatus(ctx, s.Status, inotifyWake(ctx, "/var/run/"+s.Name+".pid"))
+}
+
+func (s *rcs) logFiles() []logFile {
+	return s.outputLogFiles(".log", ".err")
+}
+
 func (s *rcs) Start() error {
-	return run("/etc/init.d/"+s.Name, "start")
+	return s.run("/etc/init.d/"+s.Name, "start")
 }
 
 func (s *rcs) Stop() error {
-	return run("/etc/init.d/"+s.Name, "stop")
+	return s.run("/etc/init.d/"+s.Name, "stop")
 }
 
 func (s *rcs) Restart() error {
@@ -215,3 +213,45 @@ func (s *rcs) Restart() error {
 	time.Sleep(50 * time.Millisecond)
 	return s.Start()
 }
+
+// rcsControl controls init scripts that sysvc did not necessarily write.
+type rcsControl struct {
+	*rcs
+}
+
+// controller implements controlOpener.
+func (s *rcs) controller() controllable {
+	return rcsControl{s}
+}
+
+func (s rcsControl) exists() (bool, error) {
+	return pathExists("/etc/init.d/" + s.Name)
+}
+
+func (s rcsControl) Status() (Status, error) {
+	return lsbStatus(s.runWithOutput("/etc/init.d/"+s.Name, "status"))
+}
+
+func (s rcsControl) reload() error {
+	return s.run("/etc/init.d/"+s.Name, "reload")
+}
+
+func (s rcsControl) enable() error {
+	if links, _ := filepath.Glob("/etc/rc.d/S[0-9][0-9]" + s.Name); len(links) > 0 {
+		return nil
+	}
+	return os.Symlink("/etc/init.d/"+s.Name, "/etc/rc.d/S50"+s.Name)
+}
+
+func (s rcsControl) disable() error {
+	links, err := filepath.Glob("/etc/rc.d/S[0-9][0-9]" + s.Name)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		if err = os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package sysvc
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// http://smarden.org/runit/
+//
+//go:embed service_runit_linux.tmpl
+var runitScript string
+
+//go:embed service_runit_finish_linux.tmpl
+var runitFinishScript string
+
+//go:embed service_runit_log_linux.tmpl
+var runitLogScript string
+
+const runitServiceDefinitionDir = "/etc/sv"
+
+// runitEnabledDirs lists the directories runsvdir may be scanning, in the
+// order they are preferred.
+var runitEnabledDirs = []string{"/etc/service", "/var/service", "/service"}
+
+func isRunit(p *prober) bool {
+	if _, err := p.lookPath("sv"); err != nil {
+		return false
+	}
+	if _, err := p.lookPath("runsvdir"); err != nil {
+		return false
+	}
+	switch p.pid1Comm() {
+	case "runit", "runit-init":
+		return true
+	}
+	return p.isProcessRunning("runsvdir")
+}
+
+type runit struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newRunitService(i Interface, platform string, c *Config) (Service, error) {
+	s := &runit{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+
+	return s, nil
+}
+
+func (s *runit) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *runit) Platform() string {
+	return s.platform
+}
+
+var errNoUserServiceRunit = errors.New("user services are not supported on runit")
+
+// ConfigPath returns the path of the run script in the service definition directory.
+func (s *runit) ConfigPath() (cp string, err error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		err = errNoUserServiceRunit
+		return
+	}
+	cp = filepath.Join(s.definitionDir(), "run")
+	return
+}
+
+// listInstalled implements installedLister.
+func (s *runit) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles(filepath.Join(runitServiceDefinitionDir, "*", "run"))
+}
+
+func (s *runit) definitionDir() string {
+	return filepath.Join(runitServiceDefinitionDir, s.Name)
+}
+
+// enabledDir returns the directory runsvdir scans. SVDIR takes precedence,
+// as it does for sv itself.
+func (s *runit) enabledDir() string {
+	if dir := os.Getenv("SVDIR"); dir != "" {
+		return dir
+	}
+	for _, dir := range runitEnabledDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return runitEnabledDirs[0]
+}
+
+func (s *runit) enabledPath() string {
+	return filepath.Join(s.enabledDir(), s.Name)
+}
+
+func (s *runit) template() *template.Template {
+	customScript := s.Option.string(optionRunitScript, "")
+
+	if customScript != "" {
+		return template.Must(template.New("").Funcs(tf).Parse(customScript))
+	}
+	return template.Must(template.New("").Funcs(tf).Parse(runitScript))
+}
+
+func (s *runit) Install() error {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(confPath); err == nil {
+		return fmt.Errorf("Init already exists: %s", confPath)
+	}
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	logOutput := s.Option.bool(optionLogOutput, optionLogOutputDefault)
+	var to = &struct {
+		*Config
+		Path      string
+		LogOutput bool
+		LogPath   string
+		Restart   string
+	}{
+		s.Config,
+		path,
+		logOutput,
+		filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name),
+		restartPolicy(s.i, s.Option),
+	}
+
+	if err = os.MkdirAll(s.definitionDir(), 0755); err != nil {
+		return err
+	}
+	if err = writeScript(confPath, s.template(), to); err != nil {
+		return err
+	}
+	// runsv restarts the service whenever it exits, unless the finish
+	// script marks it down.
+	if to.Restart != "always" {
+		finishTemplate := template.Must(template.New("").Funcs(tf).Parse(runitFinishScript))
+		if err = writeScript(filepath.Join(s.definitionDir(), "finish"), finishTemplate, to); err != nil {
+			return err
+		}
+	}
+	if logOutput {
+		logDir := filepath.Join(s.definitionDir(), "log")
+		if err = os.MkdirAll(logDir, 0755); err != nil {
+			return err
+		}
+		logTemplate := template.Must(template.New("").Funcs(tf).Parse(runitLogScript))
+		if err = writeScript(filepath.Join(logDir, "run"), logTemplate, to); err != nil {
+			return err
+		}
+	}
+
+	// runsvdir picks up the service within a few seconds of the link appearing.
+	return os.Symlink(s.definitionDir(), s.enabledPath())
+}
+
+func (s *runit) Uninstall() error {
+	if _, err := os.Stat(s.definitionDir()); os.IsNotExist(err) {
+		return ErrNotInstalled
+	}
+	_ = s.run("sv", "down", s.enabledPath())
+	if err := os.Remove(s.enabledPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(s.definitionDir())
+}
+
+func (s *runit) Logger(errs chan<- error) (Logger, error) {
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
+	}
+	return s.serviceLogger(errs, s.SystemLogger)
+}
+
+func (s *runit) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *runit) Run() error {
+	return runService(s, s.i, s.Config)
+}
+
+func (s *runit) Close() error {
+	return s.closeLoggers()
+}
+
+func (s *runit) Status() (Status, error) {
+	if _, err := os.Stat(s.definitionDir()); os.IsNotExist(err) {
+		return StatusUnknown, ErrNotInstalled
+	}
+
+	stat, err := os.ReadFile(filepath.Join(s.enabledPath(), "supervise", "stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Installed but not (yet) supervised by runsv.
+			return StatusStopped, nil
+		}
+		return StatusUnknown, err
+	}
+	return parseRunitStat(string(stat))
+}
+
+func (s *runit) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	if !s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		return nil, ErrLogsUnsupported
+	}
+	// svlogd -tt prefixes each line with a UTC timestamp.
+	path := filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name, "current")
+	return tailLogFiles(ctx, q, []logFile{{
+		path:   path,
+		stream: LogStreamAll,
+		parse:  timestampPrefixParser("2006-01-02_15:04:05.999999999", time.UTC),
+	}})
+}
+
+// Watch polls the status early when runsv writes supervise/stat.
+func (s *runit) Watch(ctx context.Context) <-chan StatusEvent {
+	return watchStatus(ctx, s.Status, inotifyWake(ctx, filepath.Join(s.enabledPath(), "supervise", "stat")))
+}
+
+// parseRunitStat parses the contents of supervise/stat, which runsv writes
+// as "run", "down" or "finish", optionally followed by the wanted state
+// and ", paused" or ", got TERM".
+func parseRunitStat(stat string) (Status, error) {
+	state := strings.TrimSpace(stat)
+	if i := strings.IndexByte(state, ','); i >= 0 {
+		state = state[:i]
+	}
+	switch state {
+	case "run":
+		return StatusRunning, nil
+	case "down", "finish":
+		return StatusStopped, nil
+	default:
+		return StatusUnknown, fmt.Errorf("unknown runit state %q", stat)
+	}
+}
+
+func (s *runit) Start() error {
+	return s.run("sv", "up", s.enabledPath())
+}
+
+func (s *runit) Stop() error {
+	return s.run("sv", "down", s.enabledPath())
+}
+
+func (s *runit) Restart() error {
+	return s.run("sv", "restart", s.enabledPath())
+}
+
+// controller implements controlOpener.
+func (s *runit) controller() controllable {
+	return s
+}
+
+func (s *runit) exists() (bool, error) {
+	return pathExists(s.definitionDir())
+}
+
+// enable removes the down file, so runsv starts the service when it starts.
+func (s *runit) enable() error {
+	err := os.Remove(filepath.Join(s.definitionDir(), "down"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// disable creates the down file, which keeps runsv from starting the
+// service until it is told to.
+func (s *runit) disable() error {
+	return os.WriteFile(filepath.Join(s.definitionDir(), "down"), nil, 0644)
+}
+
+func (s *runit) reload() error {
+	return s.run("sv", "hup", s.enabledPath())
+}
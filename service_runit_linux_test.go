@@ -0,0 +1,31 @@
+package sysvc
+
+import "testing"
+
+func Test_parseRunitStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		stat    string
+		want    Status
+		wantErr bool
+	}{
+		{"run", "run\n", StatusRunning, false},
+		{"run-want-down", "run, want down\n", StatusRunning, false},
+		{"down", "down\n", StatusStopped, false},
+		{"finish", "finish\n", StatusStopped, false},
+		{"down-paused", "down, paused\n", StatusStopped, false},
+		{"garbage", "???\n", StatusUnknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRunitStat(tt.stat)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseRunitStat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseRunitStat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
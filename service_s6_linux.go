@@ -0,0 +1,426 @@
+package sysvc
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// https://skarnet.org/software/s6/servicedir.html
+// https://skarnet.org/software/s6-rc/s6-rc-compile.html
+//
+//go:embed service_s6_linux.tmpl
+var s6Script string
+
+//go:embed service_s6_finish_linux.tmpl
+var s6FinishScript string
+
+//go:embed service_s6_log_linux.tmpl
+var s6LogScript string
+
+const (
+	s6ServiceDefinitionDir = "/etc/s6/sv"
+	s6NotificationFD       = 3
+	s6RCLiveDirDefault     = "/run/s6-rc"
+	s6RCBundleDefault      = "default"
+)
+
+// s6ScanDirs lists the directories s6-svscan may be scanning, in the order
+// they are preferred.
+var s6ScanDirs = []string{"/run/service", "/var/run/s6/services", "/service"}
+
+func isS6(p *prober) bool {
+	if _, err := p.lookPath("s6-svscan"); err != nil {
+		return false
+	}
+	if _, err := p.lookPath("s6-svc"); err != nil {
+		return false
+	}
+	if p.pid1Comm() == "s6-svscan" {
+		return true
+	}
+	return p.isProcessRunning("s6-svscan")
+}
+
+type s6 struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newS6Service(i Interface, platform string, c *Config) (Service, error) {
+	s := &s6{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+
+	return s, nil
+}
+
+func (s *s6) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *s6) Platform() string {
+	return s.platform
+}
+
+var errNoUserServiceS6 = errors.New("user services are not supported on s6")
+
+// ConfigPath returns the path of the run script in the service directory.
+func (s *s6) ConfigPath() (cp string, err error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		err = errNoUserServiceS6
+		return
+	}
+	cp = filepath.Join(s.definitionDir(), "run")
+	return
+}
+
+// listInstalled implements installedLister. Services registered with an
+// s6-rc source directory are not found, as the source is only known from the
+// service's own options.
+func (s *s6) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles(filepath.Join(s6ServiceDefinitionDir, "*", "run"))
+}
+
+// rcSource returns the s6-rc source directory, or "" when the service is
+// registered directly with s6-svscan.
+func (s *s6) rcSource() string {
+	return s.Option.string(optionS6RCSource, "")
+}
+
+func (s *s6) definitionDir() string {
+	if source := s.rcSource(); source != "" {
+		return filepath.Join(source, s.Name)
+	}
+	return filepath.Join(s6ServiceDefinitionDir, s.Name)
+}
+
+func (s *s6) scanDir() string {
+	if dir := s.Option.string(optionS6ScanDirectory, ""); dir != "" {
+		return dir
+	}
+	for _, dir := range s6ScanDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return s6ScanDirs[0]
+}
+
+// liveDir returns the service directory s6-supervise is running.
+func (s *s6) liveDir() string {
+	if s.rcSource() != "" {
+		return filepath.Join(s6RCLiveDirDefault, "servicedirs", s.Name)
+	}
+	return filepath.Join(s.scanDir(), s.Name)
+}
+
+func (s *s6) template(custom, script string) *template.Template {
+	if customScript := s.Option.string(custom, ""); customScript != "" {
+		return template.Must(template.New("").Funcs(tf).Parse(customScript))
+	}
+	return template.Must(template.New("").Funcs(tf).Parse(script))
+}
+
+func (s *s6) Install() error {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(confPath); err == nil {
+		return fmt.Errorf("Init already exists: %s", confPath)
+	}
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	logOutput := s.Option.bool(optionLogOutput, optionLogOutputDefault)
+	var to = &struct {
+		*Config
+		Path           string
+		LogOutput      bool
+		LogPath        string
+		Restart        string
+		NotificationFD int
+	}{
+		s.Config,
+		path,
+		logOutput,
+		filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name),
+		restartPolicy(s.i, s.Option),
+		s6NotificationFD,
+	}
+
+	dir := s.definitionDir()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err = writeScript(confPath, s.template(optionS6Script, s6Script), to); err != nil {
+		return err
+	}
+	if err = writeScript(filepath.Join(dir, "finish"), s.template("", s6FinishScript), to); err != nil {
+		return err
+	}
+	// Only the default run script hands the notification fd to the program,
+	// a custom one that never writes to it would stall readiness forever.
+	if s.Option.string(optionS6Script, "") == "" {
+		if err = os.WriteFile(filepath.Join(dir, "notification-fd"), []byte(strconv.Itoa(s6NotificationFD)+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	if logOutput {
+		logDir := filepath.Join(dir, "log")
+		if err = os.MkdirAll(logDir, 0755); err != nil {
+			return err
+		}
+		if err = writeScript(filepath.Join(logDir, "run"), s.template("", s6LogScript), to); err != nil {
+			return err
+		}
+	}
+
+	if s.rcSource() != "" {
+		return s.installRC()
+	}
+	if err = os.Symlink(dir, filepath.Join(s.scanDir(), s.Name)); err != nil {
+		return err
+	}
+	return s.run("s6-svscanctl", "-a", s.scanDir())
+}
+
+// installRC adds the service to an s6-rc source database and swaps the
+// live database for a freshly compiled one.
+func (s *s6) installRC() error {
+	dir := s.definitionDir()
+	if err := os.WriteFile(filepath.Join(dir, "type"), []byte("longrun\n"), 0644); err != nil {
+		return err
+	}
+	if len(s.Dependencies) > 0 {
+		depDir := filepath.Join(dir, "dependencies.d")
+		if err := os.MkdirAll(depDir, 0755); err != nil {
+			return err
+		}
+		for _, dep := range s.Dependencies {
+			if err := os.WriteFile(filepath.Join(depDir, dep), nil, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	contents := filepath.Join(s.rcSource(), s.Option.string(optionS6RCBundle, s6RCBundleDefault), "contents.d")
+	if _, err := os.Stat(contents); err == nil {
+		if err = os.WriteFile(filepath.Join(contents, s.Name), nil, 0644); err != nil {
+			return err
+		}
+	}
+	return s.updateRC()
+}
+
+func (s *s6) updateRC() error {
+	source := s.rcSource()
+	// s6-rc-compile refuses an existing destination, so pick a name that is
+	// not taken even when several updates happen within the same instant.
+	base := filepath.Join(filepath.Dir(source), "compiled-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	compiled := base
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(compiled); os.IsNotExist(err) {
+			break
+		}
+		compiled = base + "-" + strconv.Itoa(n)
+	}
+	if err := s.run("s6-rc-compile", compiled, source); err != nil {
+		return err
+	}
+	if err := s.run("s6-rc-update", "-l", s6RCLiveDirDefault, compiled); err != nil {
+		return err
+	}
+
+	// Point the conventional "compiled" link at the new database so it is
+	// used on the next boot as well.
+	link := filepath.Join(filepath.Dir(source), "compiled")
+	tmp := link + ".new"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(compiled, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
+
+func (s *s6) Uninstall() error {
+	dir := s.definitionDir()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotInstalled
+	}
+
+	if s.rcSource() != "" {
+		_ = s.run("s6-rc", "-d", "change", s.Name)
+		contents := filepath.Join(s.rcSource(), s.Option.string(optionS6RCBundle, s6RCBundleDefault), "contents.d", s.Name)
+		if err := os.Remove(contents); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		return s.updateRC()
+	}
+
+	_ = s.run("s6-svc", "-d", s.liveDir())
+	if err := os.Remove(s.liveDir()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.run("s6-svscanctl", "-an", s.scanDir()); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *s6) Logger(errs chan<- error) (Logger, error) {
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
+	}
+	return s.serviceLogger(errs, s.SystemLogger)
+}
+
+func (s *s6) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *s6) Run() error {
+	return runService(s, s.i, s.Config)
+}
+
+func (s *s6) Close() error {
+	return s.closeLoggers()
+}
+
+func (s *s6) Status() (Status, error) {
+	if _, err := os.Stat(s.definitionDir()); os.IsNotExist(err) {
+		return StatusUnknown, ErrNotInstalled
+	}
+
+	liveDir := s.liveDir()
+	if _, err := os.Stat(liveDir); os.IsNotExist(err) {
+		// Not picked up by s6-svscan or s6-rc yet.
+		return StatusStopped, nil
+	}
+	code, out, err := s.runWithOutput("s6-svstat", liveDir)
+	if err != nil {
+		if code == s6SvstatUnsupervised {
+			return StatusStopped, nil
+		}
+		return StatusUnknown, err
+	}
+	return parseS6Svstat(out)
+}
+
+// s6SvstatUnsupervised is the exit code of s6-svstat when no s6-supervise
+// runs on the directory.
+const s6SvstatUnsupervised = 1
+
+func (s *s6) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	if !s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		return nil, ErrLogsUnsupported
+	}
+	// s6-log T prefixes each line with a local ISO 8601 timestamp.
+	path := filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name, "current")
+	return tailLogFiles(ctx, q, []logFile{{
+		path:   path,
+		stream: LogStreamAll,
+		parse:  timestampPrefixParser("2006-01-02T15:04:05.999999999", time.Local),
+	}})
+}
+
+// Watch polls the status early when s6-supervise writes supervise/status.
+func (s *s6) Watch(ctx context.Context) <-chan StatusEvent {
+	return watchStatus(ctx, s.Status, inotifyWake(ctx, filepath.Join(s.liveDir(), "supervise", "status")))
+}
+
+// parseS6Svstat parses the output of s6-svstat, for example
+// "up (pid 1234) 56 seconds, normally up, ready 50 seconds" or
+// "down (exitcode 0) 3 seconds, normally up".
+func parseS6Svstat(out string) (Status, error) {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return StatusUnknown, errors.New("empty s6-svstat output")
+	}
+	switch fields[0] {
+	case "up":
+		return StatusRunning, nil
+	case "down":
+		return StatusStopped, nil
+	default:
+		return StatusUnknown, fmt.Errorf("unknown s6 state %q", out)
+	}
+}
+
+func (s *s6) Start() error {
+	if s.rcSource() != "" {
+		return s.run("s6-rc", "-u", "change", s.Name)
+	}
+	return s.run("s6-svc", "-u", s.liveDir())
+}
+
+func (s *s6) Stop() error {
+	if s.rcSource() != "" {
+		return s.run("s6-rc", "-d", "change", s.Name)
+	}
+	return s.run("s6-svc", "-d", s.liveDir())
+}
+
+func (s *s6) Restart() error {
+	if s.rcSource() != "" {
+		if err := s.run("s6-rc", "-d", "change", s.Name); err != nil {
+			return err
+		}
+		return s.run("s6-rc", "-u", "change", s.Name)
+	}
+	return s.run("s6-svc", "-r", s.liveDir())
+}
+
+// controller implements controlOpener.
+func (s *s6) controller() controllable {
+	return s
+}
+
+func (s *s6) exists() (bool, error) {
+	return pathExists(s.definitionDir())
+}
+
+// enable removes the down file, so s6-supervise starts the service when it
+// starts. Services of an s6-rc database are started by their bundle instead.
+func (s *s6) enable() error {
+	if s.rcSource() != "" {
+		return ErrControlUnsupported
+	}
+	err := os.Remove(filepath.Join(s.definitionDir(), "down"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// disable creates the down file.
+func (s *s6) disable() error {
+	if s.rcSource() != "" {
+		return ErrControlUnsupported
+	}
+	return os.WriteFile(filepath.Join(s.definitionDir(), "down"), nil, 0644)
+}
+
+func (s *s6) reload() error {
+	return s.run("s6-svc", "-h", s.liveDir())
+}
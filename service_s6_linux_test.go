@@ -0,0 +1,63 @@
+package sysvc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseS6Svstat(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    Status
+		wantErr bool
+	}{
+		{"up", "up (pid 1234) 56 seconds, normally up, ready 50 seconds\n", StatusRunning, false},
+		{"down-exitcode", "down (exitcode 0) 3 seconds, normally up, ready 3 seconds\n", StatusStopped, false},
+		{"down-signal", "down (signal SIGTERM) 1 seconds, normally up, want up\n", StatusStopped, false},
+		{"empty", "", StatusUnknown, true},
+		{"garbage", "s6-svstat: fatal: unable to read status", StatusUnknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseS6Svstat(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseS6Svstat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseS6Svstat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS6Restart(t *testing.T) {
+	tests := []struct {
+		name   string
+		option KeyValue
+		want   []string
+	}{
+		{"svscan", KeyValue{"S6ScanDirectory": "/run/service"}, []string{"s6-svc -r /run/service/app"}},
+		{"s6-rc", KeyValue{"S6RCSource": "/etc/s6-rc/source"}, []string{"s6-rc -d change app", "s6-rc -u change app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &recordingRunner{}
+			m := &Manager{
+				System: NewSystem("test-s6", func() bool { return true }, func() bool { return false }, newS6Service),
+				Runner: runner,
+			}
+			s, err := m.New(nil, &Config{Name: "app", Option: tt.option})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = s.Restart(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(runner.commands, tt.want) {
+				t.Errorf("Restart() ran %q, want %q", runner.commands, tt.want)
+			}
+		})
+	}
+}
@@ -10,9 +10,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"os/signal"
 	"regexp"
-	"syscall"
+	"strings"
 	"text/template"
 	"time"
 )
@@ -86,6 +85,7 @@ func (s *solarisService) template() *template.Template {
 			}
 			return "false"
 		},
+		"sysvcMarker": sysvcMarker,
 	}
 
 	customConfig := s.Option.string(optionSysvScript, "")
@@ -101,6 +101,11 @@ func (s *solarisService) ConfigPath() (string, error) {
 	return "/lib/svc/manifest/" + s.Prefix + "/" + s.Config.Name + ".xml", nil
 }
 
+// listInstalled implements installedLister.
+func (s *solarisService) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles("/lib/svc/manifest/*/*.xml")
+}
+
 func (s *solarisService) getFMRI() string {
 	return "svc:/" + s.Prefix + "/" + s.Config.Name + ":default"
 }
@@ -149,7 +154,7 @@ func (s *solarisService) Install() error {
 	}
 
 	// import service
-	err = run("svcadm", "restart", "manifest-import")
+	err = s.run("svcadm", "restart", "manifest-import")
 	if err != nil {
 		return err
 	}
@@ -169,7 +174,7 @@ func (s *solarisService) Uninstall() error {
 	}
 
 	// unregister service
-	err = run("svcadm", "restart", "manifest-import")
+	err = s.run("svcadm", "restart", "manifest-import")
 	if err != nil {
 		return err
 	}
@@ -179,7 +184,7 @@ func (s *solarisService) Uninstall() error {
 
 func (s *solarisService) Status() (Status, error) {
 	fmri := s.getFMRI()
-	exitCode, out, err := runWithOutput("svcs", fmri)
+	exitCode, out, err := s.runWithOutput("svcs", fmri)
 	if exitCode != 0 {
 		return StatusUnknown, ErrNotInstalled
 	}
@@ -198,10 +203,10 @@ func (s *solarisService) Status() (Status, error) {
 }
 
 func (s *solarisService) Start() error {
-	return run("/usr/sbin/svcadm", "enable", s.getFMRI())
+	return s.run("/usr/sbin/svcadm", "enable", s.getFMRI())
 }
 func (s *solarisService) Stop() error {
-	return run("/usr/sbin/svcadm", "disable", s.getFMRI())
+	return s.run("/usr/sbin/svcadm", "disable", s.getFMRI())
 }
 func (s *solarisService) Restart() error {
 	if err := s.Stop(); err != nil {
@@ -214,28 +219,84 @@ func (s *solarisService) Restart() error {
 }
 
 func (s *solarisService) Run() error {
-	var err error
-
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+	return runService(s, s.i, s.Config)
+}
 
-	return s.i.Stop(s)
+func (s *solarisService) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *solarisService) Logger(errs chan<- error) (Logger, error) {
 	if interactive {
-		return ConsoleLogger, nil
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 func (s *solarisService) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
+
+// solarisControl controls SMF services. Start and Stop only enable and
+// disable the service until the next boot, Enable and Disable for good.
+type solarisControl struct {
+	*solarisService
+}
+
+// controller implements controlOpener. The name may also be a full FMRI,
+// such as svc:/network/ssh:default.
+func (s *solarisService) controller() controllable {
+	return solarisControl{s}
+}
+
+func (s solarisControl) fmri() string {
+	if strings.HasPrefix(s.Name, "svc:/") {
+		return s.Name
+	}
+	return s.getFMRI()
+}
+
+func (s solarisControl) exists() (bool, error) {
+	exitCode, _, err := s.runWithOutput("svcs", "-H", "-o", "state", s.fmri())
+	if err != nil && exitCode == 0 {
+		return false, err
+	}
+	return exitCode == 0, nil
+}
+
+func (s solarisControl) Status() (Status, error) {
+	_, out, err := s.runWithOutput("svcs", "-H", "-o", "state", s.fmri())
+	if err != nil {
+		return StatusUnknown, err
+	}
+	switch strings.TrimSpace(out) {
+	case "online", "degraded":
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
+func (s solarisControl) Start() error {
+	return s.run("/usr/sbin/svcadm", "enable", "-t", s.fmri())
+}
+
+func (s solarisControl) Stop() error {
+	return s.run("/usr/sbin/svcadm", "disable", "-t", s.fmri())
+}
+
+func (s solarisControl) Restart() error {
+	return s.run("/usr/sbin/svcadm", "restart", s.fmri())
+}
+
+func (s solarisControl) enable() error {
+	return s.run("/usr/sbin/svcadm", "enable", s.fmri())
+}
+
+func (s solarisControl) disable() error {
+	return s.run("/usr/sbin/svcadm", "disable", s.fmri())
+}
+
+// reload refreshes the service, which reads its configuration again and
+// runs its refresh method.
+func (s solarisControl) reload() error {
+	return s.run("/usr/sbin/svcadm", "refresh", s.fmri())
+}
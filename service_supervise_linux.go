@@ -0,0 +1,512 @@
+package sysvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sysvc-supervise is a small supervisor built into the program itself, for
+// when no service manager is available, typically in containers. It never
+// detects itself and has to be chosen with SYSVC_SYSTEM or
+// ChooseSystemByName; the processes it starts inherit the choice.
+//
+// Start re-executes the program with envSuperviseState set. Run notices the
+// variable and, instead of running the Interface, becomes the supervisor: it
+// starts the program again as a child, captures its output, writes PID files
+// and restarts it according to the Restart option until it is told to stop.
+const (
+	envSuperviseState = "SYSVC_SUPERVISE_STATE"
+	envSupervised     = "SYSVC_SUPERVISED"
+
+	superviseStateDir     = "/var/lib/sysvc"
+	superviseDefinition   = "service.json"
+	supervisePIDFile      = "supervise.pid"
+	superviseStopTimeout  = 20 * time.Second
+	superviseStartTimeout = 5 * time.Second
+)
+
+// isSupervised reports whether the program was started by sysvc-supervise.
+func isSupervised() bool {
+	return os.Getenv(envSupervised) == "1"
+}
+
+func superviseInteractive() (bool, string) {
+	if isSupervised() {
+		return false, envSupervised + " is set by sysvc-supervise"
+	}
+	return true, envSupervised + " is not set"
+}
+
+// superviseDefinitionFile is what Install records in the state directory.
+type superviseDefinitionFile struct {
+	Name             string            `json:"name"`
+	Path             string            `json:"path"`
+	Arguments        []string          `json:"arguments,omitempty"`
+	EnvVars          map[string]string `json:"env,omitempty"`
+	WorkingDirectory string            `json:"workingDirectory,omitempty"`
+	UserName         string            `json:"userName,omitempty"`
+	Restart          string            `json:"restart"`
+	RestartSec       int               `json:"restartSec"`
+	// Sysvc is the marker ListInstalled looks for.
+	Sysvc json.RawMessage `json:"sysvc,omitempty"`
+}
+
+type supervise struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newSuperviseService(i Interface, platform string, c *Config) (Service, error) {
+	s := &supervise{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+
+	return s, nil
+}
+
+func (s *supervise) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *supervise) Platform() string {
+	return s.platform
+}
+
+// stateDir returns the directory holding the definition, PID files and logs.
+func (s *supervise) stateDir() (string, error) {
+	if dir := s.Option.string(optionSuperviseStateDirectory, ""); dir != "" {
+		return filepath.Join(dir, s.Name), nil
+	}
+	if !s.Option.bool(optionUserService, optionUserServiceDefault) {
+		return filepath.Join(superviseStateDir, s.Name), nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "sysvc", s.Name), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".local/state/sysvc", s.Name), nil
+}
+
+func (s *supervise) ConfigPath() (string, error) {
+	dir, err := s.stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, superviseDefinition), nil
+}
+
+// listInstalled implements installedLister for system and user state
+// directories. Services with the SuperviseStateDirectory option set are not
+// found.
+func (s *supervise) listInstalled() ([]InstalledService, error) {
+	dirs := []string{superviseStateDir}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		dirs = append(dirs, filepath.Join(dir, "sysvc"))
+	} else if homeDir, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(homeDir, ".local/state/sysvc"))
+	}
+	var list []InstalledService
+	for _, dir := range dirs {
+		paths, err := filepath.Glob(filepath.Join(dir, "*", superviseDefinition))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			def, err := readSuperviseDefinition(filepath.Dir(path))
+			if err != nil || len(def.Sysvc) == 0 {
+				continue
+			}
+			if m, err := decodeMarker(def.Sysvc); err == nil {
+				list = append(list, m.installedService(path))
+			}
+		}
+	}
+	return list, nil
+}
+
+func (s *supervise) Install() error {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(confPath); err == nil {
+		return fmt.Errorf("Init already exists: %s", confPath)
+	}
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	def := superviseDefinitionFile{
+		Name:             s.Name,
+		Path:             path,
+		Arguments:        s.Arguments,
+		EnvVars:          s.EnvVars,
+		WorkingDirectory: s.WorkingDirectory,
+		UserName:         s.UserName,
+		Restart:          restartPolicy(s.i, s.Option),
+		RestartSec:       s.Option.int(optionRestartSec, optionRestartSecDefault),
+		Sysvc:            s.markerJSON(),
+	}
+	data, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(confPath, data, 0644)
+}
+
+func (s *supervise) Uninstall() error {
+	dir, err := s.stateDir()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(filepath.Join(dir, superviseDefinition)); os.IsNotExist(err) {
+		return ErrNotInstalled
+	}
+	if err = s.Stop(); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *supervise) Logger(errs chan<- error) (Logger, error) {
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
+	}
+	return s.serviceLogger(errs, s.SystemLogger)
+}
+
+func (s *supervise) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *supervise) Run() error {
+	if dir := os.Getenv(envSuperviseState); dir != "" {
+		os.Unsetenv(envSuperviseState)
+		return superviseLoop(dir)
+	}
+	return runService(s, s.i, s.Config)
+}
+
+func (s *supervise) Close() error {
+	return s.closeLoggers()
+}
+
+func (s *supervise) readDefinition() (string, *superviseDefinitionFile, error) {
+	dir, err := s.stateDir()
+	if err != nil {
+		return "", nil, err
+	}
+	def, err := readSuperviseDefinition(dir)
+	return dir, def, err
+}
+
+func readSuperviseDefinition(dir string) (*superviseDefinitionFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, superviseDefinition))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotInstalled
+		}
+		return nil, err
+	}
+	def := &superviseDefinitionFile{}
+	if err = json.Unmarshal(data, def); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+func (s *supervise) Status() (Status, error) {
+	dir, def, err := s.readDefinition()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if !pidFileAlive(filepath.Join(dir, supervisePIDFile)) {
+		return StatusStopped, nil
+	}
+	if !pidFileAlive(filepath.Join(dir, def.Name+".pid")) {
+		// The supervisor is waiting to restart the program.
+		return StatusStopped, nil
+	}
+	return StatusRunning, nil
+}
+
+func (s *supervise) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	dir, err := s.stateDir()
+	if err != nil {
+		return nil, err
+	}
+	return tailLogFiles(ctx, q, []logFile{
+		{path: filepath.Join(dir, s.Name+".log"), stream: LogStreamStdout},
+		{path: filepath.Join(dir, s.Name+".err"), stream: LogStreamStderr},
+	})
+}
+
+// Watch polls the status early when the supervisor or the program write or
+// remove their PID files.
+func (s *supervise) Watch(ctx context.Context) <-chan StatusEvent {
+	dir, err := s.stateDir()
+	if err != nil {
+		return watchStatus(ctx, s.Status, nil)
+	}
+	return watchStatus(ctx, s.Status, inotifyWake(ctx,
+		filepath.Join(dir, supervisePIDFile), filepath.Join(dir, s.Name+".pid")))
+}
+
+func (s *supervise) Start() error {
+	dir, def, err := s.readDefinition()
+	if err != nil {
+		return err
+	}
+	pidFile := filepath.Join(dir, supervisePIDFile)
+	if pidFileAlive(pidFile) {
+		return nil
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+
+	cmd := exec.Command(def.Path, def.Arguments...)
+	cmd.Env = append(os.Environ(), envSuperviseState+"="+dir, envSystem+"=sysvc-supervise")
+	cmd.Stdin = devNull
+	cmd.Stdout = devNull
+	cmd.Stderr = devNull
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	// The supervisor outlives this process; do not leave a zombie behind
+	// should it exit early.
+	go cmd.Wait()
+
+	deadline := time.Now().Add(superviseStartTimeout)
+	for time.Now().Before(deadline) {
+		if pidFileAlive(pidFile) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errors.New("supervisor did not start")
+}
+
+func (s *supervise) Stop() error {
+	dir, _, err := s.readDefinition()
+	if err != nil {
+		return err
+	}
+	pid, err := readPIDFile(filepath.Join(dir, supervisePIDFile))
+	if err != nil || !processAlive(pid) {
+		return nil
+	}
+	if err = syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(superviseStopTimeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("supervisor (pid %d) did not stop", pid)
+}
+
+func (s *supervise) Restart() error {
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	return s.Start()
+}
+
+// superviseLoop is the body of the supervisor process.
+func superviseLoop(dir string) error {
+	def, err := readSuperviseDefinition(dir)
+	if err != nil {
+		return err
+	}
+
+	pidFile := filepath.Join(dir, supervisePIDFile)
+	if err = writePIDFile(pidFile, os.Getpid()); err != nil {
+		return err
+	}
+	defer os.Remove(pidFile)
+
+	stdout, err := os.OpenFile(filepath.Join(dir, def.Name+".log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.OpenFile(filepath.Join(dir, def.Name+".err"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+
+	var credential *syscall.Credential
+	if def.UserName != "" {
+		if credential, err = lookupCredential(def.UserName); err != nil {
+			return err
+		}
+	}
+
+	sigChan := make(chan os.Signal, 3)
+	signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigChan)
+
+	childPIDFile := filepath.Join(dir, def.Name+".pid")
+	for {
+		cmd := exec.Command(def.Path, def.Arguments...)
+		cmd.Dir = def.WorkingDirectory
+		cmd.Env = append(os.Environ(), envSupervised+"=1", envSystem+"=sysvc-supervise")
+		for k, v := range def.EnvVars {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: credential}
+
+		if err = cmd.Start(); err != nil {
+			fmt.Fprintf(stderr, "sysvc-supervise: %v\n", err)
+		} else {
+			writePIDFile(childPIDFile, cmd.Process.Pid)
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+
+			select {
+			case err = <-exited:
+				os.Remove(childPIDFile)
+			case <-sigChan:
+				stopChild(cmd.Process, exited)
+				os.Remove(childPIDFile)
+				return nil
+			}
+		}
+
+		if !shouldRestart(def.Restart, err) {
+			return nil
+		}
+		select {
+		case <-time.After(time.Duration(def.RestartSec) * time.Second):
+		case <-sigChan:
+			return nil
+		}
+	}
+}
+
+// stopChild asks the child to stop and kills it if it does not.
+func stopChild(p *os.Process, exited <-chan error) {
+	p.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(superviseStopTimeout / 2):
+		p.Kill()
+		<-exited
+	}
+}
+
+// shouldRestart applies a Restart policy to the way the program exited.
+func shouldRestart(policy string, exitErr error) bool {
+	switch policy {
+	case "no":
+		return false
+	case "on-success":
+		return exitErr == nil
+	case "on-failure", "on-abnormal", "on-abort":
+		return exitErr != nil
+	default:
+		return true
+	}
+}
+
+func lookupCredential(userName string) (*syscall.Credential, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+func writePIDFile(path string, pid int) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0644)
+}
+
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func pidFileAlive(path string) bool {
+	pid, err := readPIDFile(path)
+	return err == nil && processAlive(pid)
+}
+
+// controller implements controlOpener.
+func (s *supervise) controller() controllable {
+	return s
+}
+
+func (s *supervise) exists() (bool, error) {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return false, err
+	}
+	return pathExists(confPath)
+}
+
+// enable returns ErrControlUnsupported: sysvc-supervise does not start
+// anything at boot.
+func (s *supervise) enable() error {
+	return ErrControlUnsupported
+}
+
+func (s *supervise) disable() error {
+	return ErrControlUnsupported
+}
@@ -0,0 +1,81 @@
+package sysvc
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_shouldRestart(t *testing.T) {
+	failed := errors.New("exit status 1")
+	tests := []struct {
+		policy string
+		err    error
+		want   bool
+	}{
+		{"always", nil, true},
+		{"always", failed, true},
+		{"no", failed, false},
+		{"on-failure", nil, false},
+		{"on-failure", failed, true},
+		{"on-success", nil, true},
+		{"on-success", failed, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRestart(tt.policy, tt.err); got != tt.want {
+			t.Errorf("shouldRestart(%q, %v) = %v, want %v", tt.policy, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSuperviseInstallStatus(t *testing.T) {
+	s, _ := newSuperviseService(nil, "sysvc-supervise", &Config{
+		Name:       "go_supervise_test",
+		Executable: "/bin/true",
+		Option: KeyValue{
+			optionSuperviseStateDirectory: t.TempDir(),
+		},
+	})
+
+	if _, err := s.Status(); err != ErrNotInstalled {
+		t.Fatalf("Status() before Install err = %v, want ErrNotInstalled", err)
+	}
+	if err := s.Install(); err != nil {
+		t.Fatal("Install", err)
+	}
+	if err := s.Install(); err == nil {
+		t.Error("second Install succeeded")
+	}
+	if status, err := s.Status(); err != nil || status != StatusStopped {
+		t.Errorf("Status() = %v, %v; want StatusStopped", status, err)
+	}
+	if err := s.Uninstall(); err != nil {
+		t.Fatal("Uninstall", err)
+	}
+	if _, err := s.Status(); err != ErrNotInstalled {
+		t.Errorf("Status() after Uninstall err = %v, want ErrNotInstalled", err)
+	}
+}
+
+func TestSuperviseListInstalled(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	s, _ := newSuperviseService(nil, "sysvc-supervise", &Config{
+		Name:       "go_supervise_list",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionUserService: true, optionRestart: "always"},
+	})
+	if err := s.Install(); err != nil {
+		t.Fatal("Install", err)
+	}
+
+	list, err := s.(*supervise).listInstalled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("listInstalled() = %+v, want one service", list)
+	}
+	if got := list[0]; got.Name != "go_supervise_list" || got.Version != Version ||
+		got.Config.Executable != "/bin/true" || got.Config.Option.string(optionRestart, "") != "always" {
+		t.Errorf("listInstalled() = %+v, config %+v", got, got.Config)
+	}
+}
@@ -0,0 +1,326 @@
+package sysvc
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// http://supervisord.org/configuration.html#program-x-section-settings
+//
+//go:embed service_supervisord_linux.tmpl
+var supervisordConfig string
+
+// supervisordIncludeDirs lists the include directories of the common
+// distribution packages, in the order they are preferred.
+var supervisordIncludeDirs = []string{"/etc/supervisor/conf.d", "/etc/supervisord.d"}
+
+func isSupervisord(p *prober) bool {
+	if _, err := p.lookPath("supervisorctl"); err != nil {
+		return false
+	}
+	return p.isProcessRunning("supervisord")
+}
+
+type supervisord struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newSupervisordService(i Interface, platform string, c *Config) (Service, error) {
+	s := &supervisord{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+
+	return s, nil
+}
+
+func (s *supervisord) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *supervisord) Platform() string {
+	return s.platform
+}
+
+var errNoUserServiceSupervisord = errors.New("user services are not supported on supervisord")
+
+func (s *supervisord) includeDir() string {
+	if dir := s.Option.string(optionSupervisordIncludeDirectory, ""); dir != "" {
+		return dir
+	}
+	for _, dir := range supervisordIncludeDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return supervisordIncludeDirs[0]
+}
+
+func (s *supervisord) ConfigPath() (cp string, err error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		err = errNoUserServiceSupervisord
+		return
+	}
+	dir := s.includeDir()
+	// RedHat packages only include *.ini files.
+	if dir == "/etc/supervisord.d" {
+		cp = filepath.Join(dir, s.Name+".ini")
+		return
+	}
+	cp = filepath.Join(dir, s.Name+".conf")
+	return
+}
+
+// listInstalled implements installedLister.
+func (s *supervisord) listInstalled() ([]InstalledService, error) {
+	var patterns []string
+	for _, dir := range supervisordIncludeDirs {
+		patterns = append(patterns, filepath.Join(dir, "*.conf"), filepath.Join(dir, "*.ini"))
+	}
+	return listInstalledFiles(patterns...)
+}
+
+func (s *supervisord) template() *template.Template {
+	customConfig := s.Option.string(optionSupervisordConfig, "")
+
+	if customConfig != "" {
+		return template.Must(template.New("").Funcs(tf).Parse(customConfig))
+	}
+	return template.Must(template.New("").Funcs(tf).Parse(supervisordConfig))
+}
+
+// supervisordAutoRestart maps a Restart option onto autorestart.
+func supervisordAutoRestart(restart string) string {
+	switch restart {
+	case "no":
+		return "false"
+	case "on-failure", "on-abnormal":
+		return "unexpected"
+	default:
+		return "true"
+	}
+}
+
+// supervisordEnvironment renders env in the KEY="value",... form.
+func supervisordEnvironment(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`%`, `%%`, `"`, `\"`).Replace(env[k])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s *supervisord) Install() error {
+	confPath, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(confPath); err == nil {
+		return fmt.Errorf("Init already exists: %s", confPath)
+	}
+
+	f, err := os.Create(confPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Path              string
+		Environment       string
+		AutoRestart       string
+		Task              bool
+		SuccessExitStatus string
+		StopSignal        string
+		LogOutput         bool
+		LogDirectory      string
+	}{
+		s.Config,
+		path,
+		supervisordEnvironment(s.EnvVars),
+		supervisordAutoRestart(restartPolicy(s.i, s.Option)),
+		isTask(s.i),
+		strings.Join(strings.Fields(s.Option.string(optionSuccessExitStatus, "")), ","),
+		s.Option.string(optionStopSignal, "TERM"),
+		s.Option.bool(optionLogOutput, optionLogOutputDefault),
+		s.Option.string(optionLogDirectory, defaultLogDirectory),
+	}
+
+	if err = s.template().Execute(f, to); err != nil {
+		return err
+	}
+	return s.update()
+}
+
+func (s *supervisord) Uninstall() error {
+	cp, err := s.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(cp); err != nil {
+		return err
+	}
+	return s.update()
+}
+
+// update makes supervisord pick up added, changed and removed program files.
+func (s *supervisord) update() error {
+	if err := s.ctl("reread"); err != nil {
+		return err
+	}
+	return s.ctl("update")
+}
+
+func (s *supervisord) Logger(errs chan<- error) (Logger, error) {
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
+	}
+	return s.serviceLogger(errs, s.SystemLogger)
+}
+
+func (s *supervisord) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *supervisord) Run() error {
+	return runService(s, s.i, s.Config)
+}
+
+func (s *supervisord) Close() error {
+	return s.closeLoggers()
+}
+
+func (s *supervisord) Status() (Status, error) {
+	// supervisorctl exits non-zero for any program that is not running,
+	// so rely on the output instead.
+	_, out, err := s.runWithOutput("supervisorctl", s.ctlArgs("status", s.Name)...)
+	if out == "" && err != nil {
+		return StatusUnknown, err
+	}
+	return parseSupervisorctlStatus(s.Name, out)
+}
+
+func (s *supervisord) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	if !s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		return nil, ErrLogsUnsupported
+	}
+	return tailLogFiles(ctx, q, s.outputLogFiles(".log", ".err"))
+}
+
+// parseSupervisorctlStatus parses a line of `supervisorctl status`, such as
+// "name    RUNNING   pid 123, uptime 0:01:02".
+func parseSupervisorctlStatus(name, out string) (Status, error) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if strings.TrimSuffix(fields[0], ":") != name {
+			continue
+		}
+		switch fields[1] {
+		case "RUNNING", "STARTING", "BACKOFF", "STOPPING":
+			return StatusRunning, nil
+		case "STOPPED", "EXITED":
+			return StatusStopped, nil
+		case "FATAL":
+			return StatusUnknown, errors.New("service in fatal state")
+		case "ERROR":
+			// "name: ERROR (no such process)"
+			return StatusUnknown, ErrNotInstalled
+		default:
+			return StatusUnknown, fmt.Errorf("unknown supervisord state %q", fields[1])
+		}
+	}
+	return StatusUnknown, ErrNotInstalled
+}
+
+func (s *supervisord) Start() error {
+	return s.ctl("start", s.Name)
+}
+
+func (s *supervisord) Stop() error {
+	return s.ctl("stop", s.Name)
+}
+
+func (s *supervisord) Restart() error {
+	return s.ctl("restart", s.Name)
+}
+
+func (s *supervisord) ctlArgs(args ...string) []string {
+	if conf := s.Option.string(optionSupervisordConfigFile, ""); conf != "" {
+		return append([]string{"-c", conf}, args...)
+	}
+	return args
+}
+
+func (s *supervisord) ctl(args ...string) error {
+	return s.run("supervisorctl", s.ctlArgs(args...)...)
+}
+
+// controller implements controlOpener.
+func (s *supervisord) controller() controllable {
+	return s
+}
+
+// exists asks supervisord about the program. If supervisorctl cannot tell,
+// the program is taken to exist, and the action reports the error.
+func (s *supervisord) exists() (bool, error) {
+	_, err := s.Status()
+	return err != ErrNotInstalled, nil
+}
+
+// enable returns ErrControlUnsupported: programs start with supervisord as
+// their autostart setting says.
+func (s *supervisord) enable() error {
+	return ErrControlUnsupported
+}
+
+func (s *supervisord) disable() error {
+	return ErrControlUnsupported
+}
+
+func (s *supervisord) reload() error {
+	return s.ctl("signal", "HUP", s.Name)
+}
+
+// statusMany implements statusBatcher with a single supervisorctl status,
+// which lists every program.
+func (s *supervisord) statusMany(names []string) (map[string]StatusInfo, error) {
+	_, out, err := s.runWithOutput("supervisorctl", s.ctlArgs("status")...)
+	if out == "" && err != nil {
+		return nil, err
+	}
+	infos := make(map[string]StatusInfo, len(names))
+	for _, name := range names {
+		status, err := parseSupervisorctlStatus(name, out)
+		infos[name] = StatusInfo{Status: status, Err: err}
+	}
+	return infos, nil
+}
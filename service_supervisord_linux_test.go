@@ -0,0 +1,138 @@
+package sysvc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_parseSupervisorctlStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    Status
+		wantErr bool
+	}{
+		{"running", "foo                              RUNNING   pid 123, uptime 0:01:02\n", StatusRunning, false},
+		{"starting", "foo                              STARTING  \n", StatusRunning, false},
+		{"stopped", "foo                              STOPPED   Jan 02 03:04 PM\n", StatusStopped, false},
+		{"exited", "foo                              EXITED    Jan 02 03:04 PM\n", StatusStopped, false},
+		{"fatal", "foo                              FATAL     Exited too quickly\n", StatusUnknown, true},
+		{"no-such-process", "foo: ERROR (no such process)\n", StatusUnknown, true},
+		{"other-program", "foobar                           RUNNING   pid 123, uptime 0:01:02\n", StatusUnknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSupervisorctlStatus("foo", tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSupervisorctlStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseSupervisorctlStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const supervisordTestConfig = `[unix_http_server]
+file=%[1]s/supervisor.sock
+
+[supervisord]
+pidfile=%[1]s/supervisord.pid
+logfile=%[1]s/supervisord.log
+childlogdir=%[1]s
+
+[rpcinterface:supervisor]
+supervisor.rpcinterface_factory = supervisor.rpcinterface:make_main_rpcinterface
+
+[supervisorctl]
+serverurl=unix://%[1]s/supervisor.sock
+
+[include]
+files = %[1]s/conf.d/*.conf
+`
+
+// TestSupervisordService drives a locally started supervisord.
+func TestSupervisordService(t *testing.T) {
+	if _, err := exec.LookPath("supervisord"); err != nil {
+		t.Skip("supervisord not found in PATH")
+	}
+	if _, err := exec.LookPath("supervisorctl"); err != nil {
+		t.Skip("supervisorctl not found in PATH")
+	}
+
+	dir := t.TempDir()
+	includeDir := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(includeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	confFile := filepath.Join(dir, "supervisord.conf")
+	if err := os.WriteFile(confFile, []byte(fmt.Sprintf(supervisordTestConfig, dir)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	daemon := exec.Command("supervisord", "-n", "-c", confFile)
+	if err := daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		daemon.Process.Kill()
+		daemon.Wait()
+	}()
+
+	s, _ := newSupervisordService(nil, "linux-supervisord", &Config{
+		Name:       "go_supervisord_test",
+		Executable: "/bin/sleep",
+		Arguments:  []string{"60"},
+		Option: KeyValue{
+			optionSupervisordConfigFile:       confFile,
+			optionSupervisordIncludeDirectory: includeDir,
+		},
+	})
+
+	// Wait for supervisord to accept connections.
+	for i := 0; ; i++ {
+		if err := run("supervisorctl", "-c", confFile, "pid"); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatal("supervisord did not start")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := s.Status(); err != ErrNotInstalled {
+		t.Fatalf("Status() before Install err = %v, want ErrNotInstalled", err)
+	}
+	if err := s.Install(); err != nil {
+		t.Fatal("Install", err)
+	}
+	defer s.Uninstall()
+
+	waitStatus := func(want Status) {
+		t.Helper()
+		var got Status
+		var err error
+		for i := 0; i < 50; i++ {
+			if got, err = s.Status(); err == nil && got == want {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("Status() = %v, %v; want %v", got, err, want)
+	}
+
+	waitStatus(StatusRunning)
+	if err := s.Stop(); err != nil {
+		t.Fatal("Stop", err)
+	}
+	waitStatus(StatusStopped)
+	if err := s.Start(); err != nil {
+		t.Fatal("Start", err)
+	}
+	waitStatus(StatusRunning)
+}
@@ -0,0 +1,294 @@
+package sysvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The names systemd is reached under on D-Bus.
+const (
+	systemdBusName          = "org.freedesktop.systemd1"
+	systemdBusPath          = "/org/freedesktop/systemd1"
+	systemdManagerInterface = "org.freedesktop.systemd1.Manager"
+	systemdUnitInterface    = "org.freedesktop.systemd1.Unit"
+	systemdServiceInterface = "org.freedesktop.systemd1.Service"
+)
+
+// dialBus connects to the bus of the systemd instance managing the service.
+func (s *systemd) dialBus(ctx context.Context) (*dbusConn, error) {
+	addr := systemBusAddress()
+	if s.isUserService() {
+		addr = sessionBusAddress()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return dialDBus(ctx, addr)
+}
+
+// systemdJobTimeout bounds how long a start, stop, restart or reload over
+// D-Bus waits for its job to finish.
+var systemdJobTimeout = 5 * time.Minute
+
+// systemdConn is the connection to systemd the operations of a service
+// share. It is dialed on first use, and again once it is lost.
+type systemdConn struct {
+	mu   sync.Mutex
+	conn *dbusConn
+	// failed is set once the bus could not be reached; systemctl is used
+	// from then on.
+	failed bool
+	// subscribed counts the jobs waiting for the signals of the manager on
+	// conn.
+	subscribed int
+}
+
+// bus returns the connection to systemd if the SystemdDBus option is set
+// and the bus can be reached. Otherwise it returns nil, and systemctl is
+// used. Why the bus could not be reached is logged once.
+func (s *systemd) bus() *systemdBus {
+	if !s.Option.bool(optionSystemdDBus, optionSystemdDBusDefault) {
+		return nil
+	}
+	c := &s.dbus
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed {
+		return nil
+	}
+	if c.conn != nil {
+		select {
+		case <-c.conn.done:
+			c.conn, c.subscribed = nil, 0
+		default:
+		}
+	}
+	if c.conn == nil {
+		conn, err := s.dialBus(context.Background())
+		if err != nil {
+			c.failed = true
+			if l, lerr := s.Logger(nil); lerr == nil {
+				l.Warningf("Cannot control %s over D-Bus, using systemctl: %v", s.unitName(), err)
+			}
+			return nil
+		}
+		c.conn = conn
+	}
+	return &systemdBus{conn: c.conn, ctx: context.Background(), shared: c}
+}
+
+// Close closes the connection to systemd, if any, and the Loggers of the
+// service.
+func (s *systemd) Close() error {
+	s.dbus.mu.Lock()
+	if s.dbus.conn != nil {
+		s.dbus.conn.Close()
+		s.dbus.conn = nil
+	}
+	s.dbus.mu.Unlock()
+	return s.closeLoggers()
+}
+
+// systemdBus calls the methods of the systemd manager over D-Bus, in place
+// of running systemctl.
+type systemdBus struct {
+	conn   *dbusConn
+	ctx    context.Context
+	shared *systemdConn
+}
+
+// call calls a method of the manager.
+func (b *systemdBus) call(method, sig string, args ...interface{}) ([]interface{}, error) {
+	return b.conn.call(b.ctx, systemdBusName, systemdBusPath, systemdManagerInterface, method, sig, args...)
+}
+
+// version returns the Version property of the manager, such as "255.4-1".
+func (b *systemdBus) version() (string, error) {
+	v, err := b.conn.getProperty(b.ctx, systemdBusName, systemdBusPath, systemdManagerInterface, "Version")
+	if err != nil {
+		return "", err
+	}
+	version, _ := v.(string)
+	return version, nil
+}
+
+// unitPath returns the object of unit, loading it if needed. Units without
+// a unit file are loaded with the LoadState not-found.
+func (b *systemdBus) unitPath(unit string) (string, error) {
+	body, err := b.call("LoadUnit", "s", unit)
+	if err != nil {
+		return "", err
+	}
+	if len(body) != 1 {
+		return "", errors.New("dbus: bad reply to LoadUnit")
+	}
+	path, _ := body[0].(string)
+	return path, nil
+}
+
+// properties returns the properties named of an interface of unit.
+func (b *systemdBus) properties(unit, iface string, names ...string) (map[string]interface{}, error) {
+	path, err := b.unitPath(unit)
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		v, err := b.conn.getProperty(b.ctx, systemdBusName, path, iface, name)
+		if err != nil {
+			return nil, err
+		}
+		props[name] = v
+	}
+	return props, nil
+}
+
+func (b *systemdBus) exists(unit string) (bool, error) {
+	props, err := b.properties(unit, systemdUnitInterface, "LoadState")
+	if err != nil {
+		return false, err
+	}
+	return props["LoadState"] != "not-found", nil
+}
+
+func (b *systemdBus) status(unit string) (Status, error) {
+	props, err := b.properties(unit, systemdUnitInterface, "LoadState", "ActiveState")
+	if err != nil {
+		return StatusUnknown, err
+	}
+	e := systemdStatusEvent(props)
+	return e.Status, e.Err
+}
+
+// statusInfo returns the StatusInfo of unit, as statusMany does from the
+// output of systemctl show.
+func (b *systemdBus) statusInfo(unit string) (StatusInfo, error) {
+	props, err := b.properties(unit, systemdUnitInterface, "LoadState", "ActiveState", "SubState")
+	if err != nil {
+		return StatusInfo{}, err
+	}
+	show := map[string]string{}
+	for k, v := range props {
+		show[k], _ = v.(string)
+	}
+	if show["LoadState"] != "not-found" {
+		pid, err := b.properties(unit, systemdServiceInterface, "MainPID")
+		if err != nil {
+			return StatusInfo{}, err
+		}
+		if v, ok := pid["MainPID"].(uint32); ok {
+			show["MainPID"] = strconv.FormatUint(uint64(v), 10)
+		}
+	}
+	return systemdStatusInfo(show), nil
+}
+
+// job calls one of the methods of the manager starting a job on unit, such
+// as StartUnit, and waits for the job to finish, as systemctl does, for up
+// to systemdJobTimeout.
+func (b *systemdBus) job(method, unit string) error {
+	ctx, cancel := context.WithTimeout(b.ctx, systemdJobTimeout)
+	defer cancel()
+	signals := make(chan *dbusMessage, 16)
+	defer b.conn.subscribe(signals)()
+	rule := "type='signal',sender='" + systemdBusName + "',interface='" + systemdManagerInterface + "'," +
+		"member='JobRemoved',arg2='" + unit + "'"
+	if err := b.conn.addMatch(ctx, rule); err != nil {
+		return err
+	}
+	// The job may have timed out, so undoing the match has its own
+	// timeout.
+	defer func() {
+		ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+		defer cancel()
+		b.conn.removeMatch(ctx, rule)
+	}()
+	if err := b.subscribe(ctx); err != nil {
+		return err
+	}
+	defer b.unsubscribe()
+
+	body, err := b.conn.call(ctx, systemdBusName, systemdBusPath, systemdManagerInterface, method, "ss", unit, "replace")
+	if err != nil {
+		return err
+	}
+	if len(body) != 1 {
+		return fmt.Errorf("dbus: bad reply to %s", method)
+	}
+	job, _ := body[0].(string)
+	for {
+		select {
+		case m := <-signals:
+			// JobRemoved carries the id, object, unit and result of
+			// the job.
+			if m.member != "JobRemoved" || len(m.body) != 4 || m.body[1] != job {
+				continue
+			}
+			if result, _ := m.body[3].(string); result != "done" {
+				return fmt.Errorf("job for %s failed: %s", unit, result)
+			}
+			return nil
+		case <-b.conn.done:
+			return errDBusClosed
+		case <-ctx.Done():
+			return fmt.Errorf("job for %s: %w", unit, ctx.Err())
+		}
+	}
+}
+
+// subscribe asks systemd for the signals of the manager, which it only
+// sends while a client is subscribed. The jobs sharing a connection share
+// the subscription.
+func (b *systemdBus) subscribe(ctx context.Context) error {
+	b.shared.mu.Lock()
+	defer b.shared.mu.Unlock()
+	if b.shared.conn != b.conn {
+		return errDBusClosed
+	}
+	if b.shared.subscribed == 0 {
+		if _, err := b.conn.call(ctx, systemdBusName, systemdBusPath, systemdManagerInterface, "Subscribe", ""); err != nil {
+			return err
+		}
+	}
+	b.shared.subscribed++
+	return nil
+}
+
+// unsubscribe undoes subscribe, unsubscribing once no job is waiting.
+func (b *systemdBus) unsubscribe() {
+	b.shared.mu.Lock()
+	defer b.shared.mu.Unlock()
+	if b.shared.conn != b.conn {
+		return
+	}
+	if b.shared.subscribed--; b.shared.subscribed == 0 {
+		ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+		defer cancel()
+		b.conn.call(ctx, systemdBusName, systemdBusPath, systemdManagerInterface, "Unsubscribe", "")
+	}
+}
+
+// enable makes unit start at boot and reloads systemd, as systemctl enable
+// does.
+func (b *systemdBus) enable(unit string) error {
+	if _, err := b.call("EnableUnitFiles", "asbb", []string{unit}, false, false); err != nil {
+		return err
+	}
+	return b.reload()
+}
+
+func (b *systemdBus) disable(unit string) error {
+	if _, err := b.call("DisableUnitFiles", "asb", []string{unit}, false); err != nil {
+		return err
+	}
+	return b.reload()
+}
+
+// reload reloads the unit files, as systemctl daemon-reload does.
+func (b *systemdBus) reload() error {
+	_, err := b.call("Reload", "")
+	return err
+}
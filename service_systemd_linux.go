@@ -5,53 +5,40 @@
 package sysvc
 
 import (
-	"bytes"
+	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"syscall"
 	"text/template"
+	"time"
 )
 
 //go:embed service_systemd_linux.tmpl
 var systemdConfig string
 
-func isSystemd() bool {
-	if _, err := os.Stat("/run/systemd/system"); err == nil {
+func isSystemd(p *prober) bool {
+	if err := p.stat("/run/systemd/system"); err == nil {
 		return true
 	}
-	if _, err := exec.LookPath("systemctl"); err != nil {
+	if _, err := p.lookPath("systemctl"); err != nil {
 		return false
 	}
-	if _, err := os.Stat("/proc/1/comm"); err == nil {
-		filerc, err := os.Open("/proc/1/comm")
-		if err != nil {
-			return false
-		}
-		defer filerc.Close()
-
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(filerc)
-		contents := buf.String()
-
-		if strings.Trim(contents, " \r\n") == "systemd" {
-			return true
-		}
-	}
-	return false
+	return p.pid1Comm() == "systemd"
 }
 
 type systemd struct {
 	i        Interface
 	platform string
 	*Config
+
+	// dbus is the connection to systemd with the SystemdDBus option.
+	dbus systemdConn
 }
 
 func newSystemdService(i Interface, platform string, c *Config) (Service, error) {
@@ -93,14 +80,30 @@ func (s *systemd) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister for system and user units.
+func (s *systemd) listInstalled() ([]InstalledService, error) {
+	patterns := append([]string{"/etc/systemd/system/*.service"}, userConfigPatterns(".config/systemd/user/*.service")...)
+	return listInstalledFiles(patterns...)
+}
+
 func (s *systemd) unitName() string {
 	return s.Config.Name + ".service"
 }
 
 func (s *systemd) getSystemdVersion() int64 {
-	_, out, err := s.runWithOutput("systemctl", "--version")
-	if err != nil {
-		return -1
+	var out string
+	if b := s.bus(); b != nil {
+		version, err := b.version()
+		if err != nil {
+			return -1
+		}
+		// Version lacks the "systemd" systemctl --version starts with.
+		out = "systemd " + version
+	} else {
+		var err error
+		if _, out, err = s.runWithOutput("systemctl", "--version"); err != nil {
+			return -1
+		}
 	}
 
 	re := regexp.MustCompile(`systemd ([0-9]+)`)
@@ -126,12 +129,16 @@ func (s *systemd) hasOutputFileSupport() bool {
 }
 
 func (s *systemd) template() *template.Template {
+	return s.parseTemplate(tf)
+}
+
+func (s *systemd) parseTemplate(funcs map[string]interface{}) *template.Template {
 	customScript := s.Option.string(optionSystemdScript, "")
 
 	if customScript != "" {
-		return template.Must(template.New("").Funcs(tf).Parse(customScript))
+		return template.Must(template.New("").Funcs(funcs).Parse(customScript))
 	}
-	return template.Must(template.New("").Funcs(tf).Parse(systemdConfig))
+	return template.Must(template.New("").Funcs(funcs).Parse(systemdConfig))
 }
 
 func (s *systemd) isUserService() bool {
@@ -158,7 +165,28 @@ func (s *systemd) Install() error {
 		return err
 	}
 
-	var to = &struct {
+	err = s.template().Execute(f, s.templateData(path))
+	if err != nil {
+		return err
+	}
+
+	err = s.enable()
+	if err != nil {
+		return err
+	}
+
+	return s.daemonReload()
+}
+
+// templateData returns what the unit template is rendered with, path being
+// the executable.
+func (s *systemd) templateData(path string) interface{} {
+	restart := restartPolicy(s.i, s.Option)
+	if isTask(s.i) && restart == "always" {
+		// systemd refuses Restart=always for Type=oneshot units.
+		restart = "on-failure"
+	}
+	return &struct {
 		*Config
 		Path                 string
 		HasOutputFileSupport bool
@@ -170,6 +198,8 @@ func (s *systemd) Install() error {
 		LogOutput            bool
 		LogDirectory         string
 		RestartSec           int
+		Task                 bool
+		RemainAfterExit      bool
 	}{
 		s.Config,
 		path,
@@ -177,28 +207,88 @@ func (s *systemd) Install() error {
 		s.Option.string(optionReloadSignal, ""),
 		s.Option.string(optionPIDFile, ""),
 		s.Option.int(optionLimitNOFILE, optionLimitNOFILEDefault),
-		s.Option.string(optionRestart, "always"),
+		restart,
 		s.Option.string(optionSuccessExitStatus, ""),
 		s.Option.bool(optionLogOutput, optionLogOutputDefault),
 		s.Option.string(optionLogDirectory, defaultLogDirectory),
 		s.Option.int(optionRestartSec, optionRestartSecDefault),
+		isTask(s.i),
+		s.Option.bool(optionRemainAfterExit, optionRemainAfterExitDefault),
 	}
+}
+
+// transientTf renders the unit template for systemd-run, which takes the
+// values of properties without the quoting of unit files.
+var transientTf = map[string]interface{}{
+	"cmd":         func(s string) string { return s },
+	"cmdEscape":   func(s string) string { return s },
+	"sysvcMarker": sysvcMarker,
+}
 
-	err = s.template().Execute(f, to)
+// StartTransient implements TransientStarter with systemd-run, which
+// turns the settings of the unit template into the properties of a
+// transient unit. It returns once the unit has started, or for tasks once
+// they have finished. The unit is gone once it stops, unless it failed.
+func (s *systemd) StartTransient(ctx context.Context) error {
+	args, err := s.transientArgs()
 	if err != nil {
 		return err
 	}
+	_, _, err = s.runContext(ctx, "systemd-run", args...)
+	return err
+}
 
-	err = s.runAction("enable")
+// transientArgs returns the arguments of systemd-run starting the service
+// with the settings of the unit template. ExecStart is taken from the
+// Config rather than the template, so that arguments need not be quoted.
+func (s *systemd) transientArgs() ([]string, error) {
+	path, err := s.execPath()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	unit := &strings.Builder{}
+	if err = s.parseTemplate(transientTf).Execute(unit, s.templateData(path)); err != nil {
+		return nil, err
 	}
 
-	return s.run("daemon-reload")
+	args := []string{"--unit", s.unitName()}
+	if s.isUserService() {
+		args = append(args, "--user")
+	}
+	section := ""
+	for _, line := range strings.Split(unit.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section == "Install" {
+			continue
+		}
+		switch key {
+		case "ExecStart":
+			continue
+		case "Description":
+			if value != "" {
+				args = append(args, "--description", value)
+			}
+			continue
+		case "StartLimitInterval":
+			// Transient units only know the name with the unit.
+			key = "StartLimitIntervalSec"
+		}
+		args = append(args, "--property", key+"="+value)
+	}
+	args = append(args, "--", path)
+	return append(args, s.Arguments...), nil
 }
 
 func (s *systemd) Uninstall() error {
-	if err := s.runAction("disable"); err != nil {
+	if err := s.disable(); err != nil {
 		return err
 	}
 
@@ -210,34 +300,33 @@ func (s *systemd) Uninstall() error {
 	if err = os.Remove(cp); err != nil {
 		return err
 	}
-	return s.run("daemon-reload")
+	return s.daemonReload()
 }
 
 func (s *systemd) Logger(errs chan<- error) (Logger, error) {
-	if system.Interactive() {
-		return ConsoleLogger, nil
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 func (s *systemd) SystemLogger(errs chan<- error) (Logger, error) {
+	if useJournal() {
+		if j, err := NewJournalLogger(s.Name, errs); err == nil {
+			return j, nil
+		}
+	}
 	return newSysLogger(s.Name, errs)
 }
 
 func (s *systemd) Run() error {
-	if err := s.i.Start(s); err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
-
-	return s.i.Stop(s)
+	return runService(s, s.i, s.Config)
 }
 
 func (s *systemd) Status() (Status, error) {
+	if b := s.bus(); b != nil {
+		return b.status(s.unitName())
+	}
+
 	exitCode, out, err := s.runWithOutput("systemctl", "is-active", s.unitName())
 	if exitCode == 0 && err != nil {
 		return StatusUnknown, err
@@ -267,32 +356,369 @@ func (s *systemd) Status() (Status, error) {
 	}
 }
 
+func (s *systemd) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) && s.hasOutputFileSupport() {
+		return tailLogFiles(ctx, q, s.outputLogFiles(".log", ".err"))
+	}
+	if q.Stream != LogStreamAll {
+		return nil, fmt.Errorf("%w: the journal does not tell stdout and stderr apart", ErrLogsUnsupported)
+	}
+
+	args := []string{"--unit", s.unitName(), "--output", "json", "--no-pager"}
+	if s.isUserService() {
+		args = append(args, "--user")
+	}
+	switch {
+	case q.Lines > 0:
+		args = append(args, "--lines", strconv.Itoa(q.Lines))
+	case q.Follow:
+		// --follow would otherwise start with the last 10 entries.
+		args = append(args, "--lines", "all")
+	}
+	if !q.Since.IsZero() {
+		args = append(args, "--since", fmt.Sprintf("@%d.%06d", q.Since.Unix(), q.Since.Nanosecond()/1000))
+	}
+	if q.Follow {
+		args = append(args, "--follow")
+	}
+	return s.commandLogs(ctx, parseJournalJSON, "journalctl", args...)
+}
+
+// systemdWatchBackoff bounds how long Watch polls the status before trying
+// to reach the bus again. The wait doubles with each failed attempt.
+var (
+	systemdWatchBackoffMin = time.Second
+	systemdWatchBackoffMax = time.Minute
+)
+
+// Watch follows the PropertiesChanged signals of the unit over D-Bus. While
+// the bus cannot be reached, or after the connection is lost, the status is
+// polled, and the bus tried again with backoff.
+func (s *systemd) Watch(ctx context.Context) <-chan StatusEvent {
+	events := make(chan StatusEvent)
+	go func() {
+		defer close(events)
+		last := StatusEvent{State: -1}
+		backoff := systemdWatchBackoffMin
+		for {
+			if conn, err := s.dialBus(ctx); err == nil {
+				var watched bool
+				last, watched = s.watchBus(ctx, conn, events, last)
+				conn.Close()
+				if watched {
+					backoff = systemdWatchBackoffMin
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			pollCtx, cancel := context.WithTimeout(ctx, backoff)
+			last = pollStatus(pollCtx, events, last, s.Status, nil)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if backoff *= 2; backoff > systemdWatchBackoffMax {
+				backoff = systemdWatchBackoffMax
+			}
+		}
+	}()
+	return events
+}
+
+// watchBus sends the changes of the unit since last on events until ctx is
+// done or conn fails. It returns the last event sent, and whether it got as
+// far as watching the unit.
+func (s *systemd) watchBus(ctx context.Context, conn *dbusConn, events chan<- StatusEvent, last StatusEvent) (StatusEvent, bool) {
+	signals := make(chan *dbusMessage, 64)
+	defer conn.subscribe(signals)()
+
+	// systemd only emits the signals of units while a client is
+	// subscribed.
+	if _, err := conn.call(ctx, systemdBusName, systemdBusPath, systemdManagerInterface, "Subscribe", ""); err != nil {
+		return last, false
+	}
+	body, err := conn.call(ctx, systemdBusName, systemdBusPath, systemdManagerInterface, "LoadUnit", "s", s.unitName())
+	if err != nil || len(body) != 1 {
+		return last, false
+	}
+	path, _ := body[0].(string)
+	rule := "type='signal',sender='" + systemdBusName + "',interface='org.freedesktop.DBus.Properties'," +
+		"member='PropertiesChanged',path='" + path + "'"
+	if err = conn.addMatch(ctx, rule); err != nil {
+		return last, false
+	}
+
+	props := map[string]interface{}{}
+	getAll := func(iface string) bool {
+		all, err := conn.getAllProperties(ctx, systemdBusName, path, iface)
+		for k, v := range all {
+			props[k] = v
+		}
+		return err == nil
+	}
+	if !getAll(systemdUnitInterface) || !getAll(systemdServiceInterface) {
+		return last, false
+	}
+	for {
+		if e := systemdStatusEvent(props); e.changed(last) {
+			if !sendEvent(ctx, events, e) {
+				return last, true
+			}
+			last = e
+		}
+		select {
+		case m := <-signals:
+			if m.path != path || m.member != "PropertiesChanged" || len(m.body) != 3 {
+				continue
+			}
+			changed, _ := m.body[1].(map[string]interface{})
+			for k, v := range changed {
+				props[k] = v
+			}
+			// Properties too costly to send are only named.
+			if invalidated, _ := m.body[2].([]interface{}); len(invalidated) > 0 {
+				iface, _ := m.body[0].(string)
+				if !getAll(iface) {
+					return last, true
+				}
+			}
+		case <-conn.done:
+			return last, true
+		case <-ctx.Done():
+			return last, true
+		}
+	}
+}
+
+// systemdStatusEvent returns the event for the D-Bus properties of a
+// service unit.
+func systemdStatusEvent(props map[string]interface{}) StatusEvent {
+	e := StatusEvent{Time: time.Now(), ExitCode: -1}
+	loadState, _ := props["LoadState"].(string)
+	if loadState == "not-found" {
+		e.Err = ErrNotInstalled
+		return e
+	}
+	if pid, ok := props["MainPID"].(uint32); ok {
+		e.PID = int(pid)
+	}
+	switch state, _ := props["ActiveState"].(string); state {
+	case "activating":
+		e.State, e.Status = StateStarting, StatusRunning
+	case "active", "reloading":
+		e.State, e.Status = StateRunning, StatusRunning
+	case "deactivating":
+		e.State, e.Status = StateStopping, StatusRunning
+	case "inactive":
+		e.State, e.Status = StateStopped, StatusStopped
+	case "failed":
+		e.State, e.Err = StateFailed, errors.New("service in failed state")
+		if result, _ := props["Result"].(string); result != "" && result != "success" {
+			e.Err = fmt.Errorf("service in failed state: %s", result)
+		}
+	default:
+		e.Err = fmt.Errorf("unknown systemd state %q", state)
+		return e
+	}
+
+	if e.State == StateStopped || e.State == StateFailed {
+		// ExecMainCode is the si_code of the exit: CLD_EXITED, or
+		// CLD_KILLED and CLD_DUMPED for signals.
+		status, _ := props["ExecMainStatus"].(int32)
+		switch code, _ := props["ExecMainCode"].(int32); code {
+		case 1:
+			e.ExitCode = int(status)
+		case 2, 3:
+			e.Signal = int(status)
+		}
+	}
+	return e
+}
+
+// parseJournalJSON parses a line of `journalctl --output json`. MESSAGE is
+// a string, an array of bytes if it is not valid UTF-8, or null if it is
+// too large.
+func parseJournalJSON(line []byte) (LogEntry, bool) {
+	var fields struct {
+		Timestamp string          `json:"__REALTIME_TIMESTAMP"`
+		Message   json.RawMessage `json:"MESSAGE"`
+	}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return LogEntry{}, false
+	}
+	usec, err := strconv.ParseInt(fields.Timestamp, 10, 64)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	e := LogEntry{Time: time.UnixMicro(usec), Stream: LogStreamAll}
+	if err = json.Unmarshal(fields.Message, &e.Message); err != nil {
+		var raw []int
+		if err = json.Unmarshal(fields.Message, &raw); err == nil {
+			b := make([]byte, len(raw))
+			for i, c := range raw {
+				b[i] = byte(c)
+			}
+			e.Message = string(b)
+		}
+	}
+	return e, true
+}
+
 func (s *systemd) Start() error {
-	return s.runAction("start")
+	return s.job("StartUnit", "start")
 }
 
 func (s *systemd) Stop() error {
-	return s.runAction("stop")
+	return s.job("StopUnit", "stop")
 }
 
 func (s *systemd) Restart() error {
-	return s.runAction("restart")
+	return s.job("RestartUnit", "restart")
 }
 
 func (s *systemd) runWithOutput(command string, arguments ...string) (int, string, error) {
 	if s.isUserService() {
 		arguments = append(arguments, "--user")
 	}
-	return runWithOutput(command, arguments...)
+	return s.Config.runWithOutput(command, arguments...)
 }
 
 func (s *systemd) run(action string, args ...string) error {
 	if s.isUserService() {
-		return run("systemctl", append([]string{action, "--user"}, args...)...)
+		return s.Config.run("systemctl", append([]string{action, "--user"}, args...)...)
 	}
-	return run("systemctl", append([]string{action}, args...)...)
+	return s.Config.run("systemctl", append([]string{action}, args...)...)
 }
 
 func (s *systemd) runAction(action string) error {
 	return s.run(action, s.unitName())
 }
+
+// job runs a job on the unit with method over D-Bus, or with action if
+// systemctl is used.
+func (s *systemd) job(method, action string) error {
+	if b := s.bus(); b != nil {
+		return b.job(method, s.unitName())
+	}
+	return s.runAction(action)
+}
+
+func (s *systemd) daemonReload() error {
+	if b := s.bus(); b != nil {
+		return b.reload()
+	}
+	return s.run("daemon-reload")
+}
+
+// controller implements controlOpener. The name may also be given with the
+// .service suffix.
+func (s *systemd) controller() controllable {
+	s.Name = strings.TrimSuffix(s.Name, ".service")
+	return s
+}
+
+func (s *systemd) exists() (bool, error) {
+	if b := s.bus(); b != nil {
+		return b.exists(s.unitName())
+	}
+	_, out, err := s.runWithOutput("systemctl", "show", "-p", "LoadState", s.unitName())
+	if err != nil {
+		return false, err
+	}
+	return !strings.Contains(out, "LoadState=not-found"), nil
+}
+
+func (s *systemd) enable() error {
+	if b := s.bus(); b != nil {
+		return b.enable(s.unitName())
+	}
+	return s.runAction("enable")
+}
+
+func (s *systemd) disable() error {
+	if b := s.bus(); b != nil {
+		return b.disable(s.unitName())
+	}
+	return s.runAction("disable")
+}
+
+func (s *systemd) reload() error {
+	return s.job("ReloadUnit", "reload")
+}
+
+// statusMany implements statusBatcher with a single systemctl show.
+func (s *systemd) statusMany(names []string) (map[string]StatusInfo, error) {
+	units := make([]string, len(names))
+	for i, name := range names {
+		units[i] = strings.TrimSuffix(name, ".service") + ".service"
+	}
+	if b := s.bus(); b != nil {
+		infos := make(map[string]StatusInfo, len(names))
+		for i, name := range names {
+			info, err := b.statusInfo(units[i])
+			if err != nil {
+				info = StatusInfo{Err: err}
+			}
+			infos[name] = info
+		}
+		return infos, nil
+	}
+	args := append([]string{"show", "-p", "Id", "-p", "LoadState", "-p", "ActiveState", "-p", "SubState", "-p", "MainPID"}, units...)
+	_, out, err := s.runWithOutput("systemctl", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSystemctlShow(names, units, out), nil
+}
+
+// parseSystemctlShow parses the properties systemctl show prints for units,
+// one block per unit in the order they were given, into the StatusInfo of
+// names.
+func parseSystemctlShow(names, units []string, out string) map[string]StatusInfo {
+	var blocks []map[string]string
+	byID := map[string]map[string]string{}
+	for _, block := range strings.Split(strings.TrimSpace(out), "\n\n") {
+		props := map[string]string{}
+		for _, line := range strings.Split(block, "\n") {
+			if key, value, found := strings.Cut(line, "="); found {
+				props[key] = value
+			}
+		}
+		blocks = append(blocks, props)
+		byID[props["Id"]] = props
+	}
+
+	infos := make(map[string]StatusInfo, len(names))
+	for i, name := range names {
+		// Aliases are shown under the Id of the unit they point to, so
+		// the order is relied on when every unit has a block.
+		props := byID[units[i]]
+		if len(blocks) == len(units) {
+			props = blocks[i]
+		}
+		infos[name] = systemdStatusInfo(props)
+	}
+	return infos
+}
+
+func systemdStatusInfo(props map[string]string) StatusInfo {
+	if props == nil || props["LoadState"] == "not-found" {
+		return StatusInfo{Err: ErrNotInstalled}
+	}
+	info := StatusInfo{State: props["SubState"]}
+	if pid, err := strconv.Atoi(props["MainPID"]); err == nil {
+		info.PID = pid
+	}
+	switch props["ActiveState"] {
+	case "active", "activating", "reloading", "deactivating":
+		info.Status = StatusRunning
+	case "inactive":
+		info.Status = StatusStopped
+	case "failed":
+		info.Err = errors.New("service in failed state")
+	default:
+		info.Err = fmt.Errorf("unknown systemd state %q", props["ActiveState"])
+	}
+	return info
+}
@@ -0,0 +1,572 @@
+package sysvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_parseJournalJSON(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		want string
+		ok   bool
+	}{
+		{"string", `{"__REALTIME_TIMESTAMP":"1704164645123456","MESSAGE":"started"}`, "started", true},
+		{"bytes", `{"__REALTIME_TIMESTAMP":"1704164645123456","MESSAGE":[104,105,255]}`, "hi\xff", true},
+		{"null", `{"__REALTIME_TIMESTAMP":"1704164645123456","MESSAGE":null}`, "", true},
+		{"no-timestamp", `{"MESSAGE":"x"}`, "", false},
+		{"invalid", `not json`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseJournalJSON([]byte(tt.line))
+			if ok != tt.ok {
+				t.Fatalf("parseJournalJSON() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Message != tt.want {
+				t.Errorf("Message = %q, want %q", got.Message, tt.want)
+			}
+			if !got.Time.Equal(ts) {
+				t.Errorf("Time = %v, want %v", got.Time, ts)
+			}
+		})
+	}
+}
+
+// streamingRunner is a scriptedRunner that also implements streamRunner,
+// answering with the same outputs.
+type streamingRunner struct {
+	scriptedRunner
+}
+
+func (r *streamingRunner) Stream(ctx context.Context, command string, arguments ...string) (io.ReadCloser, error) {
+	_, out, err := r.Run(command, arguments...)
+	return ioutil.NopCloser(strings.NewReader(out)), err
+}
+
+func TestSystemdLogs(t *testing.T) {
+	const journal = `{"__REALTIME_TIMESTAMP":"1704164645123456","MESSAGE":"started"}
+not json
+{"__REALTIME_TIMESTAMP":"1704164646000000","MESSAGE":"stopped"}
+`
+	out := map[string]string{"journalctl": journal}
+	for _, runner := range []interface {
+		CommandRunner
+		lines() []string
+	}{
+		&scriptedRunner{out: out},
+		&streamingRunner{scriptedRunner{out: out}},
+	} {
+		m := &Manager{
+			System: NewSystem("test-systemd", func() bool { return true }, func() bool { return false }, newSystemdService),
+			Runner: runner,
+		}
+		s, err := m.New(nil, &Config{Name: "app"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, err := Logs(context.Background(), s, LogQuery{Lines: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for e := range ch {
+			got = append(got, e.Message)
+		}
+		if want := []string{"started", "stopped"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: Logs() = %q, want %q", runner, got, want)
+		}
+		commands := runner.lines()
+		if got, want := commands[len(commands)-1], "journalctl --unit app.service --output json --no-pager --lines 5"; got != want {
+			t.Errorf("%T: ran %q, want %q", runner, got, want)
+		}
+	}
+}
+
+func Test_parseSystemctlShow(t *testing.T) {
+	names := []string{"nginx", "sshd.service", "gone", "broken"}
+	units := []string{"nginx.service", "sshd.service", "gone.service", "broken.service"}
+	out := "Id=nginx.service\nLoadState=loaded\nActiveState=active\nSubState=running\nMainPID=42\n\n" +
+		"Id=ssh.service\nLoadState=loaded\nActiveState=inactive\nSubState=dead\nMainPID=0\n\n" +
+		"Id=gone.service\nLoadState=not-found\nActiveState=inactive\nSubState=dead\nMainPID=0\n\n" +
+		"Id=broken.service\nLoadState=loaded\nActiveState=failed\nSubState=failed\nMainPID=0\n"
+	infos := parseSystemctlShow(names, units, out)
+
+	tests := []struct {
+		name   string
+		status Status
+		state  string
+		pid    int
+		err    bool
+	}{
+		{"nginx", StatusRunning, "running", 42, false},
+		{"sshd.service", StatusStopped, "dead", 0, false},
+		{"gone", StatusUnknown, "", 0, true},
+		{"broken", StatusUnknown, "failed", 0, true},
+	}
+	for _, tt := range tests {
+		info := infos[tt.name]
+		if info.Status != tt.status || info.State != tt.state || info.PID != tt.pid || (info.Err != nil) != tt.err {
+			t.Errorf("%s: %+v", tt.name, info)
+		}
+	}
+	if infos["gone"].Err != ErrNotInstalled {
+		t.Errorf("gone: Err = %v, want ErrNotInstalled", infos["gone"].Err)
+	}
+}
+
+// systemdStub stands in for the systemd manager on a test bus. Units not in
+// units are not found.
+type systemdStub struct {
+	conn *dbusConn
+	// stopBus stops the bus, dropping the connections to it.
+	stopBus func()
+
+	mu sync.Mutex
+	// units holds the properties of the units, of all interfaces.
+	units map[string]map[string]interface{}
+	// jobResult is the result of the jobs started, "done" if empty.
+	jobResult string
+	// hangJobs keeps the jobs started from finishing.
+	hangJobs bool
+	calls    []string
+}
+
+// startSystemdStub starts a bus with a stub systemd on it and makes it the
+// system bus.
+func startSystemdStub(t *testing.T, ctx context.Context) *systemdStub {
+	t.Helper()
+	addr, stopBus := startDBusDaemon(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", addr)
+	conn, err := dialDBus(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	stub := &systemdStub{conn: conn, stopBus: stopBus, units: map[string]map[string]interface{}{}}
+	conn.handle(stub.handle)
+	if err = conn.requestName(ctx, systemdBusName); err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+func systemdStubPath(unit string) string {
+	return "/org/freedesktop/systemd1/unit/" + strings.ReplaceAll(unit, ".", "_2e")
+}
+
+func (s *systemdStub) props(path string) map[string]interface{} {
+	for unit, props := range s.units {
+		if systemdStubPath(unit) == path {
+			return props
+		}
+	}
+	return map[string]interface{}{"LoadState": "not-found", "ActiveState": "inactive", "SubState": "dead", "MainPID": uint32(0)}
+}
+
+func (s *systemdStub) handle(m *dbusMessage) (string, []interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	call := m.member
+	for _, arg := range m.body {
+		call += fmt.Sprint(" ", arg)
+	}
+	s.calls = append(s.calls, call)
+
+	switch m.member {
+	case "Subscribe", "Unsubscribe", "Reload":
+		return "", nil, nil
+	case "LoadUnit":
+		return "o", []interface{}{dbusObjectPath(systemdStubPath(m.body[0].(string)))}, nil
+	case "Get":
+		if m.path == systemdBusPath && m.body[1] == "Version" {
+			return "v", []interface{}{"255.4-1"}, nil
+		}
+		v, ok := s.props(m.path)[m.body[1].(string)]
+		if !ok {
+			return "", nil, &dbusCallError{name: "org.freedesktop.DBus.Error.UnknownProperty"}
+		}
+		return "v", []interface{}{v}, nil
+	case "GetAll":
+		return "a{sv}", []interface{}{s.props(m.path)}, nil
+	case "StartUnit", "StopUnit", "RestartUnit", "ReloadUnit":
+		job := dbusObjectPath("/org/freedesktop/systemd1/job/" + strconv.Itoa(len(s.calls)))
+		result := s.jobResult
+		if result == "" {
+			result = "done"
+		}
+		if s.hangJobs {
+			return "o", []interface{}{job}, nil
+		}
+		// The signal is sent before the reply, as callers wait for it
+		// after the reply anyway.
+		s.conn.emit(systemdBusPath, systemdManagerInterface, "JobRemoved", "uoss",
+			uint32(len(s.calls)), job, m.body[0], result)
+		return "o", []interface{}{job}, nil
+	case "EnableUnitFiles":
+		return "ba(sss)", []interface{}{true, []interface{}{}}, nil
+	case "DisableUnitFiles":
+		return "a(sss)", []interface{}{[]interface{}{}}, nil
+	}
+	return "", nil, &dbusCallError{name: "org.freedesktop.DBus.Error.UnknownMethod"}
+}
+
+// changed emits PropertiesChanged for props of unit.
+func (s *systemdStub) changed(t *testing.T, unit, iface string, props map[string]interface{}) {
+	t.Helper()
+	s.mu.Lock()
+	for k, v := range props {
+		s.units[unit][k] = v
+	}
+	s.mu.Unlock()
+	err := s.conn.emit(systemdStubPath(unit), "org.freedesktop.DBus.Properties", "PropertiesChanged", "sa{sv}as",
+		iface, props, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clients returns how many connections other than the stub's are on the
+// bus.
+func (s *systemdStub) clients(t *testing.T, ctx context.Context) int {
+	t.Helper()
+	body, err := s.conn.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "ListNames", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, name := range body[0].([]interface{}) {
+		if name := name.(string); strings.HasPrefix(name, ":") && name != s.conn.name {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *systemdStub) takeCalls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func TestSystemdWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stub := startSystemdStub(t, ctx)
+	stub.units["app.service"] = map[string]interface{}{
+		"LoadState": "loaded", "ActiveState": "inactive",
+		"MainPID": uint32(0), "ExecMainCode": int32(0), "ExecMainStatus": int32(0),
+	}
+
+	watchCtx, stop := context.WithCancel(ctx)
+	events := (&systemd{Config: &Config{Name: "app"}}).Watch(watchCtx)
+	next := func(want func(e StatusEvent) bool) StatusEvent {
+		t.Helper()
+		for {
+			select {
+			case e := <-events:
+				if want(e) {
+					return e
+				}
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for an event")
+			}
+		}
+	}
+
+	if e := next(func(StatusEvent) bool { return true }); e.State != StateStopped || e.Status != StatusStopped {
+		t.Errorf("first event = %+v, want stopped", e)
+	}
+	stub.changed(t, "app.service", systemdUnitInterface, map[string]interface{}{"ActiveState": "activating"})
+	next(func(e StatusEvent) bool { return e.State == StateStarting })
+	stub.changed(t, "app.service", systemdServiceInterface, map[string]interface{}{"MainPID": uint32(42)})
+	stub.changed(t, "app.service", systemdUnitInterface, map[string]interface{}{"ActiveState": "active"})
+	next(func(e StatusEvent) bool { return e.State == StateRunning && e.PID == 42 })
+
+	stub.changed(t, "app.service", systemdServiceInterface, map[string]interface{}{"MainPID": uint32(0), "ExecMainCode": int32(2), "ExecMainStatus": int32(9)})
+	stub.changed(t, "app.service", systemdUnitInterface, map[string]interface{}{"ActiveState": "failed", "Result": "signal"})
+	e := next(func(e StatusEvent) bool { return e.State == StateFailed })
+	if e.Signal != 9 || e.ExitCode != -1 || e.Err == nil {
+		t.Errorf("failed event = %+v, want signal 9", e)
+	}
+
+	stop()
+	for range events {
+	}
+}
+
+func TestSystemdWatchReconnect(t *testing.T) {
+	oldMin, oldPoll := systemdWatchBackoffMin, watchPollInterval
+	systemdWatchBackoffMin, watchPollInterval = 10*time.Millisecond, 10*time.Millisecond
+	defer func() { systemdWatchBackoffMin, watchPollInterval = oldMin, oldPoll }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stub := startSystemdStub(t, ctx)
+	stub.units["app.service"] = map[string]interface{}{"LoadState": "loaded", "ActiveState": "inactive", "MainPID": uint32(0)}
+
+	events := (&systemd{Config: &Config{Name: "app", runner: &recordingRunner{}}}).Watch(ctx)
+	next := func(want func(e StatusEvent) bool) {
+		t.Helper()
+		for {
+			select {
+			case e := <-events:
+				if want(e) {
+					return
+				}
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for an event")
+			}
+		}
+	}
+	next(func(e StatusEvent) bool { return e.State == StateStopped })
+
+	// Once the bus is back, the signals are followed again.
+	stub.stopBus()
+	stub = startSystemdStub(t, ctx)
+	stub.units["app.service"] = map[string]interface{}{"LoadState": "loaded", "ActiveState": "active", "MainPID": uint32(7)}
+	next(func(e StatusEvent) bool { return e.State == StateRunning && e.PID == 7 })
+	stub.changed(t, "app.service", systemdServiceInterface, map[string]interface{}{"MainPID": uint32(8)})
+	next(func(e StatusEvent) bool { return e.State == StateRunning && e.PID == 8 })
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestSystemdDBus(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stub := startSystemdStub(t, ctx)
+	stub.units["nginx.service"] = map[string]interface{}{
+		"LoadState": "loaded", "ActiveState": "active", "SubState": "running", "MainPID": uint32(7),
+	}
+	runner := &recordingRunner{}
+	m := &Manager{
+		System: NewSystem("test-systemd", func() bool { return true }, func() bool { return false }, newSystemdService),
+		Runner: runner,
+	}
+	opts := KeyValue{"SystemdDBus": true}
+
+	if _, err := m.Open("missing", opts); err != ErrNotInstalled {
+		t.Errorf("Open(missing) = %v, want ErrNotInstalled", err)
+	}
+	c, err := m.Open("nginx", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.takeCalls()
+	if status, err := c.Status(); status != StatusRunning || err != nil {
+		t.Errorf("Status() = %v, %v; want StatusRunning", status, err)
+	}
+	if err = c.Restart(); err != nil {
+		t.Errorf("Restart() = %v", err)
+	}
+	if err = c.Disable(); err != nil {
+		t.Errorf("Disable() = %v", err)
+	}
+	if err = c.(Reloader).Reload(); err != nil {
+		t.Errorf("Reload() = %v", err)
+	}
+	want := []string{
+		"LoadUnit nginx.service", "Get org.freedesktop.systemd1.Unit LoadState",
+		"LoadUnit nginx.service", "Get org.freedesktop.systemd1.Unit LoadState", "Get org.freedesktop.systemd1.Unit ActiveState",
+		"LoadUnit nginx.service", "Get org.freedesktop.systemd1.Unit LoadState",
+		"Subscribe", "RestartUnit nginx.service replace", "Unsubscribe",
+		"LoadUnit nginx.service", "Get org.freedesktop.systemd1.Unit LoadState",
+		"DisableUnitFiles [nginx.service] false", "Reload",
+		"LoadUnit nginx.service", "Get org.freedesktop.systemd1.Unit LoadState",
+		"Subscribe", "ReloadUnit nginx.service replace", "Unsubscribe",
+	}
+	if got := stub.takeCalls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+	// The Controller dialed once, and Open closed the connection of the
+	// missing service.
+	if n := stub.clients(t, ctx); n != 1 {
+		t.Errorf("%d connections to the bus, want 1", n)
+	}
+
+	stub.mu.Lock()
+	stub.jobResult = "failed"
+	stub.mu.Unlock()
+	if err = c.Stop(); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("Stop() = %v, want the job to fail", err)
+	}
+
+	infos, err := m.StatusMany([]string{"nginx", "missing"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infos["nginx"].Status != StatusRunning || infos["nginx"].PID != 7 || infos["missing"].Err != ErrNotInstalled {
+		t.Errorf("StatusMany() = %+v", infos)
+	}
+	if s, _ := m.New(nil, &Config{Name: "nginx", Option: opts}); s.(*systemd).getSystemdVersion() != 255 {
+		t.Errorf("getSystemdVersion() = %d, want 255", s.(*systemd).getSystemdVersion())
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("systemctl was run over D-Bus: %q", runner.commands)
+	}
+	c.Close()
+}
+
+func TestSystemdDBusJobTimeout(t *testing.T) {
+	defer func(d time.Duration) { systemdJobTimeout = d }(systemdJobTimeout)
+	systemdJobTimeout = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stub := startSystemdStub(t, ctx)
+	stub.units["app.service"] = map[string]interface{}{"LoadState": "loaded", "ActiveState": "inactive"}
+	stub.hangJobs = true
+
+	s := &systemd{Config: &Config{Name: "app", Option: KeyValue{"SystemdDBus": true}}}
+	defer s.Close()
+	if err := s.Stop(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() = %v, want the job to time out", err)
+	}
+	if calls := stub.takeCalls(); calls[len(calls)-1] != "Unsubscribe" {
+		t.Errorf("calls = %q, want Unsubscribe last", calls)
+	}
+}
+
+func TestSystemdDBusFallback(t *testing.T) {
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "missing"))
+	runner := &recordingRunner{}
+	logger := &recordingLogger{}
+	m := &Manager{
+		System: NewSystem("test-systemd", func() bool { return true }, func() bool { return true }, newSystemdService),
+		Runner: runner,
+		Logger: logger,
+	}
+	s, err := m.New(nil, &Config{Name: "app", Option: KeyValue{"SystemdDBus": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	s.Stop()
+	if want := []string{"systemctl start app.service", "systemctl stop app.service"}; !reflect.DeepEqual(runner.commands, want) {
+		t.Errorf("commands = %q, want %q", runner.commands, want)
+	}
+	// Why the bus cannot be reached is logged once.
+	if len(logger.msgs) != 1 || !strings.HasPrefix(logger.msgs[0], "W:Cannot control") {
+		t.Errorf("logged %q, want one warning", logger.msgs)
+	}
+}
+
+func Test_systemdStatusEvent(t *testing.T) {
+	tests := []struct {
+		props    map[string]interface{}
+		state    State
+		status   Status
+		exitCode int
+		err      bool
+	}{
+		{map[string]interface{}{"LoadState": "not-found", "ActiveState": "inactive"}, StateUnknown, StatusUnknown, -1, true},
+		{map[string]interface{}{"ActiveState": "deactivating"}, StateStopping, StatusRunning, -1, false},
+		{map[string]interface{}{"ActiveState": "inactive", "ExecMainCode": int32(1), "ExecMainStatus": int32(0)}, StateStopped, StatusStopped, 0, false},
+		{map[string]interface{}{"ActiveState": "failed", "ExecMainCode": int32(1), "ExecMainStatus": int32(3)}, StateFailed, StatusUnknown, 3, true},
+		{map[string]interface{}{"ActiveState": "maintenance"}, StateUnknown, StatusUnknown, -1, true},
+	}
+	for _, tt := range tests {
+		e := systemdStatusEvent(tt.props)
+		if e.State != tt.state || e.Status != tt.status || e.ExitCode != tt.exitCode || (e.Err != nil) != tt.err {
+			t.Errorf("systemdStatusEvent(%v) = %+v", tt.props, e)
+		}
+	}
+}
+
+func TestSystemdTransientArgs(t *testing.T) {
+	runner := &recordingRunner{}
+	m := &Manager{
+		System: NewSystem("test-systemd", func() bool { return true }, func() bool { return false }, newSystemdService),
+		Runner: runner,
+	}
+	s, err := m.New(nil, &Config{
+		Name:             "app",
+		Description:      "My app",
+		Executable:       "/opt/my app/app",
+		Arguments:        []string{"-c", "a b"},
+		WorkingDirectory: "/srv/my app",
+		UserName:         "app",
+		Dependencies:     []string{"After=network.target"},
+		EnvVars:          map[string]string{"B": "2", "A": "1"},
+		Option:           KeyValue{"UserService": true, "RestartSec": 5, "ReloadSignal": "HUP"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(TransientStarter); !ok {
+		t.Fatal("systemd service is not a TransientStarter")
+	}
+	args, err := s.(*systemd).transientArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--unit", "app.service", "--user", "--description", "My app",
+		"--property", "ConditionFileIsExecutable=/opt/my app/app",
+		"--property", "After=network.target",
+		"--property", "StartLimitIntervalSec=5",
+		"--property", "StartLimitBurst=10",
+		"--property", "WorkingDirectory=/srv/my app",
+		"--property", "User=app",
+		"--property", `ExecReload=/bin/kill -HUP "$MAINPID"`,
+		"--property", "Restart=always",
+		"--property", "RestartSec=5",
+		"--property", "EnvironmentFile=-/etc/sysconfig/app",
+		"--property", "Environment=A=1",
+		"--property", "Environment=B=2",
+		"--", "/opt/my app/app", "-c", "a b",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("transientArgs() =\n%q\nwant\n%q", args, want)
+	}
+
+	if err = s.(TransientStarter).StartTransient(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The commands before it are systemctl --version, rendering the unit.
+	if got, want := runner.commands[len(runner.commands)-1], "systemd-run "+strings.Join(want, " "); got != want {
+		t.Errorf("StartTransient() ran\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestSystemdTaskRestart(t *testing.T) {
+	m := &Manager{
+		System: NewSystem("test-systemd", func() bool { return true }, func() bool { return false }, newSystemdService),
+		Runner: &recordingRunner{},
+	}
+	s, err := m.New(&taskProgram{}, &Config{
+		Name:       "job",
+		Executable: "/opt/job",
+		Option:     KeyValue{"Restart": "always"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err = s.(*systemd).template().Execute(&b, s.(*systemd).templateData("/opt/job")); err != nil {
+		t.Fatal(err)
+	}
+	unit := b.String()
+	if !strings.Contains(unit, "Type=oneshot") || !strings.Contains(unit, "Restart=on-failure") {
+		t.Errorf("task unit =\n%s\nwant Type=oneshot and Restart=on-failure", unit)
+	}
+}
@@ -5,13 +5,13 @@
 package sysvc
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
@@ -57,6 +57,11 @@ func (s *sysv) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister.
+func (s *sysv) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles("/etc/init.d/*")
+}
+
 func (s *sysv) template() *template.Template {
 	customScript := s.Option.string(optionSysvScript, "")
 
@@ -75,6 +80,9 @@ func (s *sysv) Install() error {
 	if err == nil {
 		return fmt.Errorf("Init already exists: %s", confPath)
 	}
+	if err = s.installLogrotate(s.logFiles()); err != nil {
+		return err
+	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
@@ -91,10 +99,12 @@ func (s *sysv) Install() error {
 		*Config
 		Path         string
 		LogDirectory string
+		Task         bool
 	}{
 		s.Config,
 		path,
 		s.Option.string(optionLogDirectory, defaultLogDirectory),
+		isTask(s.i),
 	}
 
 	err = s.template().Execute(f, to)
@@ -127,36 +137,29 @@ func (s *sysv) Uninstall() error {
 	if err := os.Remove(cp); err != nil {
 		return err
 	}
-	return nil
+	return s.uninstallLogrotate()
 }
 
 func (s *sysv) Logger(errs chan<- error) (Logger, error) {
-	if system.Interactive() {
-		return ConsoleLogger, nil
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 func (s *sysv) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *sysv) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *sysv) Run() error {
+	return runServiceOutput(s, s.i, s.Config, s.logFiles(), "")
+}
 
-	return s.i.Stop(s)
+func (s *sysv) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *sysv) Status() (Status, error) {
-	_, out, err := runWithOutput("service", s.Name, "status")
+	_, out, err := s.runWithOutput("service", s.Name, "status")
 	if err != nil {
 		return StatusUnknown, err
 	}
@@ -171,12 +174,26 @@ func (s *sysv) Status() (Status, error) {
 	}
 }
 
+func (s *sysv) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	return tailLogFiles(ctx, q, s.logFiles())
+}
+
+// Watch polls the status early when the PID file of the init script
+// changes.
+func (s *sysv) Watch(ctx context.Context) <-chan StatusEvent {
+	return watchStatus(ctx, s.Status, inotifyWake(ctx, "/var/run/"+s.Name+".pid"))
+}
+
+func (s *sysv) logFiles() []logFile {
+	return s.outputLogFiles(".log", ".err")
+}
+
 func (s *sysv) Start() error {
-	return run("service", s.Name, "start")
+	return s.run("service", s.Name, "start")
 }
 
 func (s *sysv) Stop() error {
-	return run("service", s.Name, "stop")
+	return s.run("service", s.Name, "stop")
 }
 
 func (s *sysv) Restart() error {
@@ -187,3 +204,68 @@ func (s *sysv) Restart() error {
 	time.Sleep(50 * time.Millisecond)
 	return s.Start()
 }
+
+// sysvControl controls init scripts that sysvc did not necessarily write, so
+// their status is taken from the LSB exit code rather than the output.
+type sysvControl struct {
+	*sysv
+}
+
+// controller implements controlOpener.
+func (s *sysv) controller() controllable {
+	return sysvControl{s}
+}
+
+func (s sysvControl) exists() (bool, error) {
+	return pathExists("/etc/init.d/" + s.Name)
+}
+
+func (s sysvControl) Status() (Status, error) {
+	return lsbStatus(s.runWithOutput("service", s.Name, "status"))
+}
+
+func (s sysvControl) reload() error {
+	return s.run("service", s.Name, "reload")
+}
+
+// enable links the script into the runlevels as Install does, unless it is
+// already started in one of them.
+func (s sysvControl) enable() error {
+	if links, _ := filepath.Glob("/etc/rc[2345].d/S[0-9][0-9]" + s.Name); len(links) > 0 {
+		return nil
+	}
+	for _, i := range [...]string{"2", "3", "4", "5"} {
+		if err := os.Symlink("/etc/init.d/"+s.Name, "/etc/rc"+i+".d/S50"+s.Name); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// disable removes the links that start the script, leaving those that stop
+// it.
+func (s sysvControl) disable() error {
+	links, err := filepath.Glob("/etc/rc[0-6].d/S[0-9][0-9]" + s.Name)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		if err = os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// lsbStatus maps the exit code of the status action of an LSB init script:
+// 0 is running, 1 to 3 are the ways of not running and anything else is
+// unknown.
+func lsbStatus(exitCode int, out string, err error) (Status, error) {
+	switch {
+	case err == nil:
+		return StatusRunning, nil
+	case exitCode >= 1 && exitCode <= 3:
+		return StatusStopped, nil
+	}
+	return StatusUnknown, err
+}
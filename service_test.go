@@ -5,6 +5,9 @@
 package sysvc_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -41,6 +44,45 @@ func TestRunInterrupt(t *testing.T) {
 	}
 }
 
+func TestRunTask(t *testing.T) {
+	task := &taskProgram{err: &sysvc.ExitError{Code: 3, Err: errors.New("task failed")}}
+	sc := &sysvc.Config{
+		Name: "go_task_test",
+	}
+	s, err := sysvc.NewTask(task, sc)
+	if err != nil {
+		t.Fatalf("NewTask err: %s", err)
+	}
+
+	err = s.Run()
+	if task.numRun != 1 {
+		t.Errorf("Task.Run() called %d times, want 1", task.numRun)
+	}
+	if got := sysvc.ExitCode(err); got != 3 {
+		t.Errorf("ExitCode(%v) = %d, want 3", err, got)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, 0},
+		{"plain", errors.New("failed"), 1},
+		{"exit", &sysvc.ExitError{Code: 4}, 4},
+		{"wrapped", fmt.Errorf("wrapped: %w", &sysvc.ExitError{Code: 5}), 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sysvc.ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 const testInstallEnv = "TEST_USER_INSTALL"
 
 // Should always run, without asking for any permission
@@ -84,3 +126,13 @@ func (p *program) Stop(s sysvc.Service) error {
 	p.numStopped++
 	return nil
 }
+
+type taskProgram struct {
+	numRun int
+	err    error
+}
+
+func (p *taskProgram) Run(ctx context.Context, s sysvc.Service) error {
+	p.numRun++
+	return p.err
+}
@@ -9,11 +9,16 @@ package sysvc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log/syslog"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
 )
 
@@ -24,19 +29,12 @@ func newSysLogger(name string, errs chan<- error) (Logger, error) {
 	if err != nil {
 		return nil, err
 	}
-	return sysLogger{w, errs}, nil
+	return sysLogger{w, newErrorSink(errs)}, nil
 }
 
 type sysLogger struct {
 	*syslog.Writer
-	errs chan<- error
-}
-
-func (s sysLogger) send(err error) error {
-	if err != nil && s.errs != nil {
-		s.errs <- err
-	}
-	return err
+	*errorSink
 }
 
 func (s sysLogger) Error(v ...interface{}) error {
@@ -57,6 +55,145 @@ func (s sysLogger) Warningf(format string, a ...interface{}) error {
 func (s sysLogger) Infof(format string, a ...interface{}) error {
 	return s.send(s.Writer.Info(fmt.Sprintf(format, a...)))
 }
+func (s sysLogger) Debug(v ...interface{}) error {
+	return s.send(s.Writer.Debug(fmt.Sprint(v...)))
+}
+func (s sysLogger) Debugf(format string, a ...interface{}) error {
+	return s.send(s.Writer.Debug(fmt.Sprintf(format, a...)))
+}
+
+// outputLogFiles returns the files stdout and stderr are written to under
+// the LogDirectory option, named <name><stdoutSuffix> and <name><stderrSuffix>.
+func (c *Config) outputLogFiles(stdoutSuffix, stderrSuffix string) []logFile {
+	dir := c.Option.string(optionLogDirectory, defaultLogDirectory)
+	return []logFile{
+		{path: filepath.Join(dir, c.Name+stdoutSuffix), stream: LogStreamStdout},
+		{path: filepath.Join(dir, c.Name+stderrSuffix), stream: LogStreamStderr},
+	}
+}
+
+// runService hosts i for s: it calls Start, waits for a stop signal (or the
+// RunWait option, or for a Task to return), then calls Stop. The Loggers
+// that need it are closed last.
+func runService(s Service, i Interface, c *Config) error {
+	defer c.closeLoggers()
+	if err := i.Start(s); err != nil {
+		return err
+	}
+	notifyReady()
+
+	if t, ok := i.(*taskProgram); ok {
+		t.wait()
+	} else {
+		c.Option.funcSingle(optionRunWait, func() {
+			var sigChan = make(chan os.Signal, 3)
+			signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+			<-sigChan
+		})()
+	}
+
+	return i.Stop(s)
+}
+
+// envNotificationFD names the descriptor a supervisor reads a readiness
+// notification from. It is set by the generated s6 run script.
+const envNotificationFD = "SYSVC_NOTIFICATION_FD"
+
+// notifyReady tells the supervisor the program has started by writing a
+// newline to the notification descriptor, if there is one.
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(envNotificationFD))
+	if err != nil {
+		return
+	}
+	// Children started by the program must not inherit the variable.
+	os.Unsetenv(envNotificationFD)
+
+	f := os.NewFile(uintptr(fd), "notification-fd")
+	if f == nil {
+		return
+	}
+	f.Write([]byte("\n"))
+	f.Close()
+}
+
+// execRunner is the CommandRunner used when a Manager does not set one.
+type execRunner struct{}
+
+func (execRunner) Run(command string, arguments ...string) (int, string, error) {
+	return runWithOutput(command, arguments...)
+}
+
+// RunContext implements contextRunner.
+func (execRunner) RunContext(ctx context.Context, command string, arguments ...string) (int, string, error) {
+	return runCommandContext(ctx, command, true, arguments...)
+}
+
+// contextRunner is implemented by CommandRunners that can kill a command
+// when a context is done.
+type contextRunner interface {
+	RunContext(ctx context.Context, command string, arguments ...string) (int, string, error)
+}
+
+// Stream implements streamRunner.
+func (execRunner) Stream(ctx context.Context, command string, arguments ...string) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, command, arguments...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%q failed: %v", command, err)
+	}
+	return commandStream{stdout, cmd}, nil
+}
+
+// streamRunner is implemented by CommandRunners that can hand out the
+// standard output of a command while it is still running, as Logs needs to
+// follow a log.
+type streamRunner interface {
+	Stream(ctx context.Context, command string, arguments ...string) (io.ReadCloser, error)
+}
+
+// commandStream is the standard output of a running command. Close waits
+// for the command to exit.
+type commandStream struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (s commandStream) Close() error {
+	s.ReadCloser.Close()
+	return s.cmd.Wait()
+}
+
+func (c *Config) commandRunner() CommandRunner {
+	if c.runner != nil {
+		return c.runner
+	}
+	return execRunner{}
+}
+
+// run runs a service manager command with the CommandRunner of c.
+func (c *Config) run(command string, arguments ...string) error {
+	_, _, err := c.commandRunner().Run(command, arguments...)
+	return err
+}
+
+// runWithOutput is like run but also returns the exit code and stdout.
+func (c *Config) runWithOutput(command string, arguments ...string) (int, string, error) {
+	return c.commandRunner().Run(command, arguments...)
+}
+
+// runContext is like runWithOutput, but kills the command when ctx is done
+// if the CommandRunner of c can.
+func (c *Config) runContext(ctx context.Context, command string, arguments ...string) (int, string, error) {
+	r := c.commandRunner()
+	if cr, ok := r.(contextRunner); ok {
+		return cr.RunContext(ctx, command, arguments...)
+	}
+	return r.Run(command, arguments...)
+}
 
 func run(command string, arguments ...string) error {
 	_, _, err := runCommand(command, false, arguments...)
@@ -68,7 +205,11 @@ func runWithOutput(command string, arguments ...string) (int, string, error) {
 }
 
 func runCommand(command string, readStdout bool, arguments ...string) (int, string, error) {
-	cmd := exec.Command(command, arguments...)
+	return runCommandContext(context.Background(), command, readStdout, arguments...)
+}
+
+func runCommandContext(ctx context.Context, command string, readStdout bool, arguments ...string) (int, string, error) {
+	cmd := exec.CommandContext(ctx, command, arguments...)
 
 	var output string
 	var stdout io.ReadCloser
@@ -5,14 +5,13 @@
 package sysvc
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"regexp"
 	"strings"
-	"syscall"
 	"text/template"
 )
 
@@ -22,15 +21,19 @@ import (
 //go:embed service_upstart_linux.tmpl
 var upstartScript string
 
-func isUpstart() bool {
-	if _, err := os.Stat("/sbin/upstart-udev-bridge"); err == nil {
+func isUpstart(p *prober) bool {
+	if err := p.stat("/sbin/upstart-udev-bridge"); err == nil {
 		return true
 	}
-	if _, err := os.Stat("/sbin/initctl"); err == nil {
+	if err := p.stat("/sbin/initctl"); err == nil {
 		if _, out, err := runWithOutput("/sbin/initctl", "--version"); err == nil {
 			if strings.Contains(out, "initctl (upstart") {
+				p.record(Probe{Kind: "command", Target: "/sbin/initctl --version", Result: "upstart", OK: true})
 				return true
 			}
+			p.record(Probe{Kind: "command", Target: "/sbin/initctl --version", Result: "not upstart"})
+		} else {
+			p.record(Probe{Kind: "command", Target: "/sbin/initctl --version", Result: err.Error()})
 		}
 	}
 	return false
@@ -77,6 +80,11 @@ func (s *upstart) ConfigPath() (cp string, err error) {
 	return
 }
 
+// listInstalled implements installedLister.
+func (s *upstart) listInstalled() ([]InstalledService, error) {
+	return listInstalledFiles("/etc/init/*.conf")
+}
+
 func (s *upstart) hasKillStanza() bool {
 	version := s.getUpstartVersion()
 	if version == nil {
@@ -106,7 +114,7 @@ func (s *upstart) hasSetUIDStanza() bool {
 }
 
 func (s *upstart) getUpstartVersion() []int {
-	_, out, err := runWithOutput("/sbin/initctl", "--version")
+	_, out, err := s.runWithOutput("/sbin/initctl", "--version")
 	if err != nil {
 		return nil
 	}
@@ -138,6 +146,9 @@ func (s *upstart) Install() error {
 	if _, err = os.Stat(confPath); err == nil {
 		return fmt.Errorf("Init already exists: %s", confPath)
 	}
+	if err = s.installLogrotate(s.logFiles()); err != nil {
+		return err
+	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
@@ -157,6 +168,7 @@ func (s *upstart) Install() error {
 		HasSetUIDStanza bool
 		LogOutput       bool
 		LogDirectory    string
+		Task            bool
 	}{
 		s.Config,
 		path,
@@ -164,6 +176,7 @@ func (s *upstart) Install() error {
 		s.hasSetUIDStanza(),
 		s.Option.bool(optionLogOutput, optionLogOutputDefault),
 		s.Option.string(optionLogDirectory, defaultLogDirectory),
+		isTask(s.i),
 	}
 
 	return s.template().Execute(f, to)
@@ -177,35 +190,29 @@ func (s *upstart) Uninstall() error {
 	if err = os.Remove(cp); err != nil {
 		return err
 	}
-	return nil
+	return s.uninstallLogrotate()
 }
 
 func (s *upstart) Logger(errs chan<- error) (Logger, error) {
-	if system.Interactive() {
-		return ConsoleLogger, nil
+	if s.system().Interactive() {
+		return s.consoleLogger(), nil
 	}
-	return s.SystemLogger(errs)
+	return s.serviceLogger(errs, s.SystemLogger)
 }
 func (s *upstart) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *upstart) Run() (err error) {
-	if err = s.i.Start(s); err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *upstart) Run() error {
+	return runServiceOutput(s, s.i, s.Config, s.logFiles(), "")
+}
 
-	return s.i.Stop(s)
+func (s *upstart) Close() error {
+	return s.closeLoggers()
 }
 
 func (s *upstart) Status() (Status, error) {
-	exitCode, out, err := runWithOutput("initctl", "status", s.Name)
+	exitCode, out, err := s.runWithOutput("initctl", "status", s.Name)
 	if exitCode == 0 && err != nil {
 		return StatusUnknown, err
 	}
@@ -220,14 +227,64 @@ func (s *upstart) Status() (Status, error) {
 	}
 }
 
+func (s *upstart) Logs(ctx context.Context, q LogQuery) (<-chan LogEntry, error) {
+	files := s.logFiles()
+	if files == nil {
+		return nil, ErrLogsUnsupported
+	}
+	return tailLogFiles(ctx, q, files)
+}
+
+// logFiles returns the files output is written to with the LogOutput option,
+// or nil without it.
+func (s *upstart) logFiles() []logFile {
+	if !s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		return nil
+	}
+	return s.outputLogFiles(".out", ".err")
+}
+
 func (s *upstart) Start() error {
-	return run("initctl", "start", s.Name)
+	return s.run("initctl", "start", s.Name)
 }
 
 func (s *upstart) Stop() error {
-	return run("initctl", "stop", s.Name)
+	return s.run("initctl", "stop", s.Name)
 }
 
 func (s *upstart) Restart() error {
-	return run("initctl", "restart", s.Name)
+	return s.run("initctl", "restart", s.Name)
+}
+
+// controller implements controlOpener.
+func (s *upstart) controller() controllable {
+	return s
+}
+
+func (s *upstart) exists() (bool, error) {
+	return pathExists("/etc/init/" + s.Name + ".conf")
+}
+
+// overridePath is the override file upstart reads after the job.
+func (s *upstart) overridePath() string {
+	return "/etc/init/" + s.Name + ".override"
+}
+
+// enable removes the manual stanza disable wrote.
+func (s *upstart) enable() error {
+	err := os.Remove(s.overridePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// disable adds a manual stanza, which ignores the start on condition of the
+// job.
+func (s *upstart) disable() error {
+	return os.WriteFile(s.overridePath(), []byte("manual\n"), 0644)
+}
+
+func (s *upstart) reload() error {
+	return s.run("initctl", "reload", s.Name)
 }
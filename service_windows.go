@@ -13,6 +13,7 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"unsafe"
 
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
@@ -49,8 +50,8 @@ type windowsService struct {
 
 // WindowsLogger allows using windows specific logging methods.
 type WindowsLogger struct {
-	ev   *eventlog.Log
-	errs chan<- error
+	ev *eventlog.Log
+	*errorSink
 }
 
 type windowsSystem struct{}
@@ -73,16 +74,6 @@ func init() {
 	ChooseSystem(windowsSystem{})
 }
 
-func (l WindowsLogger) send(err error) error {
-	if err == nil {
-		return nil
-	}
-	if l.errs != nil {
-		l.errs <- err
-	}
-	return err
-}
-
 // Error logs an error message.
 func (l WindowsLogger) Error(v ...interface{}) error {
 	return l.send(l.ev.Error(3, fmt.Sprint(v...)))
@@ -184,10 +175,26 @@ func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, cha
 		return true, 1
 	}
 
+	// A Task ends the service when it returns.
+	var taskDone <-chan struct{}
+	if t, ok := ws.i.(*taskProgram); ok {
+		taskDone = t.done
+	}
+
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 loop:
 	for {
-		c := <-r
+		var c svc.ChangeRequest
+		select {
+		case c = <-r:
+		case <-taskDone:
+			changes <- svc.Status{State: svc.StopPending}
+			if err := ws.i.Stop(ws); err != nil {
+				ws.setError(err)
+				return true, uint32(ExitCode(err))
+			}
+			break loop
+		}
 		switch c.Cmd {
 		case svc.Interrogate:
 			changes <- c.CurrentStatus
@@ -273,6 +280,56 @@ func (ws *windowsService) setEnvironmentVariablesInRegistry() error {
 	return nil
 }
 
+// servicesKey is the registry key holding the services.
+const servicesKey = `SYSTEM\CurrentControlSet\Services`
+
+// markerValue is the registry value of the service holding the marker
+// ListInstalled looks for.
+const markerValue = "SysvcMarker"
+
+func (ws *windowsService) setMarkerInRegistry() error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, servicesKey+`\`+ws.Name, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed opening service registry key, err = %v", err)
+	}
+	defer k.Close()
+	if err = k.SetStringValue(markerValue, string(ws.markerJSON())); err != nil {
+		return fmt.Errorf("failed setting marker registry value, err = %v", err)
+	}
+	return nil
+}
+
+// listInstalled implements installedLister by looking for the marker value
+// in the registry keys of all services.
+func (ws *windowsService) listInstalled() ([]InstalledService, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, servicesKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	names, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	var list []InstalledService
+	for _, name := range names {
+		path := servicesKey + `\` + name
+		sk, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		v, _, err := sk.GetStringValue(markerValue)
+		sk.Close()
+		if err != nil {
+			continue
+		}
+		if m, err := decodeMarker([]byte(v)); err == nil {
+			list = append(list, m.installedService(`HKLM\`+path))
+		}
+	}
+	return list, nil
+}
+
 func (ws *windowsService) Install() error {
 	exepath, err := ws.execPath()
 	if err != nil {
@@ -322,6 +379,11 @@ func (ws *windowsService) Install() error {
 	if err != nil {
 		return err
 	}
+	if err = ws.setMarkerInRegistry(); err != nil {
+		s.Delete()
+		s.Close()
+		return err
+	}
 	if onFailure := ws.Option.string(OnFailure, ""); onFailure != "" {
 		var delay = 1 * time.Second
 		if d, err := time.ParseDuration(ws.Option.string(OnFailureDelayDuration, "1s")); err == nil {
@@ -381,6 +443,7 @@ func (ws *windowsService) Uninstall() error {
 }
 
 func (ws *windowsService) Run() error {
+	defer ws.closeLoggers()
 	ws.setError(nil)
 	if !interactive {
 		// Return error messages from start and stop routines
@@ -402,6 +465,11 @@ func (ws *windowsService) Run() error {
 		return err
 	}
 
+	if t, ok := ws.i.(*taskProgram); ok {
+		t.wait()
+		return ws.i.Stop(ws)
+	}
+
 	sigChan := make(chan os.Signal)
 
 	signal.Notify(sigChan, os.Interrupt)
@@ -411,6 +479,10 @@ func (ws *windowsService) Run() error {
 	return ws.i.Stop(ws)
 }
 
+func (ws *windowsService) Close() error {
+	return ws.closeLoggers()
+}
+
 func (ws *windowsService) Status() (Status, error) {
 	m, err := lowPrivMgr()
 	if err != nil {
@@ -431,8 +503,12 @@ func (ws *windowsService) Status() (Status, error) {
 	if err != nil {
 		return StatusUnknown, err
 	}
+	return stateStatus(status.State)
+}
 
-	switch status.State {
+// stateStatus maps the state of a service to its Status.
+func stateStatus(state svc.State) (Status, error) {
+	switch state {
 	case svc.StartPending:
 		fallthrough
 	case svc.Running:
@@ -448,7 +524,7 @@ func (ws *windowsService) Status() (Status, error) {
 	case svc.Stopped:
 		return StatusStopped, nil
 	default:
-		return StatusUnknown, fmt.Errorf("unknown status %v", status)
+		return StatusUnknown, fmt.Errorf("unknown status %v", state)
 	}
 }
 
@@ -553,9 +629,9 @@ func getStopTimeout() time.Duration {
 
 func (ws *windowsService) Logger(errs chan<- error) (Logger, error) {
 	if interactive {
-		return ConsoleLogger, nil
+		return ws.consoleLogger(), nil
 	}
-	return ws.SystemLogger(errs)
+	return ws.serviceLogger(errs, ws.SystemLogger)
 }
 
 func (ws *windowsService) SystemLogger(errs chan<- error) (Logger, error) {
@@ -563,9 +639,116 @@ func (ws *windowsService) SystemLogger(errs chan<- error) (Logger, error) {
 	if err != nil {
 		return nil, err
 	}
-	return WindowsLogger{el, errs}, nil
+	return WindowsLogger{el, newErrorSink(errs)}, nil
 }
 
 func (ws *windowsService) ConfigPath() (string, error) {
 	return "", ErrNoConfigPath
 }
+
+// controller implements controlOpener.
+func (ws *windowsService) controller() controllable {
+	return ws
+}
+
+func (ws *windowsService) exists() (bool, error) {
+	m, err := lowPrivMgr()
+	if err != nil {
+		return false, err
+	}
+	defer m.Disconnect()
+
+	s, err := lowPrivSvcForQuery(m, ws.Name)
+	if err != nil {
+		if errno, ok := err.(syscall.Errno); ok && errno == errnoServiceDoesNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+	s.Close()
+	return true, nil
+}
+
+// enable sets the start type of the service to automatic.
+func (ws *windowsService) enable() error {
+	return ws.setStartType(mgr.StartAutomatic)
+}
+
+// disable sets the start type of the service to disabled, which also keeps
+// it from being started by hand.
+func (ws *windowsService) disable() error {
+	return ws.setStartType(mgr.StartDisabled)
+}
+
+func (ws *windowsService) setStartType(startType uint32) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(ws.Name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	config, err := s.Config()
+	if err != nil {
+		return err
+	}
+	config.StartType = startType
+	return s.UpdateConfig(config)
+}
+
+// statusMany implements statusBatcher with a single enumeration of the
+// services by the SCM. Service names are not case sensitive.
+func (ws *windowsService) statusMany(names []string) (map[string]StatusInfo, error) {
+	m, err := lowPrivMgr()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Disconnect()
+
+	var bytesNeeded, servicesReturned uint32
+	var buf []byte
+	for {
+		var p *byte
+		if len(buf) > 0 {
+			p = &buf[0]
+		}
+		err = windows.EnumServicesStatusEx(m.Handle, windows.SC_ENUM_PROCESS_INFO,
+			windows.SERVICE_WIN32, windows.SERVICE_STATE_ALL,
+			p, uint32(len(buf)), &bytesNeeded, &servicesReturned, nil, nil)
+		if err == nil {
+			break
+		}
+		if err != syscall.ERROR_MORE_DATA || bytesNeeded <= uint32(len(buf)) {
+			return nil, err
+		}
+		buf = make([]byte, bytesNeeded)
+	}
+
+	infos := map[string]StatusInfo{}
+	if servicesReturned > 0 {
+		services := unsafe.Slice((*windows.ENUM_SERVICE_STATUS_PROCESS)(unsafe.Pointer(&buf[0])), int(servicesReturned))
+		for _, s := range services {
+			status, err := stateStatus(svc.State(s.ServiceStatusProcess.CurrentState))
+			info := StatusInfo{Status: status, Err: err}
+			if status == StatusRunning {
+				info.PID = int(s.ServiceStatusProcess.ProcessId)
+			}
+			infos[strings.ToLower(windows.UTF16PtrToString(s.ServiceName))] = info
+		}
+	}
+
+	result := make(map[string]StatusInfo, len(names))
+	for _, name := range names {
+		info, ok := infos[strings.ToLower(name)]
+		if !ok {
+			info = StatusInfo{Err: ErrNotInstalled}
+		}
+		result[name] = info
+	}
+	return result, nil
+}
@@ -0,0 +1,199 @@
+//go:build go1.21
+// +build go1.21
+
+package sysvc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// NewSlogHandler returns a slog.Handler that writes records to l. Attributes
+// become fields for Loggers that keep them, such as JournalLogger, and are
+// appended to the message as key=value pairs otherwise. Debug records are
+// only written if l implements DebugLogger.
+//
+// Errors from l are returned by Handle, and are still sent on the errs
+// channel l was created with.
+func NewSlogHandler(l Logger) slog.Handler {
+	return &slogHandler{l: l}
+}
+
+type slogHandler struct {
+	l      Logger
+	attrs  []slog.Attr // already qualified with their groups
+	groups []string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if level >= slog.LevelInfo {
+		return true
+	}
+	_, ok := h.l.(DebugLogger)
+	return ok
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(h2.attrs[:len(h2.attrs):len(h2.attrs)], h.qualify(attrs)...)
+	return &h2
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h2.groups[:len(h2.groups):len(h2.groups)], name)
+	return &h2
+}
+
+// qualify prefixes the keys of attrs with the open groups.
+func (h *slogHandler) qualify(attrs []slog.Attr) []slog.Attr {
+	if len(h.groups) == 0 {
+		return attrs
+	}
+	prefix := strings.Join(h.groups, ".") + "."
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = slog.Attr{Key: prefix + a.Key, Value: a.Value}
+	}
+	return out
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	var recordAttrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		recordAttrs = append(recordAttrs, a)
+		return true
+	})
+	attrs = append(attrs, h.qualify(recordAttrs)...)
+
+	fields := map[string]string{}
+	var keys []string
+	for _, a := range attrs {
+		flattenAttr(a, "", func(key, value string) {
+			if _, ok := fields[key]; !ok {
+				keys = append(keys, key)
+			}
+			fields[key] = value
+		})
+	}
+
+	level := slogLevel(r.Level)
+	if fl, ok := h.l.(fieldLogger); ok {
+		return fl.logFields(level, r.Message, r.PC, fields)
+	}
+
+	msg := &strings.Builder{}
+	msg.WriteString(r.Message)
+	for _, k := range keys {
+		msg.WriteByte(' ')
+		msg.WriteString(k)
+		msg.WriteByte('=')
+		msg.WriteString(quoteValue(fields[k]))
+	}
+	switch level {
+	case LevelError:
+		return h.l.Error(msg.String())
+	case LevelWarning:
+		return h.l.Warning(msg.String())
+	case LevelDebug:
+		if dl, ok := h.l.(DebugLogger); ok {
+			return dl.Debug(msg.String())
+		}
+		return nil
+	default:
+		return h.l.Info(msg.String())
+	}
+}
+
+// flattenAttr calls fn for a and, if it is a group, for each attribute in
+// it with the group name prefixed to the key.
+func flattenAttr(a slog.Attr, prefix string, fn func(key, value string)) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			flattenAttr(ga, prefix, fn)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	if v.Kind() == slog.KindTime {
+		fn(prefix+a.Key, v.Time().Format(time.RFC3339Nano))
+		return
+	}
+	fn(prefix+a.Key, v.String())
+}
+
+func slogLevel(l slog.Level) Level {
+	switch {
+	case l >= slog.LevelError:
+		return LevelError
+	case l >= slog.LevelWarn:
+		return LevelWarning
+	case l >= slog.LevelInfo:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
+
+// LoggerFromSlog returns a Logger that writes to l. It also implements
+// DebugLogger. Its methods always return nil, as slog does not report
+// errors.
+func LoggerFromSlog(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// log writes msg at level, attributing it to the caller of the Logger method.
+func (s slogLogger) log(level slog.Level, msg string) error {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return nil
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	s.l.Handler().Handle(ctx, r)
+	return nil
+}
+
+func (s slogLogger) Error(v ...interface{}) error {
+	return s.log(slog.LevelError, fmt.Sprint(v...))
+}
+func (s slogLogger) Warning(v ...interface{}) error {
+	return s.log(slog.LevelWarn, fmt.Sprint(v...))
+}
+func (s slogLogger) Info(v ...interface{}) error {
+	return s.log(slog.LevelInfo, fmt.Sprint(v...))
+}
+func (s slogLogger) Debug(v ...interface{}) error {
+	return s.log(slog.LevelDebug, fmt.Sprint(v...))
+}
+func (s slogLogger) Errorf(format string, a ...interface{}) error {
+	return s.log(slog.LevelError, fmt.Sprintf(format, a...))
+}
+func (s slogLogger) Warningf(format string, a ...interface{}) error {
+	return s.log(slog.LevelWarn, fmt.Sprintf(format, a...))
+}
+func (s slogLogger) Infof(format string, a ...interface{}) error {
+	return s.log(slog.LevelInfo, fmt.Sprintf(format, a...))
+}
+func (s slogLogger) Debugf(format string, a ...interface{}) error {
+	return s.log(slog.LevelDebug, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,142 @@
+//go:build go1.21
+// +build go1.21
+
+package sysvc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// recordLogger records what it is asked to log.
+type recordLogger struct {
+	lines []string
+	err   error
+}
+
+func (r *recordLogger) add(level, msg string) error {
+	r.lines = append(r.lines, level+": "+msg)
+	return r.err
+}
+func (r *recordLogger) Error(v ...interface{}) error   { return r.add("E", fmt.Sprint(v...)) }
+func (r *recordLogger) Warning(v ...interface{}) error { return r.add("W", fmt.Sprint(v...)) }
+func (r *recordLogger) Info(v ...interface{}) error    { return r.add("I", fmt.Sprint(v...)) }
+func (r *recordLogger) Errorf(format string, a ...interface{}) error {
+	return r.add("E", fmt.Sprintf(format, a...))
+}
+func (r *recordLogger) Warningf(format string, a ...interface{}) error {
+	return r.add("W", fmt.Sprintf(format, a...))
+}
+func (r *recordLogger) Infof(format string, a ...interface{}) error {
+	return r.add("I", fmt.Sprintf(format, a...))
+}
+
+type recordDebugLogger struct {
+	recordLogger
+}
+
+func (r *recordDebugLogger) Debug(v ...interface{}) error { return r.add("D", fmt.Sprint(v...)) }
+func (r *recordDebugLogger) Debugf(format string, a ...interface{}) error {
+	return r.add("D", fmt.Sprintf(format, a...))
+}
+
+type recordFieldLogger struct {
+	recordLogger
+	level  Level
+	msg    string
+	pc     uintptr
+	fields map[string]string
+}
+
+func (r *recordFieldLogger) logFields(level Level, msg string, pc uintptr, fields map[string]string) error {
+	r.level, r.msg, r.pc, r.fields = level, msg, pc, fields
+	return nil
+}
+
+func TestSlogHandler(t *testing.T) {
+	r := &recordLogger{}
+	l := slog.New(NewSlogHandler(r))
+
+	l.Debug("dropped")
+	l.Info("started", "port", 8080, "addr", "localhost:80")
+	l.Warn("slow", slog.Group("req", "id", 7, "path", "/a b"))
+	l.With("user", "bob").WithGroup("db").Error("failed", "err", errors.New("timeout"))
+	l.Log(context.Background(), slog.LevelWarn+2, "between")
+
+	want := []string{
+		"I: started port=8080 addr=localhost:80",
+		`W: slow req.id=7 req.path="/a b"`,
+		"E: failed user=bob db.err=timeout",
+		"W: between",
+	}
+	if strings.Join(r.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(r.lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSlogHandlerDebug(t *testing.T) {
+	r := &recordDebugLogger{}
+	l := slog.New(NewSlogHandler(r))
+	l.Debug("details", "n", 1)
+	if len(r.lines) != 1 || r.lines[0] != "D: details n=1" {
+		t.Errorf("lines = %q", r.lines)
+	}
+}
+
+func TestSlogHandlerError(t *testing.T) {
+	r := &recordLogger{err: errors.New("sink down")}
+	h := NewSlogHandler(r)
+	rec := slog.Record{Level: slog.LevelInfo, Message: "x"}
+	if err := h.Handle(context.Background(), rec); err != r.err {
+		t.Errorf("Handle() error = %v, want %v", err, r.err)
+	}
+}
+
+func TestSlogHandlerFields(t *testing.T) {
+	r := &recordFieldLogger{}
+	l := slog.New(NewSlogHandler(r)).With("service", "api")
+	l.Warn("slow", slog.Group("req", "id", 7))
+
+	if r.level != LevelWarning || r.msg != "slow" {
+		t.Errorf("logFields(%v, %q)", r.level, r.msg)
+	}
+	if r.pc == 0 {
+		t.Error("logFields() got no pc")
+	}
+	want := map[string]string{"service": "api", "req.id": "7"}
+	if fmt.Sprint(r.fields) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", r.fields, want)
+	}
+	if len(r.lines) != 0 {
+		t.Errorf("plain methods were used: %q", r.lines)
+	}
+}
+
+func TestLoggerFromSlog(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})
+	l := LoggerFromSlog(slog.New(h))
+
+	l.Infof("hello %s", "world")
+	l.Warning("careful")
+	l.Error("broken")
+	l.(DebugLogger).Debug("noisy")
+
+	out := buf.String()
+	for _, want := range []string{
+		`level=INFO source=`, `msg="hello world"`,
+		`level=WARN`, `msg=careful`,
+		`level=ERROR`, `msg=broken`,
+		`level=DEBUG`, `msg=noisy`,
+		`slog_test.go:`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
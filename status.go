@@ -0,0 +1,69 @@
+package sysvc
+
+import "io"
+
+// StatusInfo is the status of one service, as returned by StatusMany.
+type StatusInfo struct {
+	Status Status
+	// State is the state as the system names it, such as "failed" or
+	// "crashed", where the system tells.
+	State string
+	// PID is the main process of a running service, where the system
+	// tells.
+	PID int
+	// Err is why Status is StatusUnknown. It is ErrNotInstalled for
+	// services that do not exist.
+	Err error
+}
+
+// StatusMany returns the status of the services called names on the chosen
+// system, keyed by name. Where the system can, all of them are queried with
+// a single command, such as one systemctl show or launchctl list. opts are
+// the options of the system, as for Open.
+//
+// The error is only set if no status could be queried at all; the errors of
+// single services are in their StatusInfo.
+func StatusMany(names []string, opts KeyValue) (map[string]StatusInfo, error) {
+	return (&Manager{}).StatusMany(names, opts)
+}
+
+// StatusMany returns the status of the services called names on the system
+// of m, as StatusMany does.
+func (m *Manager) StatusMany(names []string, opts KeyValue) (map[string]StatusInfo, error) {
+	s, err := m.New(nil, &Config{Name: "sysvc", Option: opts})
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := s.(io.Closer); ok {
+		defer c.Close()
+	}
+	if len(names) == 0 {
+		return map[string]StatusInfo{}, nil
+	}
+	if b, ok := s.(statusBatcher); ok {
+		return b.statusMany(names)
+	}
+	if _, ok := s.(controlOpener); !ok {
+		return nil, ErrControlUnsupported
+	}
+
+	infos := make(map[string]StatusInfo, len(names))
+	for _, name := range names {
+		c, err := m.Open(name, opts)
+		if err != nil {
+			infos[name] = StatusInfo{Err: err}
+			continue
+		}
+		status, err := c.Status()
+		c.Close()
+		infos[name] = StatusInfo{Status: status, Err: err}
+	}
+	return infos, nil
+}
+
+// statusBatcher is implemented by services whose system can query the status
+// of many services at once. Systems without it have the services queried
+// one by one through their controllers.
+type statusBatcher interface {
+	statusMany(names []string) (map[string]StatusInfo, error)
+}
@@ -0,0 +1,27 @@
+package sysvc
+
+import "testing"
+
+func TestStatusManyFallback(t *testing.T) {
+	m := &Manager{System: fakeControlSystem(&fakeControllable{installed: true})}
+	infos, err := m.StatusMany([]string{"a", "b"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if info := infos[name]; info.Status != StatusRunning || info.Err != nil {
+			t.Errorf("%s: %+v, want running", name, info)
+		}
+	}
+
+	m = &Manager{System: fakeControlSystem(&fakeControllable{})}
+	infos, err = m.StatusMany([]string{"a"}, nil)
+	if err != nil || infos["a"].Err != ErrNotInstalled {
+		t.Errorf("StatusMany() = %+v, %v; want ErrNotInstalled for a", infos, err)
+	}
+
+	m = &Manager{System: fakeControlSystem(nil)}
+	if _, err = m.StatusMany([]string{"a"}, nil); err != ErrControlUnsupported {
+		t.Errorf("StatusMany() = %v, want ErrControlUnsupported", err)
+	}
+}
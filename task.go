@@ -0,0 +1,114 @@
+package sysvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Task represents a program that runs to completion rather than waiting
+// for a stop signal. Use NewTask to host a Task.
+//
+//  1. OS service manager executes user program.
+//  2. User program calls Service.Run() which blocks.
+//  3. Task.Run() is called with a context that is canceled when the
+//     service manager asks the program to stop.
+//  4. Task.Run() returns, and Service.Run returns the same error.
+//  5. User program exits with ExitCode(err).
+type Task interface {
+	// Run does the work of the task. It should return promptly once ctx is done.
+	Run(ctx context.Context, s Service) error
+}
+
+// ExitError may be returned from Task.Run to request a specific exit status.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode maps the error returned from Service.Run to a process exit status.
+// A nil error is 0, an *ExitError is its Code and any other error is 1.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return 1
+}
+
+// NewTask creates a new service that runs t to completion.
+//
+// The generated service definitions are adjusted for run-to-completion
+// programs, and the Restart option defaults to "on-failure".
+func NewTask(t Task, c *Config) (Service, error) {
+	return New(&taskProgram{task: t}, c)
+}
+
+// taskProgram adapts a Task to the Interface expected by the systems.
+type taskProgram struct {
+	task Task
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (p *taskProgram) Start(s Service) error {
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		p.err = p.task.Run(ctx, s)
+	}()
+	return nil
+}
+
+func (p *taskProgram) Stop(s Service) error {
+	p.cancel()
+	<-p.done
+	return p.err
+}
+
+// wait blocks until the task returns or the process is asked to stop.
+func (p *taskProgram) wait() {
+	var sigChan = make(chan os.Signal, 3)
+	signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigChan)
+
+	select {
+	case <-p.done:
+	case <-sigChan:
+	}
+}
+
+// isTask reports whether i was created by NewTask.
+func isTask(i Interface) bool {
+	_, ok := i.(*taskProgram)
+	return ok
+}
+
+// restartPolicy returns the Restart option, defaulting by program kind.
+func restartPolicy(i Interface, kv KeyValue) string {
+	if isTask(i) {
+		return kv.string(optionRestart, "on-failure")
+	}
+	return kv.string(optionRestart, "always")
+}
@@ -6,6 +6,10 @@ import (
 	"strings"
 )
 
+// Version is the version of sysvc. It is recorded in the definitions Install
+// writes, and reported for them by ListInstalled.
+const Version = "1.0.0"
+
 // versionAtMost will return true if the provided version is less than or equal to max
 func versionAtMost(version, max []int) (bool, error) {
 	if comp, err := versionCompare(version, max); err != nil {
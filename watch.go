@@ -0,0 +1,155 @@
+package sysvc
+
+import (
+	"context"
+	"time"
+)
+
+// State is the state of a service in a StatusEvent. It is finer than Status:
+// it tells services that are starting or stopping, and services that
+// stopped by failing, where the system tells.
+type State int
+
+const (
+	// StateUnknown means the state could not be determined, for example
+	// because the service is not installed.
+	StateUnknown State = iota
+	StateStarting
+	StateRunning
+	StateStopping
+	StateStopped
+	// StateFailed means the service stopped because it failed, or the
+	// system reports it in an error state.
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// StatusEvent is a change of the state of a service, sent by Watch.
+type StatusEvent struct {
+	// Time is when the change was seen.
+	Time  time.Time
+	State State
+	// Status is the state as Service.Status reports it.
+	Status Status
+	// PID is the main process of the service, where the system tells.
+	PID int
+	// ExitCode is the exit code of the main process of a stopped or failed
+	// service, or -1 if it is unknown or the process was killed by a
+	// signal.
+	ExitCode int
+	// Signal is the signal that killed the main process, or 0.
+	Signal int
+	// Err is why the state is StateUnknown or StateFailed, where known. It
+	// is ErrNotInstalled for services that do not exist.
+	Err error
+}
+
+// changed reports whether e tells something different from last.
+func (e StatusEvent) changed(last StatusEvent) bool {
+	if e.State != last.State || e.Status != last.Status || e.PID != last.PID ||
+		e.ExitCode != last.ExitCode || e.Signal != last.Signal {
+		return true
+	}
+	if (e.Err == nil) != (last.Err == nil) {
+		return true
+	}
+	return e.Err != nil && e.Err.Error() != last.Err.Error()
+}
+
+// Watcher is implemented by the Services of systems that notify sysvc of
+// changes of the state of a service, or tell early when to query it.
+type Watcher interface {
+	// Watch sends the current state of the service, then every change of
+	// it, until ctx is done, when the channel is closed.
+	Watch(ctx context.Context) <-chan StatusEvent
+}
+
+// Watch sends the current state of s, then every change of it, until ctx is
+// done, when the channel is closed. If s is not a Watcher, its Status is
+// polled.
+func Watch(ctx context.Context, s Service) <-chan StatusEvent {
+	if w, ok := s.(Watcher); ok {
+		return w.Watch(ctx)
+	}
+	return watchStatus(ctx, s.Status, nil)
+}
+
+// watchPollInterval is how often services that cannot be notified of
+// changes are queried while watched.
+var watchPollInterval = 2 * time.Second
+
+// watchStatus implements Watcher by polling status. It is also polled
+// whenever wake receives, which backends use to notice changes early; wake
+// may be nil.
+func watchStatus(ctx context.Context, status func() (Status, error), wake <-chan struct{}) <-chan StatusEvent {
+	events := make(chan StatusEvent)
+	go func() {
+		defer close(events)
+		pollStatus(ctx, events, StatusEvent{State: -1}, status, wake)
+	}()
+	return events
+}
+
+// pollStatus sends the events of status to events until ctx is done, and
+// returns the last event sent. No event is sent while nothing changed since
+// last.
+func pollStatus(ctx context.Context, events chan<- StatusEvent, last StatusEvent, status func() (Status, error), wake <-chan struct{}) StatusEvent {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		e := statusEvent(status())
+		if e.changed(last) {
+			if !sendEvent(ctx, events, e) {
+				return last
+			}
+			last = e
+		}
+		select {
+		case <-ticker.C:
+		case <-wake:
+		case <-ctx.Done():
+			return last
+		}
+	}
+}
+
+// statusEvent returns the event for the result of Service.Status.
+func statusEvent(status Status, err error) StatusEvent {
+	e := StatusEvent{Time: time.Now(), Status: status, ExitCode: -1, Err: err}
+	switch {
+	case err == ErrNotInstalled:
+		e.State = StateUnknown
+	case err != nil:
+		e.State = StateFailed
+	case status == StatusRunning:
+		e.State = StateRunning
+	case status == StatusStopped:
+		e.State = StateStopped
+	}
+	return e
+}
+
+// sendEvent sends e on events, unless ctx is done first.
+func sendEvent(ctx context.Context, events chan<- StatusEvent, e StatusEvent) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
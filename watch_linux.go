@@ -0,0 +1,73 @@
+package sysvc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyWake returns a channel receiving whenever one of paths is created,
+// written, removed or renamed, for watchStatus to poll early. The watches
+// are on the parent directories, so paths need not exist yet, but
+// directories that do not exist are not watched. It returns nil if nothing
+// could be watched.
+func inotifyWake(ctx context.Context, paths ...string) <-chan struct{} {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil
+	}
+	// A non-blocking file is read through the runtime poller, so closing
+	// it ends a pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	const mask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+		unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+	names := map[int32]map[string]bool{}
+	for _, path := range paths {
+		wd, err := unix.InotifyAddWatch(fd, filepath.Dir(path), mask)
+		if err != nil {
+			continue
+		}
+		if names[int32(wd)] == nil {
+			names[int32(wd)] = map[string]bool{}
+		}
+		names[int32(wd)][filepath.Base(path)] = true
+	}
+	if len(names) == 0 {
+		f.Close()
+		return nil
+	}
+
+	wake := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+				off += unix.SizeofInotifyEvent + int(ev.Len)
+				name := string(bytes.TrimRight(nameBytes, "\x00"))
+				if !names[ev.Wd][name] {
+					continue
+				}
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return wake
+}
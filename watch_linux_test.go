@@ -0,0 +1,38 @@
+package sysvc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyWake(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wake := inotifyWake(ctx, filepath.Join(dir, "app.pid"), filepath.Join(dir, "missing", "x.pid"))
+	if wake == nil {
+		t.Skip("inotify not available")
+	}
+
+	// Other files in the directory do not wake.
+	if err := os.WriteFile(filepath.Join(dir, "other.pid"), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-wake:
+		t.Fatal("woken by another file")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "app.pid"), []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-wake:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not woken when the PID file was written")
+	}
+}
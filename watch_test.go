@@ -0,0 +1,60 @@
+package sysvc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchStatus(t *testing.T) {
+	defer func(d time.Duration) { watchPollInterval = d }(watchPollInterval)
+	watchPollInterval = time.Hour
+
+	// Each poll takes the status the test sends.
+	statuses := make(chan Status)
+	poll := func() (Status, error) {
+		status := <-statuses
+		if status == StatusUnknown {
+			return status, ErrNotInstalled
+		}
+		return status, nil
+	}
+	wake := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	events := watchStatus(ctx, poll, wake)
+
+	statuses <- StatusStopped
+	if e := <-events; e.State != StateStopped || e.ExitCode != -1 {
+		t.Errorf("first event = %+v, want stopped", e)
+	}
+	// Polls without a change send nothing.
+	wake <- struct{}{}
+	statuses <- StatusStopped
+	wake <- struct{}{}
+	statuses <- StatusRunning
+	if e := <-events; e.State != StateRunning || e.Status != StatusRunning {
+		t.Errorf("event = %+v, want running", e)
+	}
+	wake <- struct{}{}
+	statuses <- StatusUnknown
+	if e := <-events; e.State != StateUnknown || e.Err != ErrNotInstalled {
+		t.Errorf("event = %+v, want ErrNotInstalled", e)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("channel not closed when the context is done")
+	}
+}
+
+func TestWatchPolls(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := Watch(ctx, plainService{status: StatusRunning})
+	if e := <-events; e.State != StateRunning || e.Status != StatusRunning {
+		t.Errorf("first event = %+v, want running", e)
+	}
+	cancel()
+	for range events {
+	}
+}